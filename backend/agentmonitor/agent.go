@@ -0,0 +1,209 @@
+package main
+
+import (
+	"cmd/agentmonitor/collector"
+	"cmd/agentmonitor/config"
+	"cmd/agentmonitor/data"
+	"cmd/agentmonitor/logger"
+	"cmd/agentmonitor/metrics"
+	"cmd/agentmonitor/spool"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-co-op/gocron"
+)
+
+// agent 按一份配置运行的采集、发送、心跳与 metrics 任务，重新加载配置时整体替换
+type agent struct {
+	cfg         *config.Config
+	reg         *collector.Registry
+	sender      *data.Sender // 不推送数据时为 nil
+	heartbeater *data.Heartbeater
+	remote      *data.RemoteConfigFetcher // 未启用下发配置时为 nil
+	commander   *data.Commander           // 未启用远程命令时为 nil
+	store       *metrics.Store
+	metricsSrv  *http.Server
+	scheduler   *gocron.Scheduler
+
+	// collectCtx 在停止超时后取消，让正在进行的采集与发送尽快结束
+	collectCtx    context.Context
+	cancelCollect context.CancelFunc
+	// taskCtx 在停止开始时取消，结束补发、心跳与远程命令
+	taskCtx    context.Context
+	cancelTask context.CancelFunc
+	tasks      sync.WaitGroup
+
+	mu       sync.Mutex
+	stopping bool
+	cycles   sync.WaitGroup
+}
+
+// newAgent 按配置创建所有组件，出错时不会留下正在运行的任务
+func newAgent(cfg *config.Config) (*agent, error) {
+	a := &agent{cfg: cfg}
+
+	var client *http.Client
+	if !cfg.Server.Disabled {
+		var err error
+		client, err = data.NewHTTPClient(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("创建 HTTP 客户端失败: %v", err)
+		}
+
+		// 本地缓存，创建失败时只记录日志，不影响正常发送
+		var sp *spool.Spool
+		if cfg.Spool.Dir != "" {
+			sp, err = spool.New(cfg.Spool.Dir, cfg.Spool.MaxBytes, cfg.Spool.MaxFiles, cfg.Spool.MaxAge)
+			if err != nil {
+				logger.Errorf("初始化本地缓存失败，发送失败的数据将被丢弃: %v", err)
+			} else if n, _, err := sp.Depth(); err == nil && n > 0 {
+				logger.Infof("本地缓存中有 %d 条待补发的数据", n)
+			}
+		}
+		a.sender = data.NewSender(client, cfg.Server.URLs, sp, spool.Backoff{Base: cfg.Spool.RetryBase, Max: cfg.Spool.RetryMax})
+	}
+
+	reg, err := data.NewRegistry(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("注册采集器失败: %v", err)
+	}
+	a.reg = reg
+
+	// 心跳与监控数据分开发送，服务器据此判断 agent 是否存活
+	if a.sender != nil && cfg.Heartbeat.Interval > 0 {
+		a.heartbeater = data.NewHeartbeater(client, cfg, reg, a.sender)
+	}
+	if cfg.RemoteConfigEnabled() {
+		a.remote = data.NewRemoteConfigFetcher(client, cfg)
+	}
+	if cfg.Commands.Enabled && client != nil {
+		a.commander = data.NewCommander(client, cfg)
+	}
+	if cfg.Metrics.Listen != "" {
+		a.store = metrics.NewStore()
+	}
+
+	a.collectCtx, a.cancelCollect = context.WithCancel(context.Background())
+	a.taskCtx, a.cancelTask = context.WithCancel(context.Background())
+	return a, nil
+}
+
+// start 启动 metrics 接口、补发、心跳与采集调度
+func (a *agent) start() error {
+	// Prometheus 抓取接口，与推送互不影响
+	if a.store != nil {
+		srv, err := metrics.Listen(a.cfg.Metrics.Listen, a.cfg.Metrics.Path, a.store)
+		if err != nil {
+			return err
+		}
+		a.metricsSrv = srv
+		logger.Infof("metrics 接口监听 %s%s", a.cfg.Metrics.Listen, a.cfg.Metrics.Path)
+	}
+
+	if a.sender != nil {
+		a.tasks.Add(1)
+		go func() {
+			defer a.tasks.Done()
+			a.sender.RunReplay(a.taskCtx)
+		}()
+	}
+	if a.heartbeater != nil {
+		a.tasks.Add(1)
+		go func() {
+			defer a.tasks.Done()
+			a.heartbeater.Run(a.taskCtx, a.cfg.Heartbeat.Interval)
+		}()
+	}
+	if a.commander != nil {
+		a.tasks.Add(1)
+		go func() {
+			defer a.tasks.Done()
+			a.commander.Run(a.taskCtx)
+		}()
+	}
+
+	//创建调度器
+	a.scheduler = gocron.NewScheduler(time.UTC)
+	// 单例模式，上一次采集未完成时跳过本次
+	a.scheduler.SingletonModeAll()
+	if _, err := a.scheduler.Every(a.cfg.Interval).Do(a.cycle); err != nil {
+		return fmt.Errorf("创建采集任务失败: %v", err)
+	}
+	a.scheduler.StartAsync()
+	return nil
+}
+
+// cycle 一个采集周期：采集、更新 metrics 并发送
+func (a *agent) cycle() {
+	a.mu.Lock()
+	if a.stopping {
+		a.mu.Unlock()
+		return
+	}
+	a.cycles.Add(1)
+	a.mu.Unlock()
+	defer a.cycles.Done()
+
+	// 收集监控数据
+	datas := data.CollectMonitorData(a.collectCtx, a.cfg, a.reg)
+	if a.store != nil {
+		a.store.Update(datas.HostInfo, datas.CollectedAt, datas.Sections)
+	}
+	if a.sender == nil {
+		return
+	}
+	payload, err := json.Marshal(datas)
+	if err != nil {
+		logger.Errorf("数据序列化错误: %v", err)
+		return
+	}
+	// 发送收集到的数据到服务器，失败或 agent 正在停止时写入本地缓存
+	err = a.sender.Send(a.collectCtx, payload)
+	if err != nil {
+		logger.Errorf("发送数据错误: %v", err)
+	}
+}
+
+// stop 停止调度并等待当前采集周期完成，超过 shutdown_timeout 时取消采集，数据写入本地缓存
+func (a *agent) stop() {
+	// 置位后调度器触发的新周期直接返回；gocron 的 Stop 会等待运行中的任务，因此在当前周期结束后再调用
+	a.mu.Lock()
+	a.stopping = true
+	a.mu.Unlock()
+
+	// 先停止补发与心跳，避免刚写入缓存的数据在停止过程中又被补发
+	a.cancelTask()
+	a.tasks.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		a.cycles.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(a.cfg.ShutdownTimeout):
+		logger.Warnf("当前采集周期在 %v 内未完成，取消采集", a.cfg.ShutdownTimeout)
+		a.cancelCollect()
+		<-done
+	}
+	a.cancelCollect()
+	if a.scheduler != nil {
+		a.scheduler.Stop()
+	}
+
+	if a.metricsSrv != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := a.metricsSrv.Shutdown(ctx); err != nil {
+			logger.Warnf("关闭 metrics 接口失败: %v", err)
+		}
+		cancel()
+	}
+	if err := a.reg.Close(); err != nil {
+		logger.Warnf("关闭采集器失败: %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package checks
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Nagios 插件的退出码
+const (
+	StatusOK       = 0
+	StatusWarning  = 1
+	StatusCritical = 2
+	StatusUnknown  = 3
+)
+
+var statusNames = map[int]string{
+	StatusOK:       "OK",
+	StatusWarning:  "WARNING",
+	StatusCritical: "CRITICAL",
+	StatusUnknown:  "UNKNOWN",
+}
+
+// Check 一个检查脚本
+type Check struct {
+	Name      string
+	Command   string // 通过 /bin/sh -c 执行
+	Interval  time.Duration
+	Timeout   time.Duration
+	MaxOutput int // 保留的输出字节数上限
+}
+
+// Result 一次检查的结果
+type Result struct {
+	Name       string  `json:"name"`
+	Status     int     `json:"status"` // 0 OK、1 WARNING、2 CRITICAL、3 UNKNOWN
+	State      string  `json:"state"`
+	Output     string  `json:"output"`                // 第一行状态文本
+	LongOutput string  `json:"long_output,omitempty"` // 其余行
+	Perfdata   []Perf  `json:"perfdata,omitempty"`
+	Truncated  bool    `json:"truncated,omitempty"` // 输出超出上限被截断
+	DurationMs float64 `json:"duration_ms"`
+	CheckedAt  int64   `json:"checked_at"` // Unix 时间戳（秒）
+}
+
+// Runner 按各自的周期运行检查，未到周期的检查返回上一次的结果
+type Runner struct {
+	checks []Check
+
+	mu      sync.Mutex
+	last    map[string]time.Time
+	results map[string]Result
+}
+
+// NewRunner 创建检查运行器
+func NewRunner(checks []Check) *Runner {
+	return &Runner{
+		checks:  checks,
+		last:    map[string]time.Time{},
+		results: map[string]Result{},
+	}
+}
+
+// Run 并发运行所有到期的检查，返回所有检查的最新结果
+func (r *Runner) Run(ctx context.Context) []Result {
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	for _, c := range r.checks {
+		r.mu.Lock()
+		last, ok := r.last[c.Name]
+		// 留出 1 秒余量，避免调度抖动导致跳过一个周期
+		due := !ok || now.Sub(last) >= c.Interval-time.Second
+		if due {
+			r.last[c.Name] = now
+		}
+		r.mu.Unlock()
+		if !due {
+			continue
+		}
+
+		wg.Add(1)
+		go func(c Check) {
+			defer wg.Done()
+			res := Run(ctx, c)
+			r.mu.Lock()
+			r.results[c.Name] = res
+			r.mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	results := make([]Result, 0, len(r.checks))
+	for _, c := range r.checks {
+		if res, ok := r.results[c.Name]; ok {
+			results = append(results, res)
+		}
+	}
+	return results
+}
+
+// Run 运行一次检查
+func Run(ctx context.Context, c Check) Result {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	out := &limitedBuffer{limit: c.MaxOutput}
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", c.Command)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	// 脚本在独立的进程组中运行，超时时连同其子进程一起结束
+	KillGroupOnCancel(cmd)
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	res := Result{
+		Name:       c.Name,
+		Truncated:  out.truncated,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		CheckedAt:  start.Unix(),
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		res.Status = StatusUnknown
+		res.Output = "检查超时（" + c.Timeout.String() + "）"
+	case err == nil:
+		res.Status = StatusOK
+	case errors.As(err, &exitErr):
+		res.Status = exitErr.ExitCode()
+		// 超出 0-3 的退出码按 Nagios 约定视为 UNKNOWN
+		if res.Status < StatusOK || res.Status > StatusUnknown {
+			res.Status = StatusUnknown
+		}
+	default:
+		res.Status = StatusUnknown
+		res.Output = "执行检查失败: " + err.Error()
+	}
+	res.State = statusNames[res.Status]
+
+	if res.Output == "" {
+		res.Output, res.LongOutput, res.Perfdata = ParseOutput(out.String())
+	}
+	return res
+}
+
+// limitedBuffer 只保留前 limit 个字节的输出，limit 为 0 时不限制
+type limitedBuffer struct {
+	limit     int
+	buf       []byte
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.limit > 0 && len(b.buf)+len(p) > b.limit {
+		b.buf = append(b.buf, p[:b.limit-len(b.buf)]...)
+		b.truncated = true
+		// 返回完整长度，避免脚本因写入失败而提前退出
+		return len(p), nil
+	}
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	return string(b.buf)
+}
@@ -0,0 +1,119 @@
+package checks
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Perf 一项性能数据，格式为 'label'=value[UOM];[warn];[crit];[min];[max]
+// 阈值保留原始字符串，Nagios 阈值可以是 10、10:、~:10、@10:20 等范围写法
+type Perf struct {
+	Label string  `json:"label"`
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit,omitempty"`
+	Warn  string  `json:"warn,omitempty"`
+	Crit  string  `json:"crit,omitempty"`
+	Min   string  `json:"min,omitempty"`
+	Max   string  `json:"max,omitempty"`
+}
+
+// ParseOutput 解析插件输出
+// 第一行 | 之前为状态文本，之后为性能数据；后续行中第一个 | 之后的内容也都是性能数据
+func ParseOutput(output string) (string, string, []Perf) {
+	output = strings.TrimRight(output, "\n")
+	lines := strings.SplitN(output, "\n", 2)
+
+	text, perf, _ := strings.Cut(lines[0], "|")
+	text = strings.TrimSpace(text)
+	perfText := []string{perf}
+
+	var long string
+	if len(lines) > 1 {
+		rest, morePerf, found := strings.Cut(lines[1], "|")
+		long = strings.TrimSpace(rest)
+		if found {
+			perfText = append(perfText, morePerf)
+		}
+	}
+
+	return text, long, ParsePerfdata(strings.Join(perfText, " "))
+}
+
+// ParsePerfdata 解析以空白分隔的性能数据，无法解析的项被忽略
+func ParsePerfdata(s string) []Perf {
+	var perfs []Perf
+	for _, item := range splitPerfItems(s) {
+		if p, ok := parsePerfItem(item); ok {
+			perfs = append(perfs, p)
+		}
+	}
+	return perfs
+}
+
+// splitPerfItems 按空白切分，单引号内的空白不切分
+func splitPerfItems(s string) []string {
+	var items []string
+	var cur strings.Builder
+	quoted := false
+	for _, r := range s {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+			cur.WriteRune(r)
+		case !quoted && (r == ' ' || r == '\t' || r == '\n' || r == '\r'):
+			if cur.Len() > 0 {
+				items = append(items, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if cur.Len() > 0 {
+		items = append(items, cur.String())
+	}
+	return items
+}
+
+func parsePerfItem(item string) (Perf, bool) {
+	eq := strings.LastIndex(item, "=")
+	if eq <= 0 {
+		return Perf{}, false
+	}
+	label := item[:eq]
+	if len(label) >= 2 && label[0] == '\'' && label[len(label)-1] == '\'' {
+		// 标签中的单引号以两个单引号转义
+		label = strings.ReplaceAll(label[1:len(label)-1], "''", "'")
+	}
+	if label == "" {
+		return Perf{}, false
+	}
+
+	fields := strings.Split(item[eq+1:], ";")
+	value, unit := splitUnit(fields[0])
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return Perf{}, false
+	}
+
+	p := Perf{Label: label, Value: v, Unit: unit}
+	for i, dst := range []*string{&p.Warn, &p.Crit, &p.Min, &p.Max} {
+		if i+1 < len(fields) {
+			*dst = fields[i+1]
+		}
+	}
+	return p, true
+}
+
+// splitUnit 拆分数值与单位，如 "95.5%" 拆为 "95.5" 与 "%"
+func splitUnit(s string) (string, string) {
+	i := len(s)
+	for i > 0 {
+		c := s[i-1]
+		if (c >= '0' && c <= '9') || c == '.' {
+			break
+		}
+		i--
+	}
+	return s[:i], s[i:]
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package checks
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// KillGroupOnCancel 让 cmd 在独立的进程组中运行，context 取消时连同其子进程一起结束
+func KillGroupOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,6 @@
+package checks
+
+import "os/exec"
+
+// KillGroupOnCancel Windows 没有进程组，context 取消时只结束 cmd 本身
+func KillGroupOnCancel(cmd *exec.Cmd) {}
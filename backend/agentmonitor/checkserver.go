@@ -0,0 +1,131 @@
+package main
+
+import (
+	"cmd/agentmonitor/config"
+	"cmd/agentmonitor/data"
+	"cmd/agentmonitor/logger"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// serverMaxSkew 服务器校验签名时允许的时钟偏差，与服务器的 SignatureMaxSkew 一致
+	serverMaxSkew = 5 * time.Minute
+	// clockSkewWarn 时钟偏差超过该值时提示
+	clockSkewWarn = 30 * time.Second
+	// certExpiryWarn 服务器证书在该时间内过期时提示
+	certExpiryWarn = 14 * 24 * time.Hour
+)
+
+// runCheckServer 检查与各服务器的连接、请求签名与时钟偏差，全部通过时退出码为 0
+func runCheckServer(args []string) int {
+	logger.SetConsole(os.Stderr)
+	var o options
+	fs := newFlagSet("check-server", &o)
+	fs.Parse(args)
+
+	cfg, err := o.loadCached()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := logger.Init(cfg.Log.Level, ""); err != nil {
+		fmt.Fprintf(os.Stderr, "初始化日志失败: %v\n", err)
+		return 1
+	}
+	if !checkServer(os.Stdout, cfg) {
+		return 1
+	}
+	return 0
+}
+
+// checkServer 依次检查获取下发配置的各地址并输出结果，该接口只读且校验签名；全部通过（允许提示）时返回 true
+func checkServer(out io.Writer, cfg *config.Config) bool {
+	if cfg.Server.Disabled {
+		fmt.Fprintln(out, "server.disabled 为 true，agent 不连接服务器")
+		return false
+	}
+	client, err := data.NewHTTPClient(cfg)
+	if err != nil {
+		fmt.Fprintf(out, "创建 HTTP 客户端失败: %v\n", err)
+		return false
+	}
+
+	fmt.Fprintf(out, "主机名 %s\n", cfg.AgentHostName())
+	ok := true
+	for _, url := range cfg.RemoteConfigURLs() {
+		fmt.Fprintf(out, "\n%s\n", url)
+		check := data.CheckServer(context.Background(), client, url)
+		if check.Err != nil {
+			fmt.Fprintf(out, "  [FAIL] 连接: %v\n", check.Err)
+			ok = false
+			continue
+		}
+		fmt.Fprintf(out, "  [OK]   连接: 耗时 %v%s\n", check.Latency.Round(10*time.Microsecond), describeTLS(check.TLS))
+		if check.TLS != nil && len(check.TLS.PeerCertificates) > 0 {
+			if left := time.Until(check.TLS.PeerCertificates[0].NotAfter); left < certExpiryWarn {
+				fmt.Fprintf(out, "  [WARN] 证书: 服务器证书将在 %v 后过期\n", left.Round(time.Hour))
+			}
+		}
+
+		switch check.StatusCode {
+		case http.StatusOK, http.StatusNotModified:
+			fmt.Fprintln(out, "  [OK]   认证: 签名校验通过")
+		case http.StatusNotFound:
+			fmt.Fprintln(out, "  [WARN] 认证: 服务器没有 /agent/config 接口，可能是旧版本服务器，无法检查认证")
+		default:
+			msg := http.StatusText(check.StatusCode)
+			if check.Message != "" {
+				msg = check.Message
+			}
+			fmt.Fprintf(out, "  [FAIL] 认证: %d %s\n", check.StatusCode, msg)
+			ok = false
+		}
+
+		if !check.HasClock {
+			fmt.Fprintln(out, "  [WARN] 时钟: 服务器响应中没有 Date，无法检查时钟偏差")
+			continue
+		}
+		skew := check.ClockSkew.Round(100 * time.Millisecond)
+		desc := fmt.Sprintf("本机比服务器快 %v", skew)
+		if skew < 0 {
+			desc = fmt.Sprintf("本机比服务器慢 %v", -skew)
+		}
+		switch abs := max(skew, -skew); {
+		case abs > serverMaxSkew:
+			fmt.Fprintf(out, "  [FAIL] 时钟: %s，超过服务器允许的 %v，请求会被拒绝\n", desc, serverMaxSkew)
+			ok = false
+		case abs > clockSkewWarn:
+			fmt.Fprintf(out, "  [WARN] 时钟: %s，请检查 NTP 同步\n", desc)
+		default:
+			fmt.Fprintf(out, "  [OK]   时钟: %s\n", desc)
+		}
+	}
+	return ok
+}
+
+// describeTLS 描述 TLS 版本与服务器证书，HTTP 连接时为空
+func describeTLS(cs *tls.ConnectionState) string {
+	if cs == nil {
+		return ""
+	}
+	desc := "，" + tls.VersionName(cs.Version)
+	if len(cs.PeerCertificates) > 0 {
+		cert := cs.PeerCertificates[0]
+		name := cert.Subject.CommonName
+		if len(cert.DNSNames) > 0 {
+			name = strings.Join(cert.DNSNames, ",")
+		}
+		desc += fmt.Sprintf("，证书 %s，%s 到期", name, cert.NotAfter.Format("2006-01-02"))
+	}
+	if len(cs.VerifiedChains) == 0 && len(cs.PeerCertificates) > 0 {
+		desc += "（未校验证书）"
+	}
+	return desc
+}
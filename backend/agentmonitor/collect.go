@@ -0,0 +1,289 @@
+package main
+
+import (
+	"cmd/agentmonitor/data"
+	"cmd/agentmonitor/logger"
+	"cmd/agentmonitor/metrics"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+)
+
+// 表格中单元格的最大字符数，过长的命令行、检查输出等被截断
+const maxCellWidth = 60
+
+// runCollect 按配置采集并输出到标准输出，不向服务器发送；--once 时只采集一次，否则按采集周期持续输出直到被中断
+func runCollect(args []string) int {
+	logger.SetConsole(os.Stderr)
+	var o options
+	fs := newFlagSet("collect", &o)
+	once := fs.Bool("once", false, "Collect one sample and exit")
+	format := fs.String("format", "json", "Output format: json, table or prometheus")
+	fs.Parse(args)
+	if *format != "json" && *format != "table" && *format != "prometheus" {
+		fmt.Fprintf(os.Stderr, "未知的输出格式 %q，可选值: json、table、prometheus\n", *format)
+		return 2
+	}
+
+	cfg, err := o.loadCached()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := logger.Init(cfg.Log.Level, ""); err != nil {
+		fmt.Fprintf(os.Stderr, "初始化日志失败: %v\n", err)
+		return 1
+	}
+	cfg.FIM.ReadOnly = true
+	reg, err := data.NewRegistry(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "注册采集器失败: %v\n", err)
+		return 1
+	}
+	defer reg.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		sample := data.CollectMonitorData(ctx, cfg, reg)
+		if ctx.Err() != nil {
+			return 1
+		}
+		if err := writeSample(os.Stdout, sample, *format); err != nil {
+			fmt.Fprintf(os.Stderr, "输出数据失败: %v\n", err)
+			return 1
+		}
+		if *once {
+			// 有采集器出错时退出码为 1，便于脚本判断
+			if len(sample.CollectorErrors) > 0 {
+				return 1
+			}
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
+
+// writeSample 按 format 输出一次采集的数据
+func writeSample(out io.Writer, sample data.MonitorData, format string) error {
+	switch format {
+	case "table":
+		return writeTable(out, sample)
+	case "prometheus":
+		// 与 metrics 接口的输出相同，只包含内置采集器的数据
+		store := metrics.NewStore()
+		store.Update(sample.HostInfo, sample.CollectedAt, sample.Sections)
+		_, err := store.WriteTo(out)
+		return err
+	default:
+		content, err := json.MarshalIndent(sample, "", "  ")
+		if err != nil {
+			return fmt.Errorf("数据序列化错误: %v", err)
+		}
+		_, err = out.Write(append(content, '\n'))
+		return err
+	}
+}
+
+// writeTable 以表格输出一次采集的数据，结构体按字段逐行输出，结构体列表每个元素一行，各采集器按字段名排序
+func writeTable(out io.Writer, sample data.MonitorData) error {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "collected_at\t%s\n", sample.CollectedAt.Format(time.RFC3339))
+	writeSection(tw, "host_info", reflect.ValueOf(sample.HostInfo))
+
+	fields := make([]string, 0, len(sample.Sections))
+	for field := range sample.Sections {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		writeSection(tw, field, reflect.ValueOf(sample.Sections[field]))
+	}
+
+	if len(sample.CollectorErrors) > 0 {
+		names := make([]string, 0, len(sample.CollectorErrors))
+		for name := range sample.CollectorErrors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(tw, "\n[collector_errors]\n")
+		for _, name := range names {
+			fmt.Fprintf(tw, "%s\t%s\n", name, sample.CollectorErrors[name])
+		}
+	}
+	return tw.Flush()
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// writeSection 输出一个采集器的数据，嵌套的结构体与结构体列表作为子表输出，标题为以点连接的字段名
+// id 只在服务器写入数据库时使用，不输出
+func writeSection(w io.Writer, title string, v reflect.Value) {
+	v = indirect(v)
+	if !v.IsValid() {
+		return
+	}
+	fmt.Fprintf(w, "\n[%s]\n", title)
+	switch {
+	case isStruct(v.Type()):
+		var nested []jsonField
+		for _, f := range jsonFields(v.Type()) {
+			fv := v.Field(f.index)
+			if f.name == "id" {
+				continue
+			}
+			if isTable(fv.Type()) {
+				nested = append(nested, f)
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\n", f.name, formatCell(fv))
+		}
+		for _, f := range nested {
+			writeSection(w, title+"."+f.name, v.Field(f.index))
+		}
+	case isTable(v.Type()):
+		if v.Len() == 0 {
+			fmt.Fprintln(w, "（无）")
+			return
+		}
+		elem := v.Type().Elem()
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		// 每行的采集时间相同，表格中省略
+		var cols []jsonField
+		for _, f := range jsonFields(elem) {
+			if f.name != "id" && elem.Field(f.index).Type != timeType {
+				cols = append(cols, f)
+			}
+		}
+		for i, f := range cols {
+			if i > 0 {
+				fmt.Fprint(w, "\t")
+			}
+			fmt.Fprint(w, f.name)
+		}
+		fmt.Fprintln(w)
+		for i := 0; i < v.Len(); i++ {
+			row := indirect(v.Index(i))
+			for j, f := range cols {
+				if j > 0 {
+					fmt.Fprint(w, "\t")
+				}
+				if row.IsValid() {
+					fmt.Fprint(w, formatCell(row.Field(f.index)))
+				}
+			}
+			fmt.Fprintln(w)
+		}
+	default:
+		fmt.Fprintln(w, formatCell(v))
+	}
+}
+
+type jsonField struct {
+	name  string
+	index int
+}
+
+// jsonFields 结构体中参与 JSON 序列化的字段，名称与上报数据中的一致
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, jsonField{name: name, index: i})
+	}
+	return fields
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func isStruct(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != timeType
+}
+
+// isTable 结构体与结构体列表作为单独的表输出，其余值作为单元格
+func isTable(t reflect.Type) bool {
+	if isStruct(t) {
+		return true
+	}
+	return (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && isStruct(t.Elem())
+}
+
+// formatCell 将值格式化为一个单元格，换行与制表符替换为空格，过长时截断
+func formatCell(v reflect.Value) string {
+	v = indirect(v)
+	if !v.IsValid() || ((v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.IsNil()) {
+		return "-"
+	}
+	var s string
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if f == math.Trunc(f) {
+			s = fmt.Sprintf("%.0f", f)
+		} else {
+			s = fmt.Sprintf("%.2f", f)
+		}
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.String:
+		s = fmt.Sprint(v.Interface())
+	default:
+		if v.Type() == timeType {
+			s = v.Interface().(time.Time).Format(time.RFC3339)
+			break
+		}
+		content, err := json.Marshal(v.Interface())
+		if err != nil {
+			s = fmt.Sprint(v.Interface())
+		} else {
+			s = string(content)
+		}
+	}
+	s = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(s)
+	if utf8.RuneCountInString(s) > maxCellWidth {
+		s = string([]rune(s)[:maxCellWidth-1]) + "…"
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,216 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Collector 采集器，每个采集器的数据在上报数据中占一个字段
+type Collector interface {
+	// Name 采集器名称，与配置文件 collectors 下的名称一致
+	Name() string
+	// Interval 采集周期
+	Interval() time.Duration
+	// Collect 采集一次数据，ctx 到期后应尽快返回
+	Collect(ctx context.Context) (interface{}, error)
+}
+
+// funcCollector 将普通的采集函数包装为 Collector
+type funcCollector struct {
+	name     string
+	interval time.Duration
+	fn       func(ctx context.Context) (interface{}, error)
+}
+
+// New 使用采集函数创建采集器
+func New(name string, interval time.Duration, fn func(ctx context.Context) (interface{}, error)) Collector {
+	return &funcCollector{name: name, interval: interval, fn: fn}
+}
+
+func (c *funcCollector) Name() string            { return c.name }
+func (c *funcCollector) Interval() time.Duration { return c.interval }
+func (c *funcCollector) Collect(ctx context.Context) (interface{}, error) {
+	return c.fn(ctx)
+}
+
+// entry 注册表中的一个采集器
+type entry struct {
+	collector Collector
+	field     string        // 上报数据中的字段名
+	timeout   time.Duration // 单次采集的超时时间
+
+	lastRun      time.Time
+	running      bool
+	lastDuration time.Duration
+}
+
+// Registry 采集器注册表
+type Registry struct {
+	mu      sync.Mutex
+	entries []*entry
+}
+
+// Result 一次采集的结果，未到采集周期的采集器不出现在结果中
+type Result struct {
+	Data   map[string]interface{} // 以字段名为 key 的采集数据
+	Errors map[string]string      // 以采集器名称为 key 的错误信息
+}
+
+// NewRegistry 创建空的注册表
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register 注册采集器，field 为其数据在上报数据中的字段名，timeout 为单次采集的超时时间
+func (r *Registry) Register(field string, c Collector, timeout time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.entries {
+		if e.collector.Name() == c.Name() {
+			return fmt.Errorf("采集器 %s 重复注册", c.Name())
+		}
+		if e.field == field {
+			return fmt.Errorf("采集器 %s 与 %s 使用了相同的字段 %s", c.Name(), e.collector.Name(), field)
+		}
+	}
+	r.entries = append(r.entries, &entry{collector: c, field: field, timeout: timeout})
+	return nil
+}
+
+// Names 返回所有已注册采集器的名称
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.entries))
+	for _, e := range r.entries {
+		names = append(names, e.collector.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LastDurations 返回各采集器最近一次采集的耗时
+func (r *Registry) LastDurations() map[string]time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	durations := make(map[string]time.Duration, len(r.entries))
+	for _, e := range r.entries {
+		if !e.lastRun.IsZero() {
+			durations[e.collector.Name()] = e.lastDuration
+		}
+	}
+	return durations
+}
+
+// Close 关闭实现了 io.Closer 的采集器，停止其后台任务
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for _, e := range r.entries {
+		if c, ok := e.collector.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("关闭采集器 %s 失败: %v", e.collector.Name(), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// due 判断采集器在本周期是否需要采集，调用方需持有锁
+func (e *entry) due(now time.Time) bool {
+	// 留出 1 秒余量，避免调度抖动导致跳过一个周期
+	return e.lastRun.IsZero() || now.Sub(e.lastRun) >= e.collector.Interval()-time.Second
+}
+
+type outcome struct {
+	data interface{}
+	err  error
+}
+
+// Run 并发运行所有到期的采集器，单个采集器失败或超时不影响其他采集器的结果
+func (r *Registry) Run(ctx context.Context, now time.Time) Result {
+	result := Result{
+		Data:   map[string]interface{}{},
+		Errors: map[string]string{},
+	}
+
+	r.mu.Lock()
+	var due []*entry
+	for _, e := range r.entries {
+		if !e.due(now) {
+			continue
+		}
+		e.lastRun = now
+		if e.running {
+			// 超时后被放弃的采集仍未返回，不重复启动，避免 goroutine 堆积
+			result.Errors[e.collector.Name()] = "上一次采集尚未结束"
+			continue
+		}
+		e.running = true
+		due = append(due, e)
+	}
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, e := range due {
+		wg.Add(1)
+		go func(e *entry) {
+			defer wg.Done()
+			data, err := r.collect(ctx, e)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				result.Errors[e.collector.Name()] = err.Error()
+				return
+			}
+			result.Data[e.field] = data
+		}(e)
+	}
+	wg.Wait()
+
+	return result
+}
+
+// collect 运行单个采集器，超时后立即返回，采集器自身在后台结束后再清除运行标记
+func (r *Registry) collect(ctx context.Context, e *entry) (interface{}, error) {
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+
+	done := make(chan outcome, 1)
+	go func() {
+		start := time.Now()
+		var o outcome
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					o.err = fmt.Errorf("采集器异常: %v", p)
+				}
+			}()
+			o.data, o.err = e.collector.Collect(ctx)
+		}()
+
+		r.mu.Lock()
+		e.running = false
+		e.lastDuration = time.Since(start)
+		r.mu.Unlock()
+		done <- o
+	}()
+
+	select {
+	case o := <-done:
+		return o.data, o.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("采集超时: %v", ctx.Err())
+	}
+}
@@ -0,0 +1,109 @@
+package command
+
+import (
+	"cmd/agentmonitor/checks"
+	"context"
+	"errors"
+	"os/exec"
+	"time"
+	"unicode/utf8"
+)
+
+// Command 一条允许远程执行的命令
+type Command struct {
+	Name      string
+	Command   string // 通过 /bin/sh -c 执行
+	Timeout   time.Duration
+	MaxOutput int // stdout 与 stderr 各保留的字节数上限
+}
+
+// Result 命令的执行结果
+type Result struct {
+	ExitCode  int    `json:"exit_code"` // 未能运行、超时或被信号结束时为 -1
+	Error     string `json:"error,omitempty"`
+	Truncated bool   `json:"truncated"` // 输出超出上限被截断
+}
+
+// Run 执行命令，args 作为 $1、$2... 传给命令，不经过 shell 解析
+// 输出产生时通过 emit 传出，stdout 与 stderr 可能并发调用 emit
+func Run(ctx context.Context, c Command, args []string, emit func(stream string, data []byte)) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	stdout := &stream{name: "stdout", limit: c.MaxOutput, emit: emit}
+	stderr := &stream{name: "stderr", limit: c.MaxOutput, emit: emit}
+	// sh -c 的第一个参数作为 $0，之后的参数依次为 $1、$2...
+	cmd := exec.CommandContext(ctx, "/bin/sh", append([]string{"-c", c.Command, c.Name}, args...)...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// 命令在独立的进程组中运行，超时或取消时连同其子进程一起结束
+	checks.KillGroupOnCancel(cmd)
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	stdout.flush()
+	stderr.flush()
+	res := Result{ExitCode: -1, Truncated: stdout.truncated || stderr.truncated}
+
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		res.Error = "命令超时（" + c.Timeout.String() + "）"
+	case ctx.Err() != nil:
+		res.Error = "agent 停止或重新加载配置，命令被取消"
+	case err == nil:
+		res.ExitCode = 0
+	case errors.As(err, &exitErr):
+		res.ExitCode = exitErr.ExitCode()
+		if res.ExitCode == -1 {
+			res.Error = exitErr.Error()
+		}
+	default:
+		res.Error = "执行命令失败: " + err.Error()
+	}
+	return res
+}
+
+// stream 将一个输出流传给 emit，只传出前 limit 个字节
+type stream struct {
+	name      string
+	limit     int
+	emit      func(stream string, data []byte)
+	written   int
+	pending   []byte // 末尾不完整的 UTF-8 字符，留到下一次写入，避免一个字符被拆到两段输出中
+	truncated bool
+}
+
+func (s *stream) Write(p []byte) (int, error) {
+	n := len(p)
+	if s.written+len(p) > s.limit {
+		p = p[:s.limit-s.written]
+		s.truncated = true
+	}
+	s.written += len(p)
+
+	data := append(s.pending, p...)
+	s.pending = nil
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				s.pending = append([]byte(nil), data[i:]...)
+				data = data[:i]
+			}
+			break
+		}
+	}
+	if len(data) > 0 {
+		s.emit(s.name, data)
+	}
+	// 返回完整长度，避免命令因写入失败而提前退出
+	return n, nil
+}
+
+// flush 传出剩余的字节
+func (s *stream) flush() {
+	if len(s.pending) > 0 {
+		s.emit(s.name, s.pending)
+		s.pending = nil
+	}
+}
@@ -0,0 +1,861 @@
+package config
+
+import (
+	"cmd/agentmonitor/logger"
+	"cmd/agentmonitor/update"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Collectors 所有内置采集器的名称
+var Collectors = []string{"cpu", "memory", "host", "process", "network", "disk", "diskio", "conn", "checks", "probes", "logs", "watchlist", "fim", "sessions", "logins"}
+
+// ServerConfig 监控服务器配置，配置多个地址时按顺序尝试，直到有一个发送成功
+type ServerConfig struct {
+	URLs     []string      `yaml:"urls"`
+	Timeout  time.Duration `yaml:"timeout"`
+	Disabled bool          `yaml:"disabled"` // 不向服务器推送数据，只通过 metrics 接口提供
+}
+
+// HeartbeatConfig 心跳配置，心跳只包含 agent 自身的运行状态，比监控数据更频繁地发送
+type HeartbeatConfig struct {
+	Interval time.Duration `yaml:"interval"` // 为 0 时不发送心跳
+	URLs     []string      `yaml:"urls"`     // 为空时使用 server.urls 各地址的 /agent/heartbeat
+}
+
+// RemoteConfig 服务器下发的配置，agent 启动时与每次心跳后获取，合并在本地配置之上
+type RemoteConfig struct {
+	Enabled   bool     `yaml:"enabled"`
+	URLs      []string `yaml:"urls"`       // 为空时使用 server.urls 各地址的 /agent/config
+	CacheFile string   `yaml:"cache_file"` // 保存最近一次获取的配置，启动时服务器不可达也能使用，为空时不保存
+}
+
+// RemoteForbidden 下发的配置不能修改的字段，避免下发错误的配置后 agent 无法再连接服务器，嵌套字段以 . 分隔
+// commands 与 checks 会在本机执行命令，metrics.listen 决定在哪个地址暴露指标，其余字段决定 agent 读写哪些本机文件，只能在本地配置
+var RemoteForbidden = []string{"host_name", "token", "server", "tls", "update", "remote_config", "commands", "checks", "metrics.listen",
+	"logwatch.files", "fim.paths", "fim.baseline_file", "logins.auth_logs", "spool.dir", "log.file"}
+
+// CommandsConfig 远程命令配置，agent 向服务器长轮询待执行的命令，只执行 allow 中的命令
+type CommandsConfig struct {
+	Enabled       bool            `yaml:"enabled"`
+	URLs          []string        `yaml:"urls"`           // 为空时使用 server.urls 各地址的 /agent/commands
+	MaxConcurrent int             `yaml:"max_concurrent"` // 同时执行的命令数上限
+	MaxOutput     int             `yaml:"max_output"`     // 每条命令的 stdout 与 stderr 各保留的字节数上限
+	Allow         []CommandConfig `yaml:"allow"`
+}
+
+// CommandConfig 一条允许远程执行的命令，服务器只能按名称提交
+type CommandConfig struct {
+	Name      string        `yaml:"name"`
+	Command   string        `yaml:"command"`    // 通过 /bin/sh -c 执行
+	Timeout   time.Duration `yaml:"timeout"`    // 为 0 时使用 60s
+	AllowArgs bool          `yaml:"allow_args"` // 允许提交时附带参数，参数作为 $1、$2... 传给命令，不经过 shell 解析
+}
+
+// 远程命令名称只允许安全的字符，与服务器的校验一致
+var commandNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// MetricsConfig Prometheus 抓取接口配置，Listen 为空时不启用
+type MetricsConfig struct {
+	Listen string `yaml:"listen"` // 监听地址，如 :9101
+	Path   string `yaml:"path"`
+}
+
+// UpdateConfig 自动升级配置，服务器在心跳响应中下发目标版本，agent 校验签名后替换自身并重启
+type UpdateConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	PublicKey       string        `yaml:"public_key"`       // base64 编码的 ed25519 公钥，用于校验新版本的签名
+	DownloadTimeout time.Duration `yaml:"download_timeout"` // 下载新版本的超时时间
+}
+
+// CollectorConfig 单个采集器的配置，Interval、Timeout 为 0 时跟随全局配置
+type CollectorConfig struct {
+	Enabled  *bool         `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// ProcessConfig 进程采集配置，按名称与用户的汇总总是基于所有进程计算
+type ProcessConfig struct {
+	TopCPU int `yaml:"top_cpu"` // 按 CPU 使用率上报的进程数，0 表示不限制
+	TopMem int `yaml:"top_mem"` // 按内存占用上报的进程数，0 表示不限制
+}
+
+type TLSConfig struct {
+	CAFile             string   `yaml:"ca_file"`   // 校验服务器证书的 CA
+	CertFile           string   `yaml:"cert_file"` // 客户端证书
+	KeyFile            string   `yaml:"key_file"`
+	ServerName         string   `yaml:"server_name"`
+	InsecureSkipVerify bool     `yaml:"insecure_skip_verify"`
+	PinSHA256          []string `yaml:"pin_sha256"` // 服务器证书链中任一证书公钥（SPKI）的 SHA-256，base64 编码，配置后只信任这些公钥
+}
+
+// CheckConfig 一个 Nagios 风格的检查脚本，脚本以退出码 0/1/2/3 表示 OK/WARNING/CRITICAL/UNKNOWN
+type CheckConfig struct {
+	Name      string        `yaml:"name"`
+	Command   string        `yaml:"command"`    // 通过 /bin/sh -c 执行
+	Interval  time.Duration `yaml:"interval"`   // 为 0 时跟随 checks 采集器的周期
+	Timeout   time.Duration `yaml:"timeout"`    // 为 0 时使用 10s
+	MaxOutput int           `yaml:"max_output"` // 保留的输出字节数上限，为 0 时使用 4096
+}
+
+// ProbeConfig 一个拨测目标，在 agent 所在网络内检查服务的可用性
+type ProbeConfig struct {
+	Name     string        `yaml:"name"`
+	Type     string        `yaml:"type"`     // http、tcp、dns
+	Target   string        `yaml:"target"`   // http 为 URL，tcp 为 host:port，dns 为域名
+	Interval time.Duration `yaml:"interval"` // 为 0 时跟随 probes 采集器的周期
+	Timeout  time.Duration `yaml:"timeout"`  // 为 0 时使用 10s
+
+	Method             string `yaml:"method"`
+	ExpectStatus       []int  `yaml:"expect_status"` // 为空时要求 2xx 或 3xx
+	BodyRegex          string `yaml:"body_regex"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+
+	RecordType string `yaml:"record_type"` // A、AAAA、CNAME、MX、TXT、NS，为空时查询 A 与 AAAA
+	Resolver   string `yaml:"resolver"`    // host:port，为空时使用系统解析器
+	Expect     string `yaml:"expect"`      // 应答中需包含的值
+}
+
+// WatchConfig 一个被监视的进程，process_name、cmdline、pidfile 三种匹配方式只能配置一种
+type WatchConfig struct {
+	Name         string `yaml:"name"`
+	ProcessName  string `yaml:"process_name"`  // 可执行文件名完全匹配
+	Cmdline      string `yaml:"cmdline"`       // 命令行正则匹配
+	PidFile      string `yaml:"pidfile"`       // pid 文件中记录的进程
+	MinInstances int    `yaml:"min_instances"` // 匹配的进程数不少于该值时为 up，为 0 时使用 1
+}
+
+// LogWatchConfig 日志监控配置，跟踪日志文件并将匹配规则的行作为事件上报
+type LogWatchConfig struct {
+	MaxEvents int             `yaml:"max_events"` // 每次上报的事件数上限，为 0 时使用 500
+	Files     []LogFileConfig `yaml:"files"`
+}
+
+type LogFileConfig struct {
+	Path  string          `yaml:"path"`
+	Rules []LogRuleConfig `yaml:"rules"` // 按顺序匹配，一行只产生第一条匹配规则的事件
+}
+
+// LogRuleConfig 一条匹配规则，正则中的命名分组 (?P<name>...) 作为事件的字段
+type LogRuleConfig struct {
+	Name       string        `yaml:"name"`
+	Pattern    string        `yaml:"pattern"`
+	Severity   string        `yaml:"severity"`    // info、warning、error、critical，为空时为 warning
+	RateLimit  int           `yaml:"rate_limit"`  // 每个 rate_window 内最多上报的事件数，0 表示不限制
+	RateWindow time.Duration `yaml:"rate_window"` // 为 0 时使用 1m
+}
+
+// Severities 日志事件的级别，由低到高
+var Severities = []string{"info", "warning", "error", "critical"}
+
+// FIMConfig 文件完整性监控配置，按 fim 采集器的周期扫描文件，与基线比较后报告新增、删除与修改的文件
+type FIMConfig struct {
+	Paths        []string `yaml:"paths"`         // 文件、目录（递归）或 glob
+	Exclude      []string `yaml:"exclude"`       // 与文件名或完整路径匹配的 glob
+	MaxHashSize  int64    `yaml:"max_hash_size"` // 超过该大小的文件不计算哈希，只比较其他属性
+	MaxFiles     int      `yaml:"max_files"`     // 扫描的文件数上限
+	BaselineFile string   `yaml:"baseline_file"` // 为空时基线只保存在内存中，agent 重启期间的变化无法发现
+
+	// ReadOnly 只与基线比较而不更新基线，collect 等子命令使用，避免 agent 漏报这期间的变化
+	ReadOnly bool `yaml:"-"`
+}
+
+// LoginsConfig 登录审计配置，跟踪 sshd 的认证日志，将登录成功与失败作为事件上报
+type LoginsConfig struct {
+	AuthLogs  []string `yaml:"auth_logs"`  // 如 /var/log/auth.log（Debian/Ubuntu）、/var/log/secure（RHEL/CentOS）
+	MaxEvents int      `yaml:"max_events"` // 每次上报的事件数上限，为 0 时使用 1000；合并后的失败算一条
+}
+
+// SpoolConfig 本地缓存配置，Dir 为空时不缓存发送失败的数据
+type SpoolConfig struct {
+	Dir       string        `yaml:"dir"`
+	MaxBytes  int64         `yaml:"max_bytes"` // 缓存总大小上限，0 表示不限制
+	MaxFiles  int           `yaml:"max_files"` // 缓存条数上限，0 表示不限制
+	MaxAge    time.Duration `yaml:"max_age"`   // 超过该时间的数据不再补发，0 表示不限制
+	RetryBase time.Duration `yaml:"retry_base"`
+	RetryMax  time.Duration `yaml:"retry_max"`
+}
+
+type LogConfig struct {
+	Level string `yaml:"level"`
+	File  string `yaml:"file"`
+}
+
+// Config agent 的全部配置
+type Config struct {
+	HostName        string                     `yaml:"host_name"`
+	Token           string                     `yaml:"token"`
+	Server          ServerConfig               `yaml:"server"`
+	Heartbeat       HeartbeatConfig            `yaml:"heartbeat"`
+	Metrics         MetricsConfig              `yaml:"metrics"`
+	Update          UpdateConfig               `yaml:"update"`
+	RemoteConfig    RemoteConfig               `yaml:"remote_config"`
+	Commands        CommandsConfig             `yaml:"commands"`
+	Interval        time.Duration              `yaml:"interval"`         // 全局采集周期
+	Timeout         time.Duration              `yaml:"collect_timeout"`  // 单个采集器的默认超时时间
+	ShutdownTimeout time.Duration              `yaml:"shutdown_timeout"` // 停止或重新加载配置时等待当前采集周期完成的时间
+	Collectors      map[string]CollectorConfig `yaml:"collectors"`
+	Process         ProcessConfig              `yaml:"process"`
+	Checks          []CheckConfig              `yaml:"checks"`
+	Probes          []ProbeConfig              `yaml:"probes"`
+	LogWatch        LogWatchConfig             `yaml:"logwatch"`
+	Watchlist       []WatchConfig              `yaml:"watchlist"`
+	FIM             FIMConfig                  `yaml:"fim"`
+	Logins          LoginsConfig               `yaml:"logins"`
+	TLS             TLSConfig                  `yaml:"tls"`
+	Spool           SpoolConfig                `yaml:"spool"`
+	Log             LogConfig                  `yaml:"log"`
+
+	// RemoteETag 已合并的下发配置的版本，随心跳上报，不参与配置摘要的计算
+	RemoteETag string `yaml:"-"`
+}
+
+// Default 返回默认配置
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			URLs:    []string{"http://192.168.51.28:8080/agent/addSystemInfo"},
+			Timeout: 10 * time.Second,
+		},
+		Heartbeat:       HeartbeatConfig{Interval: 15 * time.Second},
+		Metrics:         MetricsConfig{Path: "/metrics"},
+		Update:          UpdateConfig{DownloadTimeout: 5 * time.Minute},
+		RemoteConfig:    RemoteConfig{Enabled: true, CacheFile: "/var/lib/agentmonitor/remote-config.yaml"},
+		Commands:        CommandsConfig{MaxConcurrent: 4, MaxOutput: 64 << 10},
+		Interval:        time.Minute,
+		Timeout:         30 * time.Second,
+		ShutdownTimeout: 20 * time.Second,
+		Collectors:      map[string]CollectorConfig{},
+		Process:         ProcessConfig{TopCPU: 20, TopMem: 20},
+		FIM:             FIMConfig{MaxHashSize: 100 << 20, MaxFiles: 10000, BaselineFile: "/var/lib/agentmonitor/fim-baseline.json"},
+		Spool: SpoolConfig{
+			Dir:       "/var/lib/agentmonitor/spool",
+			MaxBytes:  100 << 20,
+			MaxFiles:  10000,
+			MaxAge:    24 * time.Hour,
+			RetryBase: 5 * time.Second,
+			RetryMax:  5 * time.Minute,
+		},
+		Log: LogConfig{Level: "info"},
+	}
+}
+
+// Load 依次应用默认配置、配置文件与环境变量，path 为空时不读取配置文件
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		yamlFile, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取配置文件失败: %v", err)
+		}
+		if err := yaml.UnmarshalStrict(yamlFile, cfg); err != nil {
+			return nil, fmt.Errorf("解析配置文件 %s 失败: %v", path, err)
+		}
+		if cfg.Collectors == nil {
+			cfg.Collectors = map[string]CollectorConfig{}
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ApplyRemote 将服务器下发的配置合并到当前配置之上，映射按键合并，列表与其他值整体替换
+// 未启用下发配置时不做任何修改；下发的配置不能包含 RemoteForbidden 中的字段
+func (c *Config) ApplyRemote(content []byte, etag string) error {
+	if !c.RemoteConfigEnabled() {
+		return nil
+	}
+	c.RemoteETag = etag
+	if len(content) == 0 {
+		return nil
+	}
+
+	var keys map[string]interface{}
+	if err := yaml.Unmarshal(content, &keys); err != nil {
+		return fmt.Errorf("解析下发的配置失败: %v", err)
+	}
+	for _, key := range RemoteForbidden {
+		if hasKey(keys, key) {
+			return fmt.Errorf("下发的配置不能包含 %s", key)
+		}
+	}
+	if err := yaml.UnmarshalStrict(content, c); err != nil {
+		return fmt.Errorf("解析下发的配置失败: %v", err)
+	}
+	if c.Collectors == nil {
+		c.Collectors = map[string]CollectorConfig{}
+	}
+	return nil
+}
+
+// hasKey 判断映射中是否包含以 . 分隔的嵌套字段
+func hasKey(m map[string]interface{}, key string) bool {
+	first, rest, nested := strings.Cut(key, ".")
+	v, ok := m[first]
+	if !ok || !nested {
+		return ok
+	}
+	sub, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return false
+	}
+	sm := make(map[string]interface{}, len(sub))
+	for k, v := range sub {
+		sm[fmt.Sprint(k)] = v
+	}
+	return hasKey(sm, rest)
+}
+
+// applyEnv 使用 AGENT_ 开头的环境变量覆盖配置
+func (c *Config) applyEnv() error {
+	var errs []error
+
+	if v, ok := os.LookupEnv("AGENT_HOST_NAME"); ok {
+		c.HostName = v
+	}
+	if v, ok := os.LookupEnv("AGENT_TOKEN"); ok {
+		c.Token = v
+	}
+	if v, ok := os.LookupEnv("AGENT_SERVER_URLS"); ok {
+		c.Server.URLs = nil
+		for _, u := range strings.Split(v, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				c.Server.URLs = append(c.Server.URLs, u)
+			}
+		}
+	}
+	if v, ok := os.LookupEnv("AGENT_METRICS_LISTEN"); ok {
+		c.Metrics.Listen = v
+	}
+	if v, ok := os.LookupEnv("AGENT_INTERVAL"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("环境变量 AGENT_INTERVAL 格式错误: %v", err))
+		}
+		c.Interval = d
+	}
+	if v, ok := os.LookupEnv("AGENT_PROCESS_TOP_CPU"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("环境变量 AGENT_PROCESS_TOP_CPU 格式错误: %v", err))
+		}
+		c.Process.TopCPU = n
+	}
+	if v, ok := os.LookupEnv("AGENT_PROCESS_TOP_MEM"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("环境变量 AGENT_PROCESS_TOP_MEM 格式错误: %v", err))
+		}
+		c.Process.TopMem = n
+	}
+	if v, ok := os.LookupEnv("AGENT_LOG_LEVEL"); ok {
+		c.Log.Level = v
+	}
+	if v, ok := os.LookupEnv("AGENT_LOG_FILE"); ok {
+		c.Log.File = v
+	}
+	if v, ok := os.LookupEnv("AGENT_SPOOL_DIR"); ok {
+		c.Spool.Dir = v
+	}
+	if v, ok := os.LookupEnv("AGENT_TLS_CA_FILE"); ok {
+		c.TLS.CAFile = v
+	}
+	if v, ok := os.LookupEnv("AGENT_TLS_CERT_FILE"); ok {
+		c.TLS.CertFile = v
+	}
+	if v, ok := os.LookupEnv("AGENT_TLS_KEY_FILE"); ok {
+		c.TLS.KeyFile = v
+	}
+	if v, ok := os.LookupEnv("AGENT_TLS_PIN_SHA256"); ok {
+		c.TLS.PinSHA256 = nil
+		for _, pin := range strings.Split(v, ",") {
+			if pin = strings.TrimSpace(pin); pin != "" {
+				c.TLS.PinSHA256 = append(c.TLS.PinSHA256, pin)
+			}
+		}
+	}
+	if v, ok := os.LookupEnv("AGENT_TLS_INSECURE_SKIP_VERIFY"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("环境变量 AGENT_TLS_INSECURE_SKIP_VERIFY 格式错误: %v", err))
+		}
+		c.TLS.InsecureSkipVerify = b
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate 校验配置，返回所有发现的问题
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Server.Disabled {
+		if c.Metrics.Listen == "" {
+			errs = append(errs, errors.New("server.disabled: 不推送数据时必须配置 metrics.listen"))
+		}
+	} else {
+		if len(c.Server.URLs) == 0 {
+			errs = append(errs, errors.New("server.urls: 至少需要配置一个服务器地址"))
+		}
+		// 发送到服务器的请求都需要用 token 签名
+		if c.Token == "" {
+			errs = append(errs, errors.New("token: 推送数据时必须配置安装 agent 时服务器分配的 token"))
+		}
+	}
+	for _, u := range c.Server.URLs {
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			errs = append(errs, fmt.Errorf("server.urls: 无效的地址 %q，需要 http:// 或 https:// 开头", u))
+		}
+	}
+	if c.Server.Timeout <= 0 {
+		errs = append(errs, errors.New("server.timeout: 必须大于 0"))
+	}
+	if c.Heartbeat.Interval != 0 && c.Heartbeat.Interval < time.Second {
+		errs = append(errs, fmt.Errorf("heartbeat.interval: 心跳周期 %v 过短，至少为 1s", c.Heartbeat.Interval))
+	}
+	for _, u := range c.Heartbeat.URLs {
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			errs = append(errs, fmt.Errorf("heartbeat.urls: 无效的地址 %q，需要 http:// 或 https:// 开头", u))
+		}
+	}
+	for _, u := range c.RemoteConfig.URLs {
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			errs = append(errs, fmt.Errorf("remote_config.urls: 无效的地址 %q，需要 http:// 或 https:// 开头", u))
+		}
+	}
+	if c.Commands.Enabled && c.Server.Disabled {
+		errs = append(errs, errors.New("commands.enabled: 远程命令需要连接服务器"))
+	}
+	for _, u := range c.Commands.URLs {
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			errs = append(errs, fmt.Errorf("commands.urls: 无效的地址 %q，需要 http:// 或 https:// 开头", u))
+		}
+	}
+	if c.Commands.MaxConcurrent <= 0 || c.Commands.MaxOutput <= 0 {
+		errs = append(errs, errors.New("commands: max_concurrent 与 max_output 必须大于 0"))
+	}
+	seen := map[string]bool{}
+	for i, cc := range c.Commands.Allow {
+		key := fmt.Sprintf("commands.allow[%d]", i)
+		if !commandNamePattern.MatchString(cc.Name) {
+			errs = append(errs, fmt.Errorf("%s.name: %q 无效，只能包含字母、数字、点、下划线与短横线", key, cc.Name))
+		} else if seen[cc.Name] {
+			errs = append(errs, fmt.Errorf("%s.name: 命令 %s 重复", key, cc.Name))
+		}
+		seen[cc.Name] = true
+		if strings.TrimSpace(cc.Command) == "" {
+			errs = append(errs, fmt.Errorf("%s.command: 不能为空", key))
+		}
+		if cc.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("%s.timeout: 不能为负数", key))
+		}
+	}
+	if c.Metrics.Listen != "" {
+		if _, _, err := net.SplitHostPort(c.Metrics.Listen); err != nil {
+			errs = append(errs, fmt.Errorf("metrics.listen: 需要 host:port 格式: %v", err))
+		}
+		if !strings.HasPrefix(c.Metrics.Path, "/") {
+			errs = append(errs, fmt.Errorf("metrics.path: %q 必须以 / 开头", c.Metrics.Path))
+		}
+	}
+	if c.Update.Enabled {
+		// 目标版本通过心跳响应下发
+		if c.Server.Disabled || c.Heartbeat.Interval == 0 {
+			errs = append(errs, errors.New("update.enabled: 自动升级需要向服务器发送心跳"))
+		}
+		if _, err := update.ParsePublicKey(c.Update.PublicKey); err != nil {
+			errs = append(errs, fmt.Errorf("update.public_key: %v", err))
+		}
+		if c.Update.DownloadTimeout <= 0 {
+			errs = append(errs, errors.New("update.download_timeout: 必须大于 0"))
+		}
+	}
+	if c.Interval < time.Second {
+		errs = append(errs, fmt.Errorf("interval: 采集周期 %v 过短，至少为 1s", c.Interval))
+	}
+	if c.Timeout <= 0 {
+		errs = append(errs, errors.New("collect_timeout: 必须大于 0"))
+	}
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("shutdown_timeout: 必须大于 0"))
+	}
+
+	names := make([]string, 0, len(c.Collectors))
+	for name := range c.Collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cc := c.Collectors[name]
+		if !isCollector(name) {
+			errs = append(errs, fmt.Errorf("collectors.%s: 未知的采集器，可选值: %s", name, strings.Join(Collectors, ", ")))
+			continue
+		}
+		if cc.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("collectors.%s.timeout: 不能为负数", name))
+		}
+		if cc.Interval != 0 && cc.Interval < c.Interval {
+			errs = append(errs, fmt.Errorf("collectors.%s.interval: %v 不能小于全局采集周期 %v", name, cc.Interval, c.Interval))
+		}
+	}
+	if !c.CollectorEnabled("host") {
+		errs = append(errs, errors.New("collectors.host: 主机信息用于标识本机，不能禁用"))
+	}
+
+	if c.Process.TopCPU < 0 || c.Process.TopMem < 0 {
+		errs = append(errs, errors.New("process: top_cpu 与 top_mem 不能为负数"))
+	}
+
+	seen = map[string]bool{}
+	for i, ch := range c.Checks {
+		key := fmt.Sprintf("checks[%d]", i)
+		if ch.Name == "" {
+			errs = append(errs, fmt.Errorf("%s.name: 不能为空", key))
+		} else if seen[ch.Name] {
+			errs = append(errs, fmt.Errorf("%s.name: 检查 %s 重复", key, ch.Name))
+		}
+		seen[ch.Name] = true
+		if strings.TrimSpace(ch.Command) == "" {
+			errs = append(errs, fmt.Errorf("%s.command: 不能为空", key))
+		}
+		if ch.Interval != 0 && ch.Interval < c.CollectorInterval("checks") {
+			errs = append(errs, fmt.Errorf("%s.interval: %v 不能小于 checks 采集器的周期 %v", key, ch.Interval, c.CollectorInterval("checks")))
+		}
+		if ch.Timeout < 0 || ch.MaxOutput < 0 {
+			errs = append(errs, fmt.Errorf("%s: timeout 与 max_output 不能为负数", key))
+		}
+		if c.CheckTimeout(ch) >= c.CollectorTimeout("checks") {
+			errs = append(errs, fmt.Errorf("%s.timeout: %v 必须小于 checks 采集器的超时时间 %v", key, c.CheckTimeout(ch), c.CollectorTimeout("checks")))
+		}
+	}
+
+	seen = map[string]bool{}
+	for i, pr := range c.Probes {
+		key := fmt.Sprintf("probes[%d]", i)
+		if pr.Name == "" {
+			errs = append(errs, fmt.Errorf("%s.name: 不能为空", key))
+		} else if seen[pr.Name] {
+			errs = append(errs, fmt.Errorf("%s.name: 拨测 %s 重复", key, pr.Name))
+		}
+		seen[pr.Name] = true
+		switch pr.Type {
+		case "http":
+			parsed, err := url.Parse(pr.Target)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				errs = append(errs, fmt.Errorf("%s.target: 无效的地址 %q，需要 http:// 或 https:// 开头", key, pr.Target))
+			}
+			if _, err := regexp.Compile(pr.BodyRegex); err != nil {
+				errs = append(errs, fmt.Errorf("%s.body_regex: %v", key, err))
+			}
+		case "tcp":
+			if _, _, err := net.SplitHostPort(pr.Target); err != nil {
+				errs = append(errs, fmt.Errorf("%s.target: 需要 host:port 格式: %v", key, err))
+			}
+		case "dns":
+			if pr.Target == "" {
+				errs = append(errs, fmt.Errorf("%s.target: 不能为空", key))
+			}
+			switch strings.ToUpper(pr.RecordType) {
+			case "", "A", "AAAA", "CNAME", "MX", "TXT", "NS":
+			default:
+				errs = append(errs, fmt.Errorf("%s.record_type: 不支持的记录类型 %s", key, pr.RecordType))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("%s.type: 未知的拨测类型 %q，可选值: http、tcp、dns", key, pr.Type))
+		}
+		if pr.Interval != 0 && pr.Interval < c.CollectorInterval("probes") {
+			errs = append(errs, fmt.Errorf("%s.interval: %v 不能小于 probes 采集器的周期 %v", key, pr.Interval, c.CollectorInterval("probes")))
+		}
+		if pr.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("%s.timeout: 不能为负数", key))
+		}
+		if c.ProbeTimeout(pr) >= c.CollectorTimeout("probes") {
+			errs = append(errs, fmt.Errorf("%s.timeout: %v 必须小于 probes 采集器的超时时间 %v", key, c.ProbeTimeout(pr), c.CollectorTimeout("probes")))
+		}
+	}
+
+	seen = map[string]bool{}
+	for i, wc := range c.Watchlist {
+		key := fmt.Sprintf("watchlist[%d]", i)
+		if wc.Name == "" {
+			errs = append(errs, fmt.Errorf("%s.name: 不能为空", key))
+		} else if seen[wc.Name] {
+			errs = append(errs, fmt.Errorf("%s.name: 监视项 %s 重复", key, wc.Name))
+		}
+		seen[wc.Name] = true
+		matchers := 0
+		for _, m := range []string{wc.ProcessName, wc.Cmdline, wc.PidFile} {
+			if m != "" {
+				matchers++
+			}
+		}
+		if matchers != 1 {
+			errs = append(errs, fmt.Errorf("%s: process_name、cmdline、pidfile 必须且只能配置一种", key))
+		}
+		if wc.Cmdline != "" {
+			if _, err := regexp.Compile(wc.Cmdline); err != nil {
+				errs = append(errs, fmt.Errorf("%s.cmdline: %v", key, err))
+			}
+		}
+		if wc.MinInstances < 0 {
+			errs = append(errs, fmt.Errorf("%s.min_instances: 不能为负数", key))
+		}
+	}
+
+	if c.LogWatch.MaxEvents < 0 {
+		errs = append(errs, errors.New("logwatch.max_events: 不能为负数"))
+	}
+	for i, f := range c.LogWatch.Files {
+		key := fmt.Sprintf("logwatch.files[%d]", i)
+		if f.Path == "" {
+			errs = append(errs, fmt.Errorf("%s.path: 不能为空", key))
+		}
+		if len(f.Rules) == 0 {
+			errs = append(errs, fmt.Errorf("%s.rules: 至少需要一条规则", key))
+		}
+		seen = map[string]bool{}
+		for j, r := range f.Rules {
+			rkey := fmt.Sprintf("%s.rules[%d]", key, j)
+			if r.Name == "" {
+				errs = append(errs, fmt.Errorf("%s.name: 不能为空", rkey))
+			} else if seen[r.Name] {
+				errs = append(errs, fmt.Errorf("%s.name: 规则 %s 重复", rkey, r.Name))
+			}
+			seen[r.Name] = true
+			if r.Pattern == "" {
+				errs = append(errs, fmt.Errorf("%s.pattern: 不能为空", rkey))
+			} else if _, err := regexp.Compile(r.Pattern); err != nil {
+				errs = append(errs, fmt.Errorf("%s.pattern: %v", rkey, err))
+			}
+			if r.Severity != "" && !contains(Severities, r.Severity) {
+				errs = append(errs, fmt.Errorf("%s.severity: 未知的级别 %q，可选值: %s", rkey, r.Severity, strings.Join(Severities, ", ")))
+			}
+			if r.RateLimit < 0 || r.RateWindow < 0 {
+				errs = append(errs, fmt.Errorf("%s: rate_limit 与 rate_window 不能为负数", rkey))
+			}
+		}
+	}
+
+	for i, p := range c.FIM.Paths {
+		key := fmt.Sprintf("fim.paths[%d]", i)
+		if !filepath.IsAbs(p) {
+			errs = append(errs, fmt.Errorf("%s: %q 必须是绝对路径", key, p))
+		} else if _, err := filepath.Match(p, ""); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", key, err))
+		}
+	}
+	for i, p := range c.FIM.Exclude {
+		if _, err := filepath.Match(p, ""); err != nil {
+			errs = append(errs, fmt.Errorf("fim.exclude[%d]: %v", i, err))
+		}
+	}
+	if c.FIM.MaxHashSize <= 0 || c.FIM.MaxFiles <= 0 {
+		errs = append(errs, errors.New("fim: max_hash_size 与 max_files 必须大于 0"))
+	}
+
+	for i, p := range c.Logins.AuthLogs {
+		if !filepath.IsAbs(p) {
+			errs = append(errs, fmt.Errorf("logins.auth_logs[%d]: %q 必须是绝对路径", i, p))
+		}
+	}
+	if c.Logins.MaxEvents < 0 {
+		errs = append(errs, errors.New("logins.max_events: 不能为负数"))
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("tls: cert_file 与 key_file 必须同时配置"))
+	}
+	for _, pin := range c.TLS.PinSHA256 {
+		if sum, err := base64.StdEncoding.DecodeString(pin); err != nil || len(sum) != sha256.Size {
+			errs = append(errs, fmt.Errorf("tls.pin_sha256: %q 不是 base64 编码的 SHA-256", pin))
+		}
+	}
+	// 证书与公钥固定只对 https 地址生效，配置了却使用 http 说明配置有误
+	if c.TLS.CertFile != "" || len(c.TLS.PinSHA256) > 0 {
+		for _, u := range append(append(append(append([]string{}, c.Server.URLs...), c.Heartbeat.URLs...), c.RemoteConfig.URLs...), c.Commands.URLs...) {
+			if strings.HasPrefix(u, "http://") {
+				errs = append(errs, fmt.Errorf("tls: 配置了客户端证书或公钥固定，但 %q 不是 https 地址", u))
+			}
+		}
+	}
+	for _, f := range []struct{ key, file string }{
+		{"tls.ca_file", c.TLS.CAFile},
+		{"tls.cert_file", c.TLS.CertFile},
+		{"tls.key_file", c.TLS.KeyFile},
+	} {
+		if f.file == "" {
+			continue
+		}
+		if _, err := os.Stat(f.file); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", f.key, err))
+		}
+	}
+
+	if c.Spool.MaxBytes < 0 || c.Spool.MaxFiles < 0 || c.Spool.MaxAge < 0 {
+		errs = append(errs, errors.New("spool: max_bytes、max_files、max_age 不能为负数"))
+	}
+	if c.Spool.Dir != "" && (c.Spool.RetryBase <= 0 || c.Spool.RetryMax < c.Spool.RetryBase) {
+		errs = append(errs, errors.New("spool: retry_base 必须大于 0，且 retry_max 不能小于 retry_base"))
+	}
+
+	if _, err := logger.ParseLevel(c.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("log.level: %v", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// CollectorEnabled 采集器是否启用，未配置时默认启用
+func (c *Config) CollectorEnabled(name string) bool {
+	cc, ok := c.Collectors[name]
+	if !ok || cc.Enabled == nil {
+		return true
+	}
+	return *cc.Enabled
+}
+
+// CollectorInterval 采集器的采集周期，未配置时跟随全局采集周期
+func (c *Config) CollectorInterval(name string) time.Duration {
+	if cc, ok := c.Collectors[name]; ok && cc.Interval > 0 {
+		return cc.Interval
+	}
+	return c.Interval
+}
+
+// CollectorTimeout 采集器单次采集的超时时间，未配置时使用 collect_timeout
+func (c *Config) CollectorTimeout(name string) time.Duration {
+	if cc, ok := c.Collectors[name]; ok && cc.Timeout > 0 {
+		return cc.Timeout
+	}
+	return c.Timeout
+}
+
+// AgentHostName 上报时使用的主机名，未配置时使用系统主机名
+func (c *Config) AgentHostName() string {
+	if c.HostName != "" {
+		return c.HostName
+	}
+	name, _ := os.Hostname()
+	return name
+}
+
+// HeartbeatURLs 心跳地址，未配置时与 server.urls 使用相同的服务器
+func (c *Config) HeartbeatURLs() []string {
+	if len(c.Heartbeat.URLs) > 0 {
+		return c.Heartbeat.URLs
+	}
+	return serverURLs(c.Server.URLs, "/agent/heartbeat")
+}
+
+// serverURLs 将各服务器地址的路径替换为 path
+func serverURLs(servers []string, path string) []string {
+	urls := make([]string, 0, len(servers))
+	for _, u := range servers {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			continue
+		}
+		urls = append(urls, (&url.URL{Scheme: parsed.Scheme, Host: parsed.Host, Path: path}).String())
+	}
+	return urls
+}
+
+// RemoteConfigEnabled 是否从服务器获取下发的配置，不推送数据时不获取
+func (c *Config) RemoteConfigEnabled() bool {
+	return c.RemoteConfig.Enabled && !c.Server.Disabled
+}
+
+// RemoteConfigURLs 获取下发配置的地址，未配置时与 server.urls 使用相同的服务器
+func (c *Config) RemoteConfigURLs() []string {
+	if len(c.RemoteConfig.URLs) > 0 {
+		return c.RemoteConfig.URLs
+	}
+	return serverURLs(c.Server.URLs, "/agent/config")
+}
+
+// CommandURLs 远程命令接口的地址，未配置时与 server.urls 使用相同的服务器
+func (c *Config) CommandURLs() []string {
+	if len(c.Commands.URLs) > 0 {
+		return c.Commands.URLs
+	}
+	return serverURLs(c.Server.URLs, "/agent/commands")
+}
+
+// Hash 生效配置的 SHA-256，用于在服务器上确认各主机加载的配置，token 不参与计算
+func (c *Config) Hash() string {
+	cp := *c
+	cp.Token = ""
+	out, err := yaml.Marshal(&cp)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(out)
+	return hex.EncodeToString(sum[:])
+}
+
+// Equal 判断两份生效配置是否相同，重新加载时相同则跳过
+// Hash 不包含 token，这里另外比较 token 的摘要，只修改 token 时也会重新加载
+func (c *Config) Equal(o *Config) bool {
+	return c.Hash() == o.Hash() && c.RemoteETag == o.RemoteETag &&
+		sha256.Sum256([]byte(c.Token)) == sha256.Sum256([]byte(o.Token))
+}
+
+// CheckTimeout 检查脚本的超时时间
+func (c *Config) CheckTimeout(ch CheckConfig) time.Duration {
+	if ch.Timeout > 0 {
+		return ch.Timeout
+	}
+	return 10 * time.Second
+}
+
+// CommandTimeout 远程命令的超时时间
+func (c *Config) CommandTimeout(cc CommandConfig) time.Duration {
+	if cc.Timeout > 0 {
+		return cc.Timeout
+	}
+	return time.Minute
+}
+
+// ProbeTimeout 拨测的超时时间
+func (c *Config) ProbeTimeout(pr ProbeConfig) time.Duration {
+	if pr.Timeout > 0 {
+		return pr.Timeout
+	}
+	return 10 * time.Second
+}
+
+func isCollector(name string) bool {
+	return contains(Collectors, name)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
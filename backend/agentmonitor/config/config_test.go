@@ -0,0 +1,59 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyRemoteRejectsForbiddenKeys(t *testing.T) {
+	cases := map[string]string{
+		"logwatch.files":    "logwatch:\n  files:\n    - path: /etc/shadow\n",
+		"fim.paths":         "fim:\n  paths:\n    - /root\n",
+		"fim.baseline_file": "fim:\n  baseline_file: /etc/cron.d/x\n",
+		"logins.auth_logs":  "logins:\n  auth_logs:\n    - /etc/shadow\n",
+		"spool.dir":         "spool:\n  dir: /etc\n",
+		"log.file":          "log:\n  file: /etc/profile\n",
+		"token":             "token: other\n",
+		"metrics.listen":    "metrics:\n  listen: :9101\n",
+	}
+	for key, content := range cases {
+		cfg := Default()
+		err := cfg.ApplyRemote([]byte(content), "etag")
+		if err == nil {
+			t.Errorf("%s: 下发的配置应被拒绝", key)
+			continue
+		}
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("%s: 错误信息 %q 没有指出字段", key, err)
+		}
+	}
+}
+
+func TestApplyRemoteAllowsSiblingKeys(t *testing.T) {
+	cfg := Default()
+	content := "logwatch:\n  max_events: 100\nfim:\n  max_files: 50\nspool:\n  max_files: 10\nlog:\n  level: debug\n"
+	if err := cfg.ApplyRemote([]byte(content), "etag"); err != nil {
+		t.Fatalf("ApplyRemote: %v", err)
+	}
+	if cfg.LogWatch.MaxEvents != 100 || cfg.FIM.MaxFiles != 50 || cfg.Spool.MaxFiles != 10 || cfg.Log.Level != "debug" {
+		t.Errorf("下发的配置没有生效: %+v", cfg)
+	}
+	if cfg.Spool.Dir != Default().Spool.Dir {
+		t.Errorf("spool.dir 被修改为 %q", cfg.Spool.Dir)
+	}
+}
+
+func TestEqualDetectsTokenChange(t *testing.T) {
+	a, b := Default(), Default()
+	a.Token, b.Token = "token-a", "token-a"
+	if !a.Equal(b) {
+		t.Fatal("相同的配置应相等")
+	}
+	b.Token = "token-b"
+	if a.Hash() != b.Hash() {
+		t.Fatal("Hash 不应包含 token")
+	}
+	if a.Equal(b) {
+		t.Error("只修改 token 时应视为配置变化")
+	}
+}
@@ -0,0 +1,56 @@
+package data
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ServerCheck 对一个服务器地址的检查结果
+type ServerCheck struct {
+	URL     string
+	Latency time.Duration
+	Err     error // 无法连接服务器时不为空，其余字段无效
+
+	StatusCode int
+	Message    string               // 服务器响应中的 error 字段，如签名校验失败的原因
+	TLS        *tls.ConnectionState // 使用 HTTP 时为 nil
+
+	// ClockSkew 本机时间减去服务器时间，由响应的 Date 计算，精度约 1 秒；服务器未返回 Date 时 HasClock 为 false
+	ClockSkew time.Duration
+	HasClock  bool
+}
+
+// CheckServer 向 url 发送一个签名的 GET 请求，检查连接、认证与时钟偏差
+// url 应为只读的签名接口，如获取下发配置的 /agent/config
+func CheckServer(ctx context.Context, client *http.Client, url string) ServerCheck {
+	check := ServerCheck{URL: url}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		check.Err = fmt.Errorf("创建请求失败: %v", err)
+		return check
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	check.Latency = time.Since(start)
+	if err != nil {
+		check.Err = err
+		return check
+	}
+	defer resp.Body.Close()
+
+	check.StatusCode = resp.StatusCode
+	check.TLS = resp.TLS
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotModified {
+		check.Message = newStatusError(resp).Message
+	}
+	// Date 只精确到秒，取该秒的中间与请求的中间时刻比较
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		local := start.Add(check.Latency / 2)
+		check.ClockSkew = local.Sub(date.Add(500 * time.Millisecond))
+		check.HasClock = true
+	}
+	return check
+}
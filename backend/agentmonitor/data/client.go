@@ -0,0 +1,116 @@
+package data
+
+import (
+	"bytes"
+	"cmd/agentmonitor/config"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// NewHTTPClient 根据配置创建与服务器通信的 HTTP 客户端
+func NewHTTPClient(cfg *config.Config) (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.TLS.ServerName,
+		InsecureSkipVerify: cfg.TLS.InsecureSkipVerify,
+	}
+
+	if cfg.TLS.CAFile != "" {
+		caPEM, err := os.ReadFile(cfg.TLS.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取 CA 证书失败: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("CA 证书 %s 中没有有效的 PEM 证书", cfg.TLS.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.TLS.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载客户端证书失败: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	// 公钥固定：证书链中至少一个证书的公钥在固定列表中，在常规的证书校验之后进行
+	if len(cfg.TLS.PinSHA256) > 0 {
+		pins := map[string]bool{}
+		for _, pin := range cfg.TLS.PinSHA256 {
+			pins[pin] = true
+		}
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			for _, cert := range cs.PeerCertificates {
+				sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+				if pins[base64.StdEncoding.EncodeToString(sum[:])] {
+					return nil
+				}
+			}
+			return errors.New("服务器证书的公钥不在 tls.pin_sha256 中")
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	var rt http.RoundTripper = transport
+	if cfg.Token != "" {
+		rt = &signingTransport{base: transport, hostName: cfg.AgentHostName(), token: []byte(cfg.Token)}
+	}
+	return &http.Client{
+		Transport: rt,
+		Timeout:   cfg.Server.Timeout,
+	}, nil
+}
+
+// signingTransport 使用主机 token 对每个请求做 HMAC-SHA256 签名，token 本身不随请求发送
+// 签名内容为方法、路径（含查询参数）、时间戳、nonce 与请求体的 SHA-256，以换行分隔
+type signingTransport struct {
+	base     http.RoundTripper
+	hostName string
+	token    []byte
+}
+
+func (t *signingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("读取请求体失败: %v", err)
+		}
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("生成 nonce 失败: %v", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonceHex := hex.EncodeToString(nonce)
+	sum := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, t.token)
+	mac.Write([]byte(req.Method + "\n" + req.URL.RequestURI() + "\n" + timestamp + "\n" + nonceHex + "\n" + hex.EncodeToString(sum[:])))
+
+	// RoundTripper 不能修改传入的请求
+	signed := req.Clone(req.Context())
+	signed.Body = io.NopCloser(bytes.NewReader(body))
+	signed.Header.Set("X-Agent-Host", t.hostName)
+	signed.Header.Set("X-Agent-Timestamp", timestamp)
+	signed.Header.Set("X-Agent-Nonce", nonceHex)
+	signed.Header.Set("X-Agent-Signature", hex.EncodeToString(mac.Sum(nil)))
+	return t.base.RoundTrip(signed)
+}
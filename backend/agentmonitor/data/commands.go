@@ -0,0 +1,324 @@
+package data
+
+import (
+	"cmd/agentmonitor/command"
+	"cmd/agentmonitor/config"
+	"cmd/agentmonitor/logger"
+	"cmd/agentmonitor/spool"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// commandPollWait 服务器在没有待执行命令时保持长轮询的时间
+	commandPollWait = 30 * time.Second
+	// outputFlushInterval 命令输出回传的间隔，输出较多时提前回传
+	outputFlushInterval = time.Second
+	outputFlushBytes    = 32 << 10
+	// resultTimeout 命令结束后回传剩余输出与结果的时间，agent 停止时也会等待
+	resultTimeout = 10 * time.Second
+)
+
+// Job 服务器下发的一条命令
+type Job struct {
+	ID      int64    `json:"id"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+}
+
+// OutputChunk 回传的一段输出
+type OutputChunk struct {
+	Seq    int    `json:"seq"`
+	Stream string `json:"stream"`
+	Data   string `json:"data"`
+}
+
+// Commander 向服务器长轮询远程命令，执行允许列表中的命令并分段回传输出
+type Commander struct {
+	client        *http.Client
+	pollClient    *http.Client // 超时时间包含服务器的等待时间
+	urls          []string
+	allow         map[string]config.CommandConfig
+	cfg           *config.Config
+	maxConcurrent int
+	timeout       time.Duration // 允许列表中最长的超时时间，服务器据此判断执行中的命令是否因 agent 异常退出而丢失
+
+	failing bool // 上一次轮询是否失败，避免服务器不可达时刷屏
+}
+
+// NewCommander 创建远程命令执行器
+func NewCommander(client *http.Client, cfg *config.Config) *Commander {
+	pollClient := *client
+	pollClient.Timeout = client.Timeout + commandPollWait
+	allow := map[string]config.CommandConfig{}
+	var timeout time.Duration
+	for _, cc := range cfg.Commands.Allow {
+		allow[cc.Name] = cc
+		timeout = max(timeout, cfg.CommandTimeout(cc))
+	}
+	return &Commander{
+		client:        client,
+		pollClient:    &pollClient,
+		urls:          cfg.CommandURLs(),
+		allow:         allow,
+		cfg:           cfg,
+		maxConcurrent: cfg.Commands.MaxConcurrent,
+		timeout:       timeout,
+	}
+}
+
+// Run 轮询并执行命令，直到 ctx 被取消；返回前等待执行中的命令结束并回传结果
+func (c *Commander) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	backoff := spool.Backoff{Base: time.Second, Max: time.Minute}
+	finished := make(chan struct{}, c.maxConcurrent)
+	running := 0
+	for {
+		for drained := false; !drained; {
+			select {
+			case <-finished:
+				running--
+			default:
+				drained = true
+			}
+		}
+		// 执行中的命令达到上限时，等待其中一条结束后再领取
+		if running >= c.maxConcurrent {
+			select {
+			case <-ctx.Done():
+				return
+			case <-finished:
+				running--
+			}
+			continue
+		}
+
+		jobs, err := c.poll(ctx, c.maxConcurrent-running)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			if !c.failing {
+				logger.Warnf("领取远程命令失败: %v", err)
+			}
+			c.failing = true
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff.Next()):
+			}
+			continue
+		}
+		if c.failing {
+			logger.Infof("远程命令通道恢复")
+			c.failing = false
+		}
+		backoff.Reset()
+
+		for _, job := range jobs {
+			running++
+			wg.Add(1)
+			go func(job Job) {
+				defer wg.Done()
+				c.execute(ctx, job)
+				finished <- struct{}{}
+			}(job)
+		}
+	}
+}
+
+// poll 依次尝试各服务器地址领取最多 max 条命令，没有命令时服务器最多等待 commandPollWait
+func (c *Commander) poll(ctx context.Context, max int) ([]Job, error) {
+	var errs []error
+	for _, base := range c.urls {
+		u := fmt.Sprintf("%s/poll?max=%d&wait=%s", strings.TrimSuffix(base, "/"), max, url.QueryEscape(commandPollWait.String()))
+		if c.timeout > 0 {
+			u += "&timeout=" + url.QueryEscape(c.timeout.String())
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, fmt.Errorf("创建请求失败: %v", err)
+		}
+		resp, err := c.pollClient.Do(req)
+		if err != nil {
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		var result struct {
+			Commands []Job `json:"commands"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			err = newStatusError(resp)
+		} else {
+			err = json.NewDecoder(resp.Body).Decode(&result)
+		}
+		resp.Body.Close()
+		if err == nil {
+			return result.Commands, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// execute 执行一条命令并回传输出与结果，不在允许列表中的命令只回传拒绝的原因
+func (c *Commander) execute(ctx context.Context, job Job) {
+	r := &outputReporter{c: c, id: job.ID, full: make(chan struct{}, 1)}
+	cc, ok := c.allow[job.Command]
+	switch {
+	case !ok:
+		logger.Warnf("拒绝远程命令 #%d：%s 不在允许列表中", job.ID, job.Command)
+		r.finish(command.Result{ExitCode: -1, Error: fmt.Sprintf("命令 %s 不在允许列表中", job.Command)})
+		return
+	case len(job.Args) > 0 && !cc.AllowArgs:
+		logger.Warnf("拒绝远程命令 #%d：%s 不允许附带参数", job.ID, job.Command)
+		r.finish(command.Result{ExitCode: -1, Error: fmt.Sprintf("命令 %s 不允许附带参数", job.Command)})
+		return
+	}
+
+	logger.Infof("执行远程命令 #%d %s %q", job.ID, job.Command, job.Args)
+	done := make(chan struct{})
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		r.run(ctx, done)
+	}()
+	start := time.Now()
+	res := command.Run(ctx, command.Command{
+		Name:      cc.Name,
+		Command:   cc.Command,
+		Timeout:   c.cfg.CommandTimeout(cc),
+		MaxOutput: c.cfg.Commands.MaxOutput,
+	}, job.Args, r.add)
+	close(done)
+	<-flushed
+	logger.Infof("远程命令 #%d 执行结束，退出码 %d，耗时 %v", job.ID, res.ExitCode, time.Since(start).Round(time.Millisecond))
+	r.finish(res)
+}
+
+// outputReporter 缓存一条命令的输出，定期回传，回传失败的部分在下一次重试
+type outputReporter struct {
+	c  *Commander
+	id int64
+
+	mu      sync.Mutex
+	pending []OutputChunk
+	size    int
+	seq     int
+	sealed  int // seq 不大于该值的输出正在或已经回传过，不能再追加内容
+	full    chan struct{}
+}
+
+// add 追加一段输出，相邻的同一个流合并为一段
+func (r *outputReporter) add(stream string, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n := len(r.pending); n > 0 && r.pending[n-1].Seq > r.sealed && r.pending[n-1].Stream == stream && len(r.pending[n-1].Data) < outputFlushBytes {
+		r.pending[n-1].Data += string(data)
+	} else {
+		r.seq++
+		r.pending = append(r.pending, OutputChunk{Seq: r.seq, Stream: stream, Data: string(data)})
+	}
+	r.size += len(data)
+	if r.size >= outputFlushBytes {
+		select {
+		case r.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run 每隔 outputFlushInterval 或输出较多时回传，直到 done 关闭
+func (r *outputReporter) run(ctx context.Context, done <-chan struct{}) {
+	ticker := time.NewTicker(outputFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.full:
+		}
+		if err := r.flush(ctx, nil); err != nil {
+			logger.Debugf("回传远程命令 #%d 的输出失败，稍后重试: %v", r.id, err)
+		}
+	}
+}
+
+// finish 回传剩余的输出与结果，agent 停止时也会在 resultTimeout 内尝试
+func (r *outputReporter) finish(res command.Result) {
+	ctx, cancel := context.WithTimeout(context.Background(), resultTimeout)
+	defer cancel()
+	backoff := spool.Backoff{Base: time.Second, Max: 5 * time.Second}
+	for {
+		err := r.flush(ctx, &res)
+		if err == nil {
+			return
+		}
+		if !Retryable(err) {
+			logger.Errorf("回传远程命令 #%d 的结果失败: %v", r.id, err)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			logger.Errorf("回传远程命令 #%d 的结果失败: %v", r.id, err)
+			return
+		case <-time.After(backoff.Next()):
+		}
+	}
+}
+
+// flush 回传缓存的输出，result 不为 nil 时一并回传结果；失败时保留输出，重试时服务器按 seq 去重
+func (r *outputReporter) flush(ctx context.Context, result *command.Result) error {
+	r.mu.Lock()
+	chunks := append([]OutputChunk(nil), r.pending...)
+	if len(chunks) > 0 {
+		r.sealed = chunks[len(chunks)-1].Seq
+	}
+	r.mu.Unlock()
+	if len(chunks) == 0 && result == nil {
+		return nil
+	}
+
+	payload, err := json.Marshal(struct {
+		Output []OutputChunk   `json:"output"`
+		Result *command.Result `json:"result,omitempty"`
+	}{chunks, result})
+	if err != nil {
+		return fmt.Errorf("序列化命令输出失败: %v", err)
+	}
+	urls := make([]string, len(r.c.urls))
+	for i, base := range r.c.urls {
+		urls[i] = strings.TrimSuffix(base, "/") + "/" + strconv.FormatInt(r.id, 10) + "/output"
+	}
+	if _, err := PostPayload(ctx, r.c.client, urls, payload); err != nil {
+		return err
+	}
+
+	// 回传期间新增的输出保留在缓存中
+	r.mu.Lock()
+	if len(chunks) > 0 {
+		last := chunks[len(chunks)-1].Seq
+		for len(r.pending) > 0 && r.pending[0].Seq <= last {
+			r.size -= len(r.pending[0].Data)
+			r.pending = r.pending[1:]
+		}
+	}
+	r.mu.Unlock()
+	return nil
+}
@@ -2,85 +2,405 @@ package data
 
 import (
 	"bytes"
+	"cmd/agentmonitor/checks"
+	"cmd/agentmonitor/collector"
+	"cmd/agentmonitor/config"
+	"cmd/agentmonitor/fim"
+	"cmd/agentmonitor/logger"
+	"cmd/agentmonitor/logins"
+	"cmd/agentmonitor/logwatch"
 	"cmd/agentmonitor/monitor"
+	"cmd/agentmonitor/probe"
+	"cmd/agentmonitor/watchlist"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"regexp"
+	"time"
 )
 
 // 定义服务器的监控信息结构体
+// 各采集器的数据保存在 Sections 中，序列化时与 host_info 等字段平铺在同一层
 type MonitorData struct {
-	CPUInfo     []monitor.CPUInfo     `json:"cpu_info"`
-	HostInfo    monitor.HostInfo      `json:"host_info"`
-	MemInfo     monitor.MemoryInfo    `json:"mem_info"`
-	ProcessInfo []monitor.ProcessInfo `json:"pro_info"`
-	NetworkInfo []monitor.NetworkInfo `json:"net_info"`
+	HostInfo monitor.HostInfo `json:"host_info"`
+	// 采集时间，数据写入本地缓存后补发时服务器以此作为数据时间
+	CollectedAt time.Time `json:"collected_at"`
+	// 以字段名为 key 的各采集器数据，未启用或未到采集周期的采集器不出现
+	Sections map[string]interface{} `json:"-"`
+	// 以采集器名称为 key 的采集错误，出错的采集器对应字段为空
+	CollectorErrors map[string]string `json:"collector_errors,omitempty"`
 }
 
-// 收集监控数据
-func CollectMonitorData(hostname string, token string) (MonitorData, error) {
-	datas := MonitorData{}
+// MarshalJSON 将 Sections 平铺到顶层
+func (d MonitorData) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(d.Sections)+3)
+	for field, v := range d.Sections {
+		m[field] = v
+	}
+	m["host_info"] = d.HostInfo
+	m["collected_at"] = d.CollectedAt
+	if len(d.CollectorErrors) > 0 {
+		m["collector_errors"] = d.CollectorErrors
+	}
+	return json.Marshal(m)
+}
 
-	// 获取CPU使用率
-	cpudata, err := monitor.GetCpuInfo()
-	if err != nil {
-		fmt.Printf("获取CPU信息时出错: %v\n", err)
-		return datas, err
+// 内置采集器，field 为其数据在上报数据中的字段名
+var builtinCollectors = []struct {
+	name  string
+	field string
+	fn    func(ctx context.Context, cfg *config.Config) (interface{}, error)
+}{
+	{"cpu", "cpu_info", func(ctx context.Context, _ *config.Config) (interface{}, error) { return monitor.GetCpuInfo(ctx) }},
+	{"memory", "mem_info", func(ctx context.Context, _ *config.Config) (interface{}, error) { return monitor.GetMemInfo(ctx) }},
+	{"process", "pro_info", func(ctx context.Context, cfg *config.Config) (interface{}, error) {
+		return monitor.GetProcess(ctx, cfg.Process.TopCPU, cfg.Process.TopMem)
+	}},
+	{"network", "net_info", func(ctx context.Context, _ *config.Config) (interface{}, error) { return monitor.GetNetworkInfo(ctx) }},
+	{"disk", "disk_info", func(ctx context.Context, _ *config.Config) (interface{}, error) { return monitor.GetDiskInfo(ctx) }},
+	{"diskio", "diskio_info", func(ctx context.Context, _ *config.Config) (interface{}, error) { return monitor.GetDiskIOInfo(ctx) }},
+	{"conn", "conn_info", func(ctx context.Context, _ *config.Config) (interface{}, error) { return monitor.GetConnInfo(ctx) }},
+	{"sessions", "sessions", func(ctx context.Context, _ *config.Config) (interface{}, error) { return monitor.GetSessions(ctx) }},
+}
+
+// NewRegistry 按配置注册所有启用的内置采集器
+// 主机信息用于标识本机，每个周期都由 CollectMonitorData 单独采集，不经过注册表
+func NewRegistry(cfg *config.Config) (*collector.Registry, error) {
+	reg := collector.NewRegistry()
+	for _, b := range builtinCollectors {
+		if !cfg.CollectorEnabled(b.name) {
+			continue
+		}
+		fn := b.fn
+		c := collector.New(b.name, cfg.CollectorInterval(b.name), func(ctx context.Context) (interface{}, error) {
+			return fn(ctx, cfg)
+		})
+		if err := reg.Register(b.field, c, cfg.CollectorTimeout(b.name)); err != nil {
+			return nil, err
+		}
 	}
-	datas.CPUInfo = cpudata
 
-	// 获取内存信息
-	memdata, err := monitor.GetMemInfo()
-	if err != nil {
-		fmt.Printf("获取内存信息时出错: %v\n", err)
-		return datas, err
+	// 检查脚本各有自己的周期与超时，由 checks 采集器统一调度
+	if cfg.CollectorEnabled("checks") && len(cfg.Checks) > 0 {
+		list := make([]checks.Check, 0, len(cfg.Checks))
+		for _, ch := range cfg.Checks {
+			interval := ch.Interval
+			if interval == 0 {
+				interval = cfg.CollectorInterval("checks")
+			}
+			maxOutput := ch.MaxOutput
+			if maxOutput == 0 {
+				maxOutput = 4096
+			}
+			list = append(list, checks.Check{
+				Name:      ch.Name,
+				Command:   ch.Command,
+				Interval:  interval,
+				Timeout:   cfg.CheckTimeout(ch),
+				MaxOutput: maxOutput,
+			})
+		}
+		runner := checks.NewRunner(list)
+		c := collector.New("checks", cfg.CollectorInterval("checks"), func(ctx context.Context) (interface{}, error) {
+			return runner.Run(ctx), nil
+		})
+		if err := reg.Register("checks", c, cfg.CollectorTimeout("checks")); err != nil {
+			return nil, err
+		}
 	}
-	datas.MemInfo = memdata
 
-	// 获取主机信息
-	hostdata, err := monitor.GetHostInfo()
+	// 拨测同样各有自己的周期与超时，由 probes 采集器统一调度
+	if cfg.CollectorEnabled("probes") && len(cfg.Probes) > 0 {
+		list := make([]probe.Probe, 0, len(cfg.Probes))
+		for _, pr := range cfg.Probes {
+			interval := pr.Interval
+			if interval == 0 {
+				interval = cfg.CollectorInterval("probes")
+			}
+			var bodyRegex *regexp.Regexp
+			if pr.BodyRegex != "" {
+				bodyRegex = regexp.MustCompile(pr.BodyRegex) // 已在配置校验中检查
+			}
+			list = append(list, probe.Probe{
+				Name:               pr.Name,
+				Type:               pr.Type,
+				Target:             pr.Target,
+				Interval:           interval,
+				Timeout:            cfg.ProbeTimeout(pr),
+				Method:             pr.Method,
+				ExpectStatus:       pr.ExpectStatus,
+				BodyRegex:          bodyRegex,
+				InsecureSkipVerify: pr.InsecureSkipVerify,
+				RecordType:         pr.RecordType,
+				Resolver:           pr.Resolver,
+				Expect:             pr.Expect,
+			})
+		}
+		runner := probe.NewRunner(list)
+		c := collector.New("probes", cfg.CollectorInterval("probes"), func(ctx context.Context) (interface{}, error) {
+			return runner.Run(ctx), nil
+		})
+		if err := reg.Register("probes", c, cfg.CollectorTimeout("probes")); err != nil {
+			return nil, err
+		}
+	}
+
+	// 进程监视需要记住上一次的 PID 以判断重启
+	if cfg.CollectorEnabled("watchlist") && len(cfg.Watchlist) > 0 {
+		entries := make([]watchlist.Entry, 0, len(cfg.Watchlist))
+		for _, wc := range cfg.Watchlist {
+			entry := watchlist.Entry{
+				Name:         wc.Name,
+				ProcessName:  wc.ProcessName,
+				PidFile:      wc.PidFile,
+				MinInstances: wc.MinInstances,
+			}
+			if wc.Cmdline != "" {
+				entry.Cmdline = regexp.MustCompile(wc.Cmdline) // 已在配置校验中检查
+			}
+			if entry.MinInstances == 0 {
+				entry.MinInstances = 1
+			}
+			entries = append(entries, entry)
+		}
+		watcher := watchlist.New(entries)
+		c := collector.New("watchlist", cfg.CollectorInterval("watchlist"), func(ctx context.Context) (interface{}, error) {
+			return watcher.Check(ctx)
+		})
+		if err := reg.Register("watchlist", c, cfg.CollectorTimeout("watchlist")); err != nil {
+			return nil, err
+		}
+	}
+
+	// 文件完整性监控在每次扫描后以扫描结果作为新的基线
+	if cfg.CollectorEnabled("fim") && len(cfg.FIM.Paths) > 0 {
+		integrity := fim.New(fim.Options{
+			Paths:        cfg.FIM.Paths,
+			Exclude:      cfg.FIM.Exclude,
+			MaxHashSize:  cfg.FIM.MaxHashSize,
+			MaxFiles:     cfg.FIM.MaxFiles,
+			BaselineFile: cfg.FIM.BaselineFile,
+			ReadOnly:     cfg.FIM.ReadOnly,
+		})
+		c := collector.New("fim", cfg.CollectorInterval("fim"), func(ctx context.Context) (interface{}, error) {
+			return integrity.Scan(ctx)
+		})
+		if err := reg.Register("file_changes", c, cfg.CollectorTimeout("fim")); err != nil {
+			return nil, err
+		}
+	}
+
+	// 日志监控在后台持续跟踪文件，采集时取出两次采集之间匹配的事件
+	if cfg.CollectorEnabled("logs") && len(cfg.LogWatch.Files) > 0 {
+		files := make([]logwatch.File, 0, len(cfg.LogWatch.Files))
+		for _, f := range cfg.LogWatch.Files {
+			file := logwatch.File{Path: f.Path}
+			for _, r := range f.Rules {
+				severity := r.Severity
+				if severity == "" {
+					severity = "warning"
+				}
+				window := r.RateWindow
+				if window == 0 {
+					window = time.Minute
+				}
+				file.Rules = append(file.Rules, logwatch.Rule{
+					Name:       r.Name,
+					Pattern:    regexp.MustCompile(r.Pattern), // 已在配置校验中检查
+					Severity:   severity,
+					RateLimit:  r.RateLimit,
+					RateWindow: window,
+				})
+			}
+			files = append(files, file)
+		}
+		maxEvents := cfg.LogWatch.MaxEvents
+		if maxEvents == 0 {
+			maxEvents = 500
+		}
+		watcher := logwatch.New(files, maxEvents)
+		c := closingCollector{
+			Collector: collector.New("logs", cfg.CollectorInterval("logs"), func(context.Context) (interface{}, error) {
+				return watcher.Drain(), nil
+			}),
+			close: watcher.Close,
+		}
+		if err := reg.Register("log_events", c, cfg.CollectorTimeout("logs")); err != nil {
+			return nil, err
+		}
+		watcher.Start()
+	}
+
+	// 登录审计与日志监控相同，在后台跟踪认证日志
+	if cfg.CollectorEnabled("logins") && len(cfg.Logins.AuthLogs) > 0 {
+		maxEvents := cfg.Logins.MaxEvents
+		if maxEvents == 0 {
+			maxEvents = 1000
+		}
+		watcher := logins.New(cfg.Logins.AuthLogs, maxEvents)
+		c := closingCollector{
+			Collector: collector.New("logins", cfg.CollectorInterval("logins"), func(context.Context) (interface{}, error) {
+				return watcher.Drain(), nil
+			}),
+			close: watcher.Close,
+		}
+		if err := reg.Register("login_events", c, cfg.CollectorTimeout("logins")); err != nil {
+			return nil, err
+		}
+		watcher.Start()
+	}
+	return reg, nil
+}
+
+// closingCollector 带有后台任务的采集器，关闭注册表时一并停止
+type closingCollector struct {
+	collector.Collector
+	close func() error
+}
+
+func (c closingCollector) Close() error {
+	return c.close()
+}
+
+// 收集监控数据，单个采集器失败或超时时仍返回其余采集器的数据，错误记录在 CollectorErrors 中
+func CollectMonitorData(ctx context.Context, cfg *config.Config, reg *collector.Registry) MonitorData {
+	now := time.Now()
+	datas := MonitorData{CollectedAt: now}
+
+	// 获取主机信息，主机信息用于标识本机，获取失败时仍使用配置的主机名上报
+	hostdata, err := monitor.GetHostInfo(ctx)
 	if err != nil {
-		fmt.Printf("获取主机信息时出错: %v\n", err)
-		return datas, err
+		logger.Errorf("获取主机信息时出错: %v", err)
+		if name, herr := os.Hostname(); herr == nil {
+			hostdata.Hostname = name
+		}
+	}
+	if cfg.HostName != "" {
+		hostdata.Hostname = cfg.HostName
 	}
-	hostdata.Hostname = hostname
-	hostdata.Token = token
 	datas.HostInfo = hostdata
 
-	// 获取进程信息
-	prodata, err := monitor.GetProcess()
+	result := reg.Run(ctx, now)
+	datas.Sections = result.Data
 	if err != nil {
-		fmt.Printf("获取进程信息时出错: %v\n", err)
-		return datas, err
+		result.Errors["host"] = err.Error()
 	}
-	datas.ProcessInfo = prodata
-	// 获取进程信息
-	netdata, err := monitor.GetNetworkInfo()
-	if err != nil {
-		fmt.Printf("获取进程信息时出错: %v\n", err)
-		return datas, err
+	for name, e := range result.Errors {
+		logger.Errorf("采集器 %s 出错: %s", name, e)
+	}
+	if len(result.Errors) > 0 {
+		datas.CollectorErrors = result.Errors
 	}
-	datas.NetworkInfo = netdata
 
-	return datas, nil
+	return datas
 }
 
-// 发送监控数据到服务器
-func SendMonitorData(url string, data MonitorData) error {
+// 发送监控数据到服务器，依次尝试各服务器地址，任意一个成功即返回
+func SendMonitorData(ctx context.Context, client *http.Client, urls []string, data MonitorData) error {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return fmt.Errorf("数据序列化错误: %v", err)
 	}
+	return SendPayload(ctx, client, urls, jsonData)
+}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+// SendPayload 发送已序列化的监控数据，依次尝试各服务器地址，任意一个成功即返回，ctx 取消后不再尝试其余地址
+func SendPayload(ctx context.Context, client *http.Client, urls []string, payload []byte) error {
+	_, err := PostPayload(ctx, client, urls, payload)
+	return err
+}
+
+// PostPayload 与 SendPayload 相同，同时返回发送成功的服务器的响应内容
+func PostPayload(ctx context.Context, client *http.Client, urls []string, payload []byte) ([]byte, error) {
+	var errs []error
+	for _, url := range urls {
+		body, err := postJSON(ctx, client, url, payload)
+		if err == nil {
+			return body, nil
+		}
+		logger.Warnf("发送数据到 %s 失败: %v", url, err)
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// StatusError 服务器返回了非成功的状态码
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Message    string // 服务器响应中的 error 字段，如签名校验失败的原因
+}
+
+// newStatusError 读取服务器响应中的 error 字段
+func newStatusError(resp *http.Response) *StatusError {
+	se := &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	var errResp struct {
+		Error string `json:"error"`
+	}
+	if content, err := io.ReadAll(io.LimitReader(resp.Body, 4096)); err == nil && json.Unmarshal(content, &errResp) == nil {
+		se.Message = errResp.Error
+	}
+	return se
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("发送数据失败: %s: %s", e.Status, e.Message)
+	}
+	return fmt.Sprintf("发送数据失败: %s", e.Status)
+}
+
+// Retryable 判断发送失败后是否值得重试
+// 网络错误、5xx、408 与 429 可以重试；其余 4xx 说明数据本身被拒绝，重试也不会成功
+func Retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var se *StatusError
+	if !errors.As(err, &se) {
+		return true
+	}
+	// 多个地址中只要有一个可以重试即视为可以重试
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			if Retryable(e) {
+				return true
+			}
+		}
+		return false
+	}
+	return se.StatusCode >= 500 || se.StatusCode == http.StatusRequestTimeout || se.StatusCode == http.StatusTooManyRequests
+}
+
+// maxResponseSize 读取服务器响应的上限，响应只包含状态与少量下发信息
+const maxResponseSize = 1 << 20
+
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("发送数据错误: %v", err)
+		return nil, fmt.Errorf("发送数据错误: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("发送数据失败: %s", resp.Status)
+		return nil, newStatusError(resp)
 	}
 
-	return err
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %v", err)
+	}
+	return respBody, nil
 }
@@ -0,0 +1,149 @@
+package data
+
+import (
+	"cmd/agentmonitor/collector"
+	"cmd/agentmonitor/config"
+	"cmd/agentmonitor/logger"
+	"cmd/agentmonitor/update"
+	"cmd/agentmonitor/version"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// Heartbeat agent 自身的运行状态，与监控数据分开发送
+type Heartbeat struct {
+	HostName      string             `json:"host_name"`
+	Version       string             `json:"version"`
+	OS            string             `json:"os"` // 服务器据此选择对应平台的升级文件
+	Arch          string             `json:"arch"`
+	StartedAt     time.Time          `json:"started_at"`
+	Uptime        int64              `json:"uptime"`      // agent 运行时长（秒）
+	ConfigHash    string             `json:"config_hash"` // 生效配置的 SHA-256
+	ConfigETag    string             `json:"config_etag"` // 已合并的下发配置的版本
+	Collectors    map[string]float64 `json:"collectors"`  // 各采集器最近一次采集的耗时（毫秒）
+	SendFailures  uint64             `json:"send_failures"`
+	LastSendError string             `json:"last_send_error,omitempty"`
+	SpoolDepth    int                `json:"spool_depth"`
+	SpoolBytes    int64              `json:"spool_bytes"`
+	SentAt        time.Time          `json:"sent_at"`
+}
+
+// HeartbeatResponse 服务器对心跳的响应，Update 为服务器期望 agent 升级到的版本
+type HeartbeatResponse struct {
+	Status string       `json:"status"`
+	Update *update.Info `json:"update,omitempty"`
+}
+
+// Heartbeater 定期向服务器发送心跳，心跳失败不写入本地缓存
+type Heartbeater struct {
+	client     *http.Client
+	urls       []string
+	hostName   string
+	configHash string
+	configETag string
+	startedAt  time.Time
+	reg        *collector.Registry
+	sender     *Sender
+
+	failing bool // 上一次心跳是否失败，避免服务器不可达时刷屏
+	onBeat  func(resp HeartbeatResponse, err error)
+}
+
+// NewHeartbeater 创建心跳发送器
+func NewHeartbeater(client *http.Client, cfg *config.Config, reg *collector.Registry, sender *Sender) *Heartbeater {
+	return &Heartbeater{
+		client:     client,
+		urls:       cfg.HeartbeatURLs(),
+		hostName:   cfg.AgentHostName(),
+		configHash: cfg.Hash(),
+		configETag: cfg.RemoteETag,
+		startedAt:  time.Now(),
+		reg:        reg,
+		sender:     sender,
+	}
+}
+
+// Build 生成当前的心跳数据
+func (h *Heartbeater) Build() Heartbeat {
+	now := time.Now()
+	hb := Heartbeat{
+		HostName:   h.hostName,
+		Version:    version.Version,
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		StartedAt:  h.startedAt,
+		Uptime:     int64(now.Sub(h.startedAt) / time.Second),
+		ConfigHash: h.configHash,
+		ConfigETag: h.configETag,
+		Collectors: map[string]float64{},
+		SentAt:     now,
+	}
+	for name, d := range h.reg.LastDurations() {
+		hb.Collectors[name] = float64(d.Microseconds()) / 1000
+	}
+	if h.sender != nil {
+		stats := h.sender.Stats()
+		hb.SendFailures = stats.Failures
+		hb.LastSendError = stats.LastError
+		hb.SpoolDepth = stats.SpoolDepth
+		hb.SpoolBytes = stats.SpoolBytes
+	}
+	return hb
+}
+
+// OnBeat 设置每次心跳完成后的回调，在 Run 所在的 goroutine 中调用
+func (h *Heartbeater) OnBeat(fn func(resp HeartbeatResponse, err error)) {
+	h.onBeat = fn
+}
+
+// Beat 发送一次心跳并解析服务器的响应
+func (h *Heartbeater) Beat(ctx context.Context) (HeartbeatResponse, error) {
+	var resp HeartbeatResponse
+	payload, err := json.Marshal(h.Build())
+	if err != nil {
+		return resp, fmt.Errorf("心跳序列化错误: %v", err)
+	}
+	body, err := PostPayload(ctx, h.client, h.urls, payload)
+	if err != nil {
+		return resp, err
+	}
+	// 心跳已送达，响应无法解析时只是没有下发信息
+	if err := json.Unmarshal(body, &resp); err != nil {
+		logger.Debugf("解析心跳响应失败: %v", err)
+	}
+	return resp, nil
+}
+
+// Run 按周期发送心跳，直到 ctx 被取消
+func (h *Heartbeater) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		resp, err := h.Beat(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			if !h.failing {
+				logger.Warnf("发送心跳失败: %v", err)
+			}
+			h.failing = true
+		} else if h.failing {
+			logger.Infof("心跳恢复")
+			h.failing = false
+		}
+		if h.onBeat != nil {
+			h.onBeat(resp, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package data
+
+import (
+	"bytes"
+	"cmd/agentmonitor/config"
+	"cmd/agentmonitor/logger"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// 保存下发配置时第一行记录 ETag
+const cacheETagPrefix = "# etag: "
+
+// RemoteConfigFetcher 获取服务器下发的配置，请求带上当前配置的 ETag，配置未变化时服务器返回 304
+type RemoteConfigFetcher struct {
+	client    *http.Client
+	urls      []string
+	cacheFile string
+
+	mu      sync.Mutex
+	content []byte
+	etag    string
+	fetched bool // 是否已获取到配置，包括从本地保存的配置中读取
+}
+
+// NewRemoteConfigFetcher 创建下发配置的获取器，并读取本地保存的上一份配置
+func NewRemoteConfigFetcher(client *http.Client, cfg *config.Config) *RemoteConfigFetcher {
+	f := &RemoteConfigFetcher{
+		client:    client,
+		urls:      cfg.RemoteConfigURLs(),
+		cacheFile: cfg.RemoteConfig.CacheFile,
+	}
+	if f.cacheFile == "" {
+		return f
+	}
+	cached, err := os.ReadFile(f.cacheFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warnf("读取保存的下发配置失败: %v", err)
+		}
+		return f
+	}
+	line, content, _ := bytes.Cut(cached, []byte("\n"))
+	if etag, ok := strings.CutPrefix(string(line), cacheETagPrefix); ok {
+		f.content, f.etag, f.fetched = content, etag, true
+	}
+	return f
+}
+
+// Latest 最近一次获取到的配置及其 ETag，尚未获取到时 ok 为 false
+func (f *RemoteConfigFetcher) Latest() (content []byte, etag string, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.content, f.etag, f.fetched
+}
+
+// Fetch 依次尝试各服务器地址获取配置，任意一个成功即返回
+// 服务器没有提供下发配置的接口（404）时视为没有下发配置
+func (f *RemoteConfigFetcher) Fetch(ctx context.Context) error {
+	_, etag, _ := f.Latest()
+	var errs []error
+	for _, url := range f.urls {
+		content, newETag, modified, err := f.get(ctx, url, etag)
+		if err == nil {
+			if modified {
+				f.save(content, newETag)
+			}
+			return nil
+		}
+		var se *StatusError
+		if errors.As(err, &se) && se.StatusCode == http.StatusNotFound {
+			logger.Debugf("%s 没有下发配置的接口", url)
+			f.save(nil, "")
+			return nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f *RemoteConfigFetcher) get(ctx context.Context, url, etag string) ([]byte, string, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", false, fmt.Errorf("创建请求失败: %v", err)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", `"`+etag+`"`)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, "", false, fmt.Errorf("获取下发配置失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, etag, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", false, newStatusError(resp)
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, "", false, fmt.Errorf("读取下发配置失败: %v", err)
+	}
+	return content, strings.Trim(resp.Header.Get("ETag"), `"`), true, nil
+}
+
+// save 记录新的配置，并写入本地文件供下次启动时使用
+func (f *RemoteConfigFetcher) save(content []byte, etag string) {
+	f.mu.Lock()
+	changed := !f.fetched || f.etag != etag
+	f.content, f.etag, f.fetched = content, etag, true
+	f.mu.Unlock()
+	if !changed || f.cacheFile == "" {
+		return
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(cacheETagPrefix + etag + "\n")
+	buf.Write(content)
+	tmp := f.cacheFile + ".tmp"
+	err := os.MkdirAll(filepath.Dir(f.cacheFile), 0755)
+	if err == nil {
+		err = os.WriteFile(tmp, buf.Bytes(), 0600)
+	}
+	if err == nil {
+		err = os.Rename(tmp, f.cacheFile)
+	}
+	if err != nil {
+		logger.Warnf("保存下发配置失败: %v", err)
+	}
+}
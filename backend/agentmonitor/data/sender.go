@@ -0,0 +1,169 @@
+package data
+
+import (
+	"cmd/agentmonitor/logger"
+	"cmd/agentmonitor/spool"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Sender 发送监控数据，服务器不可达时写入本地缓存，恢复后按采集顺序补发
+type Sender struct {
+	client *http.Client
+	urls   []string
+	spool  *spool.Spool // 为 nil 时不缓存，发送失败的数据直接丢弃
+
+	mu        sync.Mutex
+	backoff   spool.Backoff
+	nextRetry time.Time
+	failures  uint64 // 发送失败的累计次数，包括补发
+	lastError string
+}
+
+// SendStats 发送器的运行状态
+type SendStats struct {
+	Failures   uint64
+	LastError  string
+	SpoolDepth int   // 本地缓存中待补发的条数
+	SpoolBytes int64 // 本地缓存的总大小
+}
+
+// NewSender 创建发送器，sp 为 nil 时不启用本地缓存
+func NewSender(client *http.Client, urls []string, sp *spool.Spool, backoff spool.Backoff) *Sender {
+	return &Sender{
+		client:  client,
+		urls:    urls,
+		spool:   sp,
+		backoff: backoff,
+	}
+}
+
+// Send 发送一次采集的数据
+// 缓存中还有未补发的数据时直接写入缓存，保证服务器按采集顺序收到数据
+// ctx 被取消（agent 正在停止）时不再发送或中断发送，数据写入缓存留待下次启动后补发
+func (s *Sender) Send(ctx context.Context, payload []byte) error {
+	if s.spool == nil {
+		return s.send(ctx, payload)
+	}
+
+	if n, _, err := s.spool.Depth(); (err == nil && n > 0) || ctx.Err() != nil {
+		return s.put(payload)
+	}
+
+	err := s.send(ctx, payload)
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		logger.Warnf("agent 正在停止，未发送完成的数据写入本地缓存")
+		return s.put(payload)
+	}
+	if !Retryable(err) {
+		return err
+	}
+	logger.Warnf("服务器不可达，数据写入本地缓存: %v", err)
+	s.scheduleRetry()
+	return s.put(payload)
+}
+
+// send 发送数据并记录失败次数，因 ctx 取消而中断的发送不计入
+func (s *Sender) send(ctx context.Context, payload []byte) error {
+	err := SendPayload(ctx, s.client, s.urls, payload)
+	if err != nil && ctx.Err() == nil {
+		s.mu.Lock()
+		s.failures++
+		s.lastError = err.Error()
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// Stats 返回发送失败次数与本地缓存的积压情况
+func (s *Sender) Stats() SendStats {
+	s.mu.Lock()
+	stats := SendStats{Failures: s.failures, LastError: s.lastError}
+	s.mu.Unlock()
+	if s.spool != nil {
+		if n, size, err := s.spool.Depth(); err == nil {
+			stats.SpoolDepth, stats.SpoolBytes = n, size
+		}
+	}
+	return stats
+}
+
+func (s *Sender) put(payload []byte) error {
+	evicted, err := s.spool.Put(payload)
+	if evicted > 0 {
+		logger.Warnf("本地缓存超出限制，丢弃最旧的 %d 条数据", evicted)
+	}
+	return err
+}
+
+func (s *Sender) scheduleRetry() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wait := s.backoff.Next()
+	s.nextRetry = time.Now().Add(wait)
+	logger.Infof("%v 后重试补发缓存数据", wait.Round(time.Second))
+}
+
+// Replay 到达重试时间后补发缓存中的数据，遇到失败时按退避时间推迟下一次重试
+// ctx 被取消时在当前这条数据之后停止，未补发的数据留在缓存中
+func (s *Sender) Replay(ctx context.Context) {
+	if s.spool == nil {
+		return
+	}
+	s.mu.Lock()
+	wait := time.Now().Before(s.nextRetry)
+	s.mu.Unlock()
+	if wait {
+		return
+	}
+
+	sent, err := s.spool.Replay(func(payload []byte) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err := s.send(ctx, payload)
+		if err != nil && !Retryable(err) {
+			// 被服务器拒绝的数据重试也不会成功，丢弃后继续补发后面的数据
+			logger.Errorf("缓存数据被服务器拒绝，已丢弃: %v", err)
+			return nil
+		}
+		return err
+	})
+	if sent > 0 {
+		logger.Infof("已补发 %d 条缓存数据", sent)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		logger.Warnf("补发缓存数据失败: %v", err)
+		s.scheduleRetry()
+		return
+	}
+
+	s.mu.Lock()
+	s.backoff.Reset()
+	s.mu.Unlock()
+}
+
+// RunReplay 定期检查并补发缓存数据，直到 ctx 被取消
+func (s *Sender) RunReplay(ctx context.Context) {
+	if s.spool == nil {
+		return
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Replay(ctx)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"cmd/agentmonitor/config"
+	"cmd/agentmonitor/data"
+	"cmd/agentmonitor/logger"
+	"cmd/agentmonitor/spool"
+	"cmd/agentmonitor/version"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// redacted 诊断包中 token 的替代内容
+const redacted = "******"
+
+var tokenLine = regexp.MustCompile(`(?m)^(\s*token\s*:).*$`)
+
+// runDiag 将配置、最近的日志、本地缓存状态、一次采集的数据与服务器检查结果打包为 tar.gz
+// 某一项收集失败时记录在包内的 errors.txt 中，不影响其余各项；token 不会写入诊断包
+func runDiag(args []string) int {
+	logger.SetConsole(os.Stderr)
+	var o options
+	fs := newFlagSet("diag", &o)
+	output := fs.String("o", "", "Output file (default agentmonitor-diag-<host>-<time>.tar.gz in the current directory)")
+	logBytes := fs.Int64("log-bytes", 1<<20, "Bytes to include from the end of the log file")
+	fs.Parse(args)
+
+	now := time.Now().Truncate(time.Second)
+	d := &diag{prefix: "agentmonitor-diag-" + now.Format("20060102-150405") + "/", modTime: now}
+	if o.configPath != "" {
+		if raw, err := os.ReadFile(o.configPath); err != nil {
+			d.fail("读取配置文件失败: %v", err)
+		} else {
+			d.add("agent.yaml", tokenLine.ReplaceAll(raw, []byte("${1} "+redacted)))
+		}
+	}
+
+	// 配置无效时仍输出已收集的内容，便于排查配置本身的问题
+	cfg, err := o.loadCached()
+	if err != nil {
+		d.fail("%v", err)
+	} else {
+		if err := logger.Init(cfg.Log.Level, ""); err != nil {
+			d.fail("初始化日志失败: %v", err)
+		}
+		d.prefix = "agentmonitor-diag-" + cfg.AgentHostName() + "-" + now.Format("20060102-150405") + "/"
+		d.collect(cfg, *logBytes)
+	}
+	d.add("info.txt", d.info(cfg, o.configPath))
+	if len(d.errors) > 0 {
+		d.add("errors.txt", []byte(strings.Join(d.errors, "\n")+"\n"))
+	}
+
+	path := *output
+	if path == "" {
+		path = strings.TrimSuffix(d.prefix, "/") + ".tar.gz"
+	}
+	if err := d.write(path); err != nil {
+		fmt.Fprintf(os.Stderr, "写入诊断包失败: %v\n", err)
+		return 1
+	}
+	fmt.Println(path)
+	return 0
+}
+
+// diag 诊断包中的文件，按添加的顺序写入
+type diag struct {
+	prefix  string
+	modTime time.Time
+	names   []string
+	files   map[string][]byte
+	errors  []string
+}
+
+func (d *diag) add(name string, content []byte) {
+	if d.files == nil {
+		d.files = map[string][]byte{}
+	}
+	if _, ok := d.files[name]; !ok {
+		d.names = append(d.names, name)
+	}
+	d.files[name] = content
+}
+
+func (d *diag) fail(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	logger.Warnf("%s", msg)
+	d.errors = append(d.errors, msg)
+}
+
+// collect 收集依赖配置的各项内容
+func (d *diag) collect(cfg *config.Config, logBytes int64) {
+	cp := *cfg
+	if cp.Token != "" {
+		cp.Token = redacted
+	}
+	if content, err := yaml.Marshal(&cp); err != nil {
+		d.fail("序列化配置失败: %v", err)
+	} else {
+		d.add("config.yaml", content)
+	}
+	if cfg.RemoteConfigEnabled() && cfg.RemoteConfig.CacheFile != "" {
+		if content, err := os.ReadFile(cfg.RemoteConfig.CacheFile); err == nil {
+			d.add("remote-config.yaml", content)
+		} else if !os.IsNotExist(err) {
+			d.fail("读取保存的下发配置失败: %v", err)
+		}
+	}
+
+	if cfg.Log.File != "" {
+		if content, err := tailFile(cfg.Log.File, logBytes); err != nil {
+			d.fail("读取日志文件失败: %v", err)
+		} else {
+			d.add("agent.log", content)
+		}
+	}
+	d.add("spool.txt", d.spoolState(cfg))
+
+	logger.Infof("采集一次数据")
+	cfg.FIM.ReadOnly = true
+	reg, err := data.NewRegistry(cfg)
+	if err != nil {
+		d.fail("注册采集器失败: %v", err)
+	} else {
+		sample := data.CollectMonitorData(context.Background(), cfg, reg)
+		reg.Close()
+		if content, err := json.MarshalIndent(sample, "", "  "); err != nil {
+			d.fail("数据序列化错误: %v", err)
+		} else {
+			d.add("sample.json", content)
+		}
+	}
+
+	if !cfg.Server.Disabled {
+		logger.Infof("检查服务器")
+		var buf bytes.Buffer
+		if !checkServer(&buf, cfg) {
+			d.fail("服务器检查未通过，见 check-server.txt")
+		}
+		d.add("check-server.txt", buf.Bytes())
+	}
+}
+
+// info 版本、运行环境与配置概要，cfg 为 nil 时说明配置无法加载
+func (d *diag) info(cfg *config.Config, configPath string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "version: %s\n", version.Version)
+	fmt.Fprintf(&b, "go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if name, err := os.Hostname(); err == nil {
+		fmt.Fprintf(&b, "system_hostname: %s\n", name)
+	}
+	fmt.Fprintf(&b, "time: %s\n", d.modTime.Format(time.RFC3339))
+	if configPath == "" {
+		configPath = "（未指定，使用默认配置与环境变量）"
+	}
+	fmt.Fprintf(&b, "config: %s\n", configPath)
+	if cfg == nil {
+		fmt.Fprintf(&b, "配置无法加载，见 errors.txt\n")
+		return b.Bytes()
+	}
+	fmt.Fprintf(&b, "host_name: %s\n", cfg.AgentHostName())
+	fmt.Fprintf(&b, "config_hash: %s\n", cfg.Hash())
+	fmt.Fprintf(&b, "remote_etag: %s\n", cfg.RemoteETag)
+	fmt.Fprintf(&b, "token: %v\n", cfg.Token != "")
+	if cfg.Server.Disabled {
+		fmt.Fprintf(&b, "server: disabled\n")
+	} else {
+		fmt.Fprintf(&b, "server: %s\n", strings.Join(cfg.Server.URLs, " "))
+	}
+	if cfg.Log.File == "" {
+		fmt.Fprintf(&b, "log.file 未配置，日志只输出到标准输出，请另外从 systemd journal 等处获取\n")
+	}
+	return b.Bytes()
+}
+
+// spoolState 本地缓存的数据条数、大小与各条数据的写入时间
+func (d *diag) spoolState(cfg *config.Config) []byte {
+	var b bytes.Buffer
+	if cfg.Spool.Dir == "" {
+		fmt.Fprintf(&b, "未启用本地缓存\n")
+		return b.Bytes()
+	}
+	fmt.Fprintf(&b, "dir: %s\n", cfg.Spool.Dir)
+	// spool.New 会创建目录，目录不存在时说明还没有缓存过数据
+	if _, err := os.Stat(cfg.Spool.Dir); os.IsNotExist(err) {
+		fmt.Fprintf(&b, "目录不存在\n")
+		return b.Bytes()
+	}
+	sp, err := spool.New(cfg.Spool.Dir, cfg.Spool.MaxBytes, cfg.Spool.MaxFiles, cfg.Spool.MaxAge)
+	if err != nil {
+		d.fail("打开本地缓存失败: %v", err)
+		return b.Bytes()
+	}
+	entries, err := sp.Entries()
+	if err != nil {
+		d.fail("读取本地缓存失败: %v", err)
+		return b.Bytes()
+	}
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+	fmt.Fprintf(&b, "entries: %d\nbytes: %d\n", len(entries), total)
+	if len(entries) > 0 {
+		fmt.Fprintf(&b, "oldest: %s\nnewest: %s\n\n", entries[0].Written.Format(time.RFC3339), entries[len(entries)-1].Written.Format(time.RFC3339))
+		for _, e := range entries {
+			fmt.Fprintf(&b, "%s\t%d\t%s\n", e.Name, e.Size, e.Written.Format(time.RFC3339))
+		}
+	}
+	return b.Bytes()
+}
+
+// write 写入 tar.gz，诊断包包含配置等内容，只有当前用户可读
+func (d *diag) write(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	for _, name := range d.names {
+		content := d.files[name]
+		hdr := &tar.Header{Name: d.prefix + name, Mode: 0600, Size: int64(len(content)), ModTime: d.modTime}
+		if err := tw.WriteHeader(hdr); err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := tw.Write(content); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// tailFile 读取文件最后 n 个字节，从第一个完整的行开始
+func tailFile(path string, n int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := info.Size() - n
+	if offset <= 0 {
+		return io.ReadAll(f)
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	if i := bytes.IndexByte(content, '\n'); i >= 0 {
+		content = content[i+1:]
+	}
+	return content, nil
+}
@@ -0,0 +1,421 @@
+package fim
+
+import (
+	"cmd/agentmonitor/logger"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 变化类型
+const (
+	Added    = "added"
+	Removed  = "removed"
+	Modified = "modified"
+)
+
+// FileState 文件的属性，SHA256 为空表示没有计算哈希：不是普通文件、超过哈希大小上限或无法读取
+type FileState struct {
+	Size       int64     `json:"size"`
+	Mode       string    `json:"mode"` // 如 -rw-r--r--，首字符为文件类型
+	UID        uint32    `json:"uid"`
+	GID        uint32    `json:"gid"`
+	Owner      string    `json:"owner"`
+	Group      string    `json:"group"`
+	SHA256     string    `json:"sha256,omitempty"`
+	Link       string    `json:"link,omitempty"` // 符号链接的目标
+	ModTime    time.Time `json:"mtime"`
+	ChangeTime time.Time `json:"ctime"` // inode 的变化时间，不能通过 touch 修改；不支持的系统为零值
+	Inode      uint64    `json:"inode"`
+}
+
+// Change 相对基线的一个变化
+type Change struct {
+	Path       string     `json:"path"`
+	Change     string     `json:"change"`           // added、removed 或 modified
+	Fields     []string   `json:"fields,omitempty"` // modified 时变化的属性：sha256、size、mode、owner、group、link
+	Before     *FileState `json:"before,omitempty"`
+	After      *FileState `json:"after,omitempty"`
+	DetectedAt time.Time  `json:"detected_at"`
+}
+
+// Options 扫描范围与基线文件
+type Options struct {
+	Paths        []string // 文件、目录（递归）或 glob
+	Exclude      []string // 与文件名或完整路径匹配的 glob
+	MaxHashSize  int64    // 超过该大小的文件不计算哈希，只比较其他属性
+	MaxFiles     int      // 扫描的文件数上限，超过时忽略其余文件
+	BaselineFile string   // 为空时基线只保存在内存中，agent 重启后重新建立
+	ReadOnly     bool     // 只与基线比较，不更新基线
+}
+
+// entry 基线中的一个文件，Pattern 为匹配到该文件的配置项
+type entry struct {
+	FileState
+	Pattern string `json:"pattern"`
+}
+
+type baseline struct {
+	Files map[string]entry `json:"files"`
+	// Patterns 建立基线时的 paths，新增的配置项匹配到的文件直接加入基线，不报告为新增
+	Patterns []string `json:"patterns"`
+}
+
+// Monitor 定期扫描文件并与基线比较，比较后以本次扫描的结果作为新的基线
+type Monitor struct {
+	opts Options
+
+	mu       sync.Mutex
+	base     *baseline // 首次扫描时从基线文件读取
+	hashed   map[string]entry
+	warned   map[string]bool // 已记录过日志的无法读取的文件，避免每次扫描重复记录
+	truncate bool            // 已记录过超过文件数上限的日志
+}
+
+// New 创建文件完整性监控
+func New(opts Options) *Monitor {
+	return &Monitor{opts: opts, hashed: map[string]entry{}, warned: map[string]bool{}}
+}
+
+// Scan 扫描所有文件并返回相对基线的变化；扫描被取消时不更新基线，已计算的哈希在下一次扫描时复用
+// 首次扫描没有基线时只建立基线，不报告变化
+func (m *Monitor) Scan(ctx context.Context) ([]Change, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.base == nil {
+		m.base = m.load()
+	}
+	current, skipped, err := m.walk(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	known := map[string]bool{}
+	for _, p := range m.base.Patterns {
+		known[p] = true
+	}
+	changes := []Change{}
+	for path, cur := range current {
+		old, ok := m.base.Files[path]
+		if !ok {
+			if known[cur.Pattern] {
+				after := cur.FileState
+				changes = append(changes, Change{Path: path, Change: Added, After: &after, DetectedAt: now})
+			}
+			continue
+		}
+		if fields := diff(old.FileState, cur.FileState); len(fields) > 0 {
+			before, after := old.FileState, cur.FileState
+			changes = append(changes, Change{Path: path, Change: Modified, Fields: fields, Before: &before, After: &after, DetectedAt: now})
+		}
+	}
+	configured := map[string]bool{}
+	for _, p := range m.opts.Paths {
+		configured[p] = true
+	}
+	for path, old := range m.base.Files {
+		if _, ok := current[path]; ok {
+			continue
+		}
+		// 因超过文件数上限未扫描的文件仍然存在，不报告为删除
+		if _, ok := skipped[path]; ok {
+			continue
+		}
+		// 配置项被删除或文件被新加入 exclude 时不再监控，不报告为删除
+		if !configured[old.Pattern] || m.excluded(path) {
+			continue
+		}
+		before := old.FileState
+		changes = append(changes, Change{Path: path, Change: Removed, Before: &before, DetectedAt: now})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+
+	// 采集超时后结果会被丢弃，此时不更新基线，下一次扫描重新报告
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if m.opts.ReadOnly {
+		return changes, nil
+	}
+	// 未扫描的文件保留原来的基线，之后再次被扫描时不报告为新增
+	files := make(map[string]entry, len(current)+len(skipped))
+	for path, e := range current {
+		files[path] = e
+	}
+	for path, e := range skipped {
+		files[path] = e
+	}
+	m.base = &baseline{Files: files, Patterns: append([]string(nil), m.opts.Paths...)}
+	m.hashed = current
+	m.save()
+	return changes, nil
+}
+
+// diff 比较两次扫描的属性，只修改时间变化（如 touch）不算修改；任一方没有哈希时不比较哈希
+func diff(before, after FileState) []string {
+	var fields []string
+	if before.SHA256 != "" && after.SHA256 != "" && before.SHA256 != after.SHA256 {
+		fields = append(fields, "sha256")
+	}
+	if before.Size != after.Size {
+		fields = append(fields, "size")
+	}
+	if before.Mode != after.Mode {
+		fields = append(fields, "mode")
+	}
+	if before.UID != after.UID {
+		fields = append(fields, "owner")
+	}
+	if before.GID != after.GID {
+		fields = append(fields, "group")
+	}
+	if before.Link != after.Link {
+		fields = append(fields, "link")
+	}
+	return fields
+}
+
+// walk 展开所有配置项并读取文件属性，一个文件只属于第一个匹配到它的配置项
+// 超过文件数上限后不再读取属性，其中已在基线中的文件作为 skipped 返回其基线记录
+func (m *Monitor) walk(ctx context.Context) (map[string]entry, map[string]entry, error) {
+	files := map[string]entry{}
+	skipped := map[string]entry{}
+	names := &nameCache{users: map[uint32]string{}, groups: map[uint32]string{}}
+	full := false
+	add := func(path, pattern string, info fs.FileInfo) {
+		if _, ok := files[path]; ok {
+			return
+		}
+		if m.opts.MaxFiles > 0 && len(files) >= m.opts.MaxFiles {
+			full = true
+			if old, ok := m.base.Files[path]; ok {
+				skipped[path] = old
+			}
+			return
+		}
+		files[path] = entry{FileState: m.state(path, info, names), Pattern: pattern}
+	}
+
+	for _, pattern := range m.opts.Paths {
+		matches := []string{pattern}
+		if strings.ContainsAny(pattern, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(pattern); err != nil {
+				return nil, nil, fmt.Errorf("展开 %s 失败: %v", pattern, err)
+			}
+		}
+		for _, match := range matches {
+			if ctx.Err() != nil {
+				return nil, nil, ctx.Err()
+			}
+			if m.excluded(match) {
+				continue
+			}
+			info, err := os.Lstat(match)
+			if err != nil {
+				// 配置的文件不存在时没有需要监控的文件，原来存在的文件会被报告为删除
+				if !os.IsNotExist(err) {
+					m.warnOnce(match, "读取 %s 的属性失败: %v", match, err)
+				}
+				continue
+			}
+			if !info.IsDir() {
+				add(match, pattern, info)
+				continue
+			}
+			err = filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if err != nil {
+					m.warnOnce(path, "读取 %s 失败: %v", path, err)
+					return nil
+				}
+				if path != match && m.excluded(path) {
+					if d.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if d.IsDir() {
+					return nil
+				}
+				info, err := d.Info()
+				if err != nil {
+					return nil // 文件在遍历期间被删除
+				}
+				add(path, pattern, info)
+				return nil
+			})
+			if ctx.Err() != nil {
+				return nil, nil, ctx.Err()
+			}
+		}
+	}
+	if full && !m.truncate {
+		logger.Warnf("文件完整性监控的文件数超过上限 %d，其余文件不监控", m.opts.MaxFiles)
+	}
+	m.truncate = full
+	return files, skipped, nil
+}
+
+// state 读取文件属性，大小、修改时间、inode 与 ctime 都未变化时复用上一次的哈希
+func (m *Monitor) state(path string, info fs.FileInfo, names *nameCache) FileState {
+	st := FileState{
+		Size:    info.Size(),
+		Mode:    info.Mode().String(),
+		ModTime: info.ModTime().UTC(),
+	}
+	st.UID, st.GID, st.Inode, st.ChangeTime = statSys(info)
+	st.Owner = names.user(st.UID)
+	st.Group = names.group(st.GID)
+
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		if target, err := os.Readlink(path); err == nil {
+			st.Link = target
+		}
+	case info.Mode().IsRegular() && (m.opts.MaxHashSize <= 0 || info.Size() <= m.opts.MaxHashSize):
+		if prev, ok := m.hashed[path]; ok && prev.SHA256 != "" && !st.ChangeTime.IsZero() &&
+			prev.Size == st.Size && prev.ModTime.Equal(st.ModTime) && prev.ChangeTime.Equal(st.ChangeTime) && prev.Inode == st.Inode {
+			st.SHA256 = prev.SHA256
+			break
+		}
+		sum, err := hashFile(path)
+		if err != nil {
+			m.warnOnce(path, "计算 %s 的哈希失败: %v", path, err)
+			break
+		}
+		st.SHA256 = sum
+		delete(m.warned, path)
+		// 扫描被取消时已计算的哈希也保留，大量文件的首次扫描可以分多次完成
+		m.hashed[path] = entry{FileState: st}
+	}
+	return st
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// excluded 文件名或完整路径与 exclude 中的任一 glob 匹配
+func (m *Monitor) excluded(path string) bool {
+	for _, pattern := range m.opts.Exclude {
+		if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Monitor) warnOnce(path, format string, args ...interface{}) {
+	if m.warned[path] {
+		return
+	}
+	m.warned[path] = true
+	logger.Warnf(format, args...)
+}
+
+// load 读取基线文件，不存在或无法解析时从空的基线开始
+func (m *Monitor) load() *baseline {
+	empty := &baseline{Files: map[string]entry{}}
+	if m.opts.BaselineFile == "" {
+		return empty
+	}
+	content, err := os.ReadFile(m.opts.BaselineFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Errorf("读取文件完整性基线失败，重新建立基线: %v", err)
+		}
+		return empty
+	}
+	var b baseline
+	if err := json.Unmarshal(content, &b); err != nil || b.Files == nil {
+		logger.Errorf("解析文件完整性基线 %s 失败，重新建立基线: %v", m.opts.BaselineFile, err)
+		return empty
+	}
+	for path, e := range b.Files {
+		m.hashed[path] = e
+	}
+	return &b
+}
+
+// save 写入基线文件，先写临时文件再重命名，避免中途退出留下不完整的基线
+func (m *Monitor) save() {
+	if m.opts.BaselineFile == "" {
+		return
+	}
+	content, err := json.Marshal(m.base)
+	if err != nil {
+		logger.Errorf("序列化文件完整性基线失败: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(m.opts.BaselineFile), 0700); err != nil {
+		logger.Errorf("创建文件完整性基线目录失败: %v", err)
+		return
+	}
+	tmp := m.opts.BaselineFile + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		logger.Errorf("保存文件完整性基线失败: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, m.opts.BaselineFile); err != nil {
+		logger.Errorf("保存文件完整性基线失败: %v", err)
+	}
+}
+
+// nameCache 一次扫描中缓存的用户名与组名，查不到时使用数字 ID
+type nameCache struct {
+	users  map[uint32]string
+	groups map[uint32]string
+}
+
+func (c *nameCache) user(uid uint32) string {
+	name, ok := c.users[uid]
+	if !ok {
+		name = strconv.FormatUint(uint64(uid), 10)
+		if u, err := user.LookupId(name); err == nil {
+			name = u.Username
+		}
+		c.users[uid] = name
+	}
+	return name
+}
+
+func (c *nameCache) group(gid uint32) string {
+	name, ok := c.groups[gid]
+	if !ok {
+		name = strconv.FormatUint(uint64(gid), 10)
+		if g, err := user.LookupGroupId(name); err == nil {
+			name = g.Name
+		}
+		c.groups[gid] = name
+	}
+	return name
+}
@@ -0,0 +1,15 @@
+package fim
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// statSys 读取文件的属主、属组、inode 与 ctime
+func statSys(info fs.FileInfo) (uid, gid uint32, inode uint64, ctime time.Time) {
+	if sys, ok := info.Sys().(*syscall.Stat_t); ok {
+		return sys.Uid, sys.Gid, uint64(sys.Ino), time.Unix(sys.Ctim.Unix()).UTC()
+	}
+	return 0, 0, 0, time.Time{}
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package fim
+
+import (
+	"io/fs"
+	"time"
+)
+
+// statSys 非 Unix 系统没有属主、属组与 inode，均为 0，每次扫描都重新计算哈希
+func statSys(fs.FileInfo) (uid, gid uint32, inode uint64, ctime time.Time) {
+	return 0, 0, 0, time.Time{}
+}
@@ -0,0 +1,17 @@
+//go:build unix && !linux
+
+package fim
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// statSys 读取文件的属主、属组与 inode；其他 Unix 系统不读取 ctime，每次扫描都重新计算哈希
+func statSys(info fs.FileInfo) (uid, gid uint32, inode uint64, ctime time.Time) {
+	if sys, ok := info.Sys().(*syscall.Stat_t); ok {
+		return sys.Uid, sys.Gid, uint64(sys.Ino), time.Time{}
+	}
+	return 0, 0, 0, time.Time{}
+}
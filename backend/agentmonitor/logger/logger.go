@@ -0,0 +1,94 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// 日志级别
+const (
+	LevelDebug = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[string]int{
+	"debug": LevelDebug,
+	"info":  LevelInfo,
+	"warn":  LevelWarn,
+	"error": LevelError,
+}
+
+var (
+	mu      sync.RWMutex
+	level   = LevelInfo
+	logFile *os.File
+	console io.Writer = os.Stdout
+	std               = log.New(os.Stdout, "", log.LstdFlags)
+)
+
+// ParseLevel 将配置中的级别名转换为日志级别
+func ParseLevel(name string) (int, error) {
+	l, ok := levelNames[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("未知的日志级别 %q，可选值: debug、info、warn、error", name)
+	}
+	return l, nil
+}
+
+// SetConsole 设置日志文件之外的输出，默认为标准输出；子命令的结果占用标准输出时改为标准错误，需在 Init 之前调用
+func SetConsole(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	console = w
+	std.SetOutput(w)
+}
+
+// Init 设置日志级别与输出文件，file 为空时只输出到标准输出（或 SetConsole 设置的输出）
+func Init(levelName string, file string) error {
+	l, err := ParseLevel(levelName)
+	if err != nil {
+		return err
+	}
+
+	mu.RLock()
+	out := console
+	mu.RUnlock()
+	var f *os.File
+	if file != "" {
+		f, err = os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("打开日志文件失败: %v", err)
+		}
+		out = io.MultiWriter(out, f)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if logFile != nil {
+		logFile.Close()
+	}
+	logFile = f
+	level = l
+	std.SetOutput(out)
+	return nil
+}
+
+func output(l int, prefix string, format string, args ...interface{}) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if l < level {
+		return
+	}
+	std.Output(3, prefix+fmt.Sprintf(format, args...))
+}
+
+func Debugf(format string, args ...interface{}) { output(LevelDebug, "[DEBUG] ", format, args...) }
+func Infof(format string, args ...interface{})  { output(LevelInfo, "[INFO] ", format, args...) }
+func Warnf(format string, args ...interface{})  { output(LevelWarn, "[WARN] ", format, args...) }
+func Errorf(format string, args ...interface{}) { output(LevelError, "[ERROR] ", format, args...) }
@@ -0,0 +1,199 @@
+package logins
+
+import (
+	"cmd/agentmonitor/logger"
+	"cmd/agentmonitor/logwatch"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 检查文件变化的间隔
+const pollInterval = time.Second
+
+// 登录结果
+const (
+	Success = "success"
+	Failure = "failure"
+)
+
+// Event 一次 sshd 登录，同一来源、用户与认证方式在两次 Drain 之间的失败合并为一条，Count 为次数
+type Event struct {
+	Time        time.Time `json:"time"` // 日志中的时间，合并的失败为第一次失败的时间
+	Result      string    `json:"result"`
+	User        string    `json:"user"`
+	SourceIP    string    `json:"source_ip"`
+	Port        int       `json:"port"`   // 来源端口，合并的失败为第一次失败的端口
+	Method      string    `json:"method"` // password、publickey、keyboard-interactive/pam 等
+	InvalidUser bool      `json:"invalid_user,omitempty"`
+	Count       int       `json:"count"`
+	Message     string    `json:"message"`
+}
+
+var (
+	// sshd 的日志行，OpenSSH 9.8 起认证由 sshd-session 进程记录
+	sshdLine = regexp.MustCompile(`\bsshd(?:-session)?\[\d+\]: (.*)$`)
+	accepted = regexp.MustCompile(`^Accepted (\S+) for (\S+) from (\S+) port (\d+)`)
+	failed   = regexp.MustCompile(`^Failed (\S+) for (invalid user )?(\S*) from (\S+) port (\d+)`)
+	// rsyslog 合并的重复行
+	repeated = regexp.MustCompile(`^message repeated (\d+) times: \[ ?(.*?)\]?$`)
+)
+
+// Watcher 在后台跟踪认证日志，解析的登录事件缓存到下次 Drain
+type Watcher struct {
+	paths     []string
+	maxEvents int
+
+	mu       sync.Mutex
+	events   []Event
+	failures map[string]int // 合并失败的 key 到 events 下标
+	dropped  int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New 创建登录审计，maxEvents 为两次 Drain 之间缓存的事件数上限
+func New(paths []string, maxEvents int) *Watcher {
+	return &Watcher{
+		paths:     paths,
+		maxEvents: maxEvents,
+		failures:  map[string]int{},
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start 开始在后台跟踪所有认证日志
+func (w *Watcher) Start() {
+	go w.run()
+}
+
+// Close 停止跟踪并关闭所有文件
+func (w *Watcher) Close() error {
+	close(w.stop)
+	<-w.done
+	return nil
+}
+
+func (w *Watcher) run() {
+	defer close(w.done)
+
+	tailers := make([]*logwatch.Tailer, len(w.paths))
+	for i, path := range w.paths {
+		tailers[i] = logwatch.NewTailer(path)
+	}
+	defer func() {
+		for _, t := range tailers {
+			t.Close()
+		}
+	}()
+
+	// 同一个错误只记录一次，避免文件长期不可读时刷屏
+	lastErr := make([]string, len(w.paths))
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		for i, t := range tailers {
+			msg := ""
+			if err := t.Poll(func(line string) { w.parse(line, time.Now()) }); err != nil {
+				msg = err.Error()
+				if msg != lastErr[i] {
+					logger.Warnf("读取认证日志 %s 失败: %v", w.paths[i], err)
+				}
+			}
+			lastErr[i] = msg
+		}
+
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// parse 解析一行认证日志，只处理 sshd 的 Accepted 与 Failed 行
+func (w *Watcher) parse(line string, now time.Time) {
+	m := sshdLine.FindStringSubmatch(line)
+	if m == nil {
+		return
+	}
+	msg, count := m[1], 1
+	if r := repeated.FindStringSubmatch(msg); r != nil {
+		msg = r[2]
+		count, _ = strconv.Atoi(r[1])
+	}
+
+	e := Event{Time: lineTime(line, now), Count: count, Message: line}
+	if a := accepted.FindStringSubmatch(msg); a != nil {
+		e.Result, e.Method, e.User, e.SourceIP = Success, a[1], a[2], a[3]
+		e.Port, _ = strconv.Atoi(a[4])
+	} else if f := failed.FindStringSubmatch(msg); f != nil {
+		e.Result, e.Method, e.InvalidUser, e.User, e.SourceIP = Failure, f[1], f[2] != "", f[3], f[4]
+		e.Port, _ = strconv.Atoi(f[5])
+	} else {
+		return
+	}
+	w.add(e)
+}
+
+// add 缓存事件，失败与已缓存的同来源、用户与认证方式的失败合并
+func (w *Watcher) add(e Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var key string
+	if e.Result == Failure {
+		key = strings.Join([]string{e.SourceIP, e.User, e.Method, strconv.FormatBool(e.InvalidUser)}, "|")
+		if i, ok := w.failures[key]; ok {
+			w.events[i].Count += e.Count
+			return
+		}
+	}
+	if w.maxEvents > 0 && len(w.events) >= w.maxEvents {
+		w.dropped++
+		return
+	}
+	if key != "" {
+		w.failures[key] = len(w.events)
+	}
+	w.events = append(w.events, e)
+}
+
+// Drain 取出缓存的事件
+func (w *Watcher) Drain() []Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.dropped > 0 {
+		logger.Warnf("登录事件超出每次上报的上限 %d，丢弃 %d 条", w.maxEvents, w.dropped)
+		w.dropped = 0
+	}
+	events := w.events
+	w.events = nil
+	w.failures = map[string]int{}
+	return events
+}
+
+// lineTime 解析日志行开头的时间，支持 RFC 3339（rsyslog 的高精度格式）与传统 syslog 格式
+// syslog 格式没有年份，按本地时区取不晚于当前时间一天的最近一年；无法解析时使用 now
+func lineTime(line string, now time.Time) time.Time {
+	if i := strings.IndexByte(line, ' '); i > 0 {
+		if t, err := time.Parse(time.RFC3339Nano, line[:i]); err == nil {
+			return t.UTC()
+		}
+	}
+	if len(line) >= 15 {
+		if t, err := time.ParseInLocation(time.Stamp, line[:15], time.Local); err == nil {
+			t = t.AddDate(now.Year(), 0, 0)
+			if t.After(now.Add(24 * time.Hour)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			return t.UTC()
+		}
+	}
+	return now.UTC()
+}
@@ -0,0 +1,227 @@
+package logwatch
+
+import (
+	"cmd/agentmonitor/logger"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// 检查文件变化的间隔
+const pollInterval = time.Second
+
+// Rule 一条匹配规则，正则中的命名分组作为事件的字段
+type Rule struct {
+	Name     string
+	Pattern  *regexp.Regexp
+	Severity string // info、warning、error、critical
+	// 每个 RateWindow 内最多产生的事件数，超出的匹配只计数，0 表示不限制
+	RateLimit  int
+	RateWindow time.Duration
+}
+
+// File 一个被跟踪的日志文件及其规则，一行只产生第一条匹配规则的事件
+type File struct {
+	Path  string
+	Rules []Rule
+}
+
+// Event 一条匹配的日志
+type Event struct {
+	Time       time.Time         `json:"time"`
+	File       string            `json:"file"`
+	Rule       string            `json:"rule"`
+	Severity   string            `json:"severity"`
+	Message    string            `json:"message"`
+	Fields     map[string]string `json:"fields,omitempty"`
+	Suppressed int               `json:"suppressed,omitempty"` // 限流丢弃的同规则匹配数
+}
+
+// 每条规则的限流状态
+type rateState struct {
+	windowStart time.Time
+	count       int
+	suppressed  int
+}
+
+// Watcher 在后台跟踪日志文件，匹配的事件缓存到下次 Drain
+type Watcher struct {
+	files     []File
+	maxEvents int
+
+	mu      sync.Mutex
+	events  []Event
+	dropped int
+	rates   map[string]*rateState // key 为 文件路径|规则名
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New 创建日志监控，maxEvents 为两次 Drain 之间缓存的事件数上限
+func New(files []File, maxEvents int) *Watcher {
+	return &Watcher{
+		files:     files,
+		maxEvents: maxEvents,
+		rates:     map[string]*rateState{},
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start 开始在后台跟踪所有日志文件
+func (w *Watcher) Start() {
+	go w.run()
+}
+
+// Close 停止跟踪并关闭所有文件
+func (w *Watcher) Close() error {
+	close(w.stop)
+	<-w.done
+	return nil
+}
+
+func (w *Watcher) run() {
+	defer close(w.done)
+
+	tailers := make([]*Tailer, len(w.files))
+	for i, f := range w.files {
+		tailers[i] = NewTailer(f.Path)
+	}
+	defer func() {
+		for _, t := range tailers {
+			t.Close()
+		}
+	}()
+
+	// 同一个错误只记录一次，避免文件长期不可读时刷屏
+	lastErr := make([]string, len(w.files))
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		for i, t := range tailers {
+			f := w.files[i]
+			msg := ""
+			if err := t.Poll(func(line string) { w.match(f, line) }); err != nil {
+				msg = err.Error()
+				if msg != lastErr[i] {
+					logger.Warnf("读取日志文件 %s 失败: %v", f.Path, err)
+				}
+			}
+			lastErr[i] = msg
+		}
+
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// match 用文件的规则匹配一行日志
+func (w *Watcher) match(f File, line string) {
+	for _, r := range f.Rules {
+		m := r.Pattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		var fields map[string]string
+		for i, name := range r.Pattern.SubexpNames() {
+			if i == 0 || name == "" || m[i] == "" {
+				continue
+			}
+			if fields == nil {
+				fields = map[string]string{}
+			}
+			fields[name] = m[i]
+		}
+		w.add(f.Path, r, Event{
+			Time:     time.Now(),
+			File:     f.Path,
+			Rule:     r.Name,
+			Severity: r.Severity,
+			Message:  line,
+			Fields:   fields,
+		})
+		return
+	}
+}
+
+// add 按规则限流后缓存事件，窗口内被限流的数量附加到窗口结束后的第一条事件上
+func (w *Watcher) add(path string, r Rule, e Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if r.RateLimit > 0 {
+		key := path + "|" + r.Name
+		st, ok := w.rates[key]
+		if !ok {
+			st = &rateState{}
+			w.rates[key] = st
+		}
+		if e.Time.Sub(st.windowStart) >= r.RateWindow {
+			st.windowStart = e.Time
+			st.count = 0
+		}
+		if st.count >= r.RateLimit {
+			st.suppressed++
+			return
+		}
+		st.count++
+		e.Suppressed = st.suppressed
+		st.suppressed = 0
+	}
+
+	if w.maxEvents > 0 && len(w.events) >= w.maxEvents {
+		w.dropped++
+		return
+	}
+	w.events = append(w.events, e)
+}
+
+// Drain 取出缓存的事件
+// 限流中的规则在没有新事件时也会补一条汇总事件，保证被限流的数量最终被上报
+// 汇总事件同样计入 maxEvents，超出时丢弃较晚的普通事件；汇总事件本身超过上限时，其余规则的汇总留到下一次
+func (w *Watcher) Drain() []Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	var summaries []Event
+	for _, f := range w.files {
+		for _, r := range f.Rules {
+			st, ok := w.rates[f.Path+"|"+r.Name]
+			if !ok || st.suppressed == 0 || now.Sub(st.windowStart) < r.RateWindow {
+				continue
+			}
+			if w.maxEvents > 0 && len(summaries) >= w.maxEvents {
+				continue
+			}
+			summaries = append(summaries, Event{
+				Time:       now,
+				File:       f.Path,
+				Rule:       r.Name,
+				Severity:   r.Severity,
+				Message:    fmt.Sprintf("%v 内有 %d 条匹配被限流", r.RateWindow, st.suppressed),
+				Suppressed: st.suppressed,
+			})
+			st.suppressed = 0
+		}
+	}
+
+	events := w.events
+	w.events = nil
+	if w.maxEvents > 0 && len(events)+len(summaries) > w.maxEvents {
+		keep := w.maxEvents - len(summaries)
+		w.dropped += len(events) - keep
+		events = events[:keep]
+	}
+	if w.dropped > 0 {
+		logger.Warnf("日志事件超出每次上报的上限 %d，丢弃 %d 条", w.maxEvents, w.dropped)
+		w.dropped = 0
+	}
+	return append(events, summaries...)
+}
@@ -0,0 +1,148 @@
+package logwatch
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+)
+
+// 单行最大长度，超出部分被丢弃
+const maxLineBytes = 16 << 10
+
+// Tailer 跟踪一个日志文件，处理轮转（文件被重命名后重新创建）与截断
+// 启动时已存在的文件从末尾开始读取，之后出现的文件从头读取
+type Tailer struct {
+	path    string
+	started bool
+	file    *os.File
+	info    os.FileInfo
+	offset  int64
+	reader  *bufio.Reader
+	// 尚未读到换行符的半行
+	partial []byte
+}
+
+// NewTailer 创建日志文件跟踪，第一次 Poll 时打开文件
+func NewTailer(path string) *Tailer {
+	return &Tailer{path: path}
+}
+
+// open 打开文件，fromEnd 为 true 时从文件末尾开始读取
+func (t *Tailer) open(fromEnd bool) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	var offset int64
+	if fromEnd {
+		offset, err = f.Seek(0, io.SeekEnd)
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+	t.Close()
+	t.file = f
+	t.info = info
+	t.offset = offset
+	t.reader = bufio.NewReader(f)
+	t.partial = nil
+	return nil
+}
+
+// Close 关闭文件
+func (t *Tailer) Close() {
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+}
+
+// Poll 读取自上次以来新增的完整行
+// 文件被轮转时先读完旧文件再从头读取新文件，文件被截断时从头读取
+func (t *Tailer) Poll(fn func(line string)) error {
+	if t.file == nil {
+		// 启动时文件已存在则从末尾开始，避免重复上报历史日志；之后出现的文件从头读取
+		fromEnd := !t.started
+		t.started = true
+		if err := t.open(fromEnd); err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	t.readLines(fn)
+
+	info, err := os.Stat(t.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// 轮转过程中文件暂时不存在，下次再检查
+			return nil
+		}
+		return err
+	}
+	if !os.SameFile(info, t.info) {
+		// 文件已轮转，旧文件剩余内容已读完，打开新文件
+		t.flushPartial(fn)
+		if err := t.open(false); err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		t.readLines(fn)
+		return nil
+	}
+	if info.Size() < t.offset {
+		// 文件被截断
+		if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		t.offset = 0
+		t.reader.Reset(t.file)
+		t.partial = nil
+		t.readLines(fn)
+	}
+	return nil
+}
+
+func (t *Tailer) readLines(fn func(line string)) {
+	for {
+		chunk, err := t.reader.ReadSlice('\n')
+		t.offset += int64(len(chunk))
+		if len(t.partial) < maxLineBytes {
+			room := maxLineBytes - len(t.partial)
+			if len(chunk) > room {
+				t.partial = append(t.partial, chunk[:room]...)
+			} else {
+				t.partial = append(t.partial, chunk...)
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			// 没有换行符的半行留到下次读取
+			return
+		}
+		line := bytes.TrimRight(t.partial, "\r\n")
+		fn(string(line))
+		t.partial = t.partial[:0]
+	}
+}
+
+// flushPartial 轮转时旧文件最后一行可能没有换行符，按完整行处理
+func (t *Tailer) flushPartial(fn func(line string)) {
+	if len(t.partial) > 0 {
+		fn(string(bytes.TrimRight(t.partial, "\r\n")))
+		t.partial = nil
+	}
+}
@@ -1,40 +1,306 @@
 package main
 
 import (
+	"cmd/agentmonitor/config"
 	"cmd/agentmonitor/data"
+	"cmd/agentmonitor/logger"
+	"cmd/agentmonitor/version"
+	"context"
 	"flag"
 	"fmt"
-	"time"
-
-	"github.com/go-co-op/gocron"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 )
 
+// subcommand 一个子命令，run 返回进程的退出码：0 成功，1 失败，2 参数错误
+type subcommand struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+func subcommands() []subcommand {
+	return []subcommand{
+		{"run", "Run the agent (default when no subcommand is given)", runAgent},
+		{"collect", "Collect and print samples without sending them", runCollect},
+		{"check-server", "Check connectivity, authentication and clock skew against the server", runCheckServer},
+		{"diag", "Write a diagnostics tarball with config, logs, spool state and a sample", runDiag},
+		{"version", "Print the agent version", func([]string) int {
+			fmt.Println(version.Version)
+			return 0
+		}},
+	}
+}
+
 func main() {
-	// 定义一个字符串变量，用来接收传入的 host_name 与token参数
-	hostName := flag.String("host_name", "", "The hostname for the agent")
-	token := flag.String("token", "", "A string of 16 characters")
-
-	// 解析命令行参数
-	flag.Parse()
-
-	// 定义服务器端点的URL
-	serverURL := "http://192.168.51.28:8080/agent/system_info" // 你的服务器URL
-
-	//创建调度器
-	s := gocron.NewScheduler(time.UTC)
-	// 每分钟执行一次任务
-	s.Every(1).Minute().Do(func() {
-		// 收集监控数据
-		datas, err := data.CollectMonitorData(*hostName, *token)
+	// 未指定子命令或第一个参数为选项时按 run 处理，兼容安装脚本 main -host_name=... -token=... 的启动方式
+	name, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		usage(os.Stdout)
+		return
+	}
+	for _, sc := range subcommands() {
+		if sc.name == name {
+			os.Exit(sc.run(args))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "未知的子命令 %q\n\n", name)
+	usage(os.Stderr)
+	os.Exit(2)
+}
+
+func usage(out io.Writer) {
+	fmt.Fprintf(out, "Usage: %s [subcommand] [options]\n\nSubcommands:\n", filepath.Base(os.Args[0]))
+	for _, sc := range subcommands() {
+		fmt.Fprintf(out, "  %-14s %s\n", sc.name, sc.summary)
+	}
+	fmt.Fprintf(out, "\nRun '%s <subcommand> -h' for the options of a subcommand.\n", filepath.Base(os.Args[0]))
+}
+
+// options 各子命令共用的配置参数
+type options struct {
+	configPath string
+	hostName   string
+	token      string
+}
+
+// newFlagSet 创建子命令的参数集，包含配置文件路径，以及兼容安装脚本的 host_name 与 token 参数（优先级高于配置文件与环境变量）
+func newFlagSet(name string, o *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.StringVar(&o.configPath, "config", "", "Path to the agent YAML config file")
+	fs.StringVar(&o.hostName, "host_name", "", "The hostname for the agent")
+	fs.StringVar(&o.token, "token", "", "A string of 16 characters")
+	return fs
+}
+
+// load 加载本地配置并合并服务器下发的配置
+func (o *options) load(remote []byte, etag string) (*config.Config, error) {
+	cfg, err := config.Load(o.configPath)
+	if err != nil {
+		return nil, fmt.Errorf("加载配置失败: %v", err)
+	}
+	if o.hostName != "" {
+		cfg.HostName = o.hostName
+	}
+	if o.token != "" {
+		cfg.Token = o.token
+	}
+	if err := cfg.ApplyRemote(remote, etag); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("配置校验失败:\n%v", err)
+	}
+	return cfg, nil
+}
+
+// loadCached 加载本地配置并合并本地保存的下发配置，不连接服务器；保存的下发配置无效时只使用本地配置
+func (o *options) loadCached() (*config.Config, error) {
+	cfg, err := o.load(nil, "")
+	if err != nil || !cfg.RemoteConfigEnabled() {
+		return cfg, err
+	}
+	content, etag, ok := data.NewRemoteConfigFetcher(nil, cfg).Latest()
+	if !ok {
+		return cfg, nil
+	}
+	merged, err := o.load(content, etag)
+	if err != nil {
+		logger.Warnf("保存的下发配置 %s 无效，只使用本地配置: %v", etag, err)
+		return cfg, nil
+	}
+	return merged, nil
+}
+
+// runAgent 常驻运行 agent，直到收到 SIGTERM 或 SIGINT
+func runAgent(args []string) int {
+	var o options
+	fs := newFlagSet("run", &o)
+	showVersion := fs.Bool("version", false, "Print the agent version and exit")
+	fs.Parse(args)
+
+	if *showVersion {
+		fmt.Println(version.Version)
+		return 0
+	}
+
+	// 加载配置前先检查升级状态，刚升级的新版本无法加载现有配置时回滚到旧版本
+	g := newUpgrader()
+
+	// 先只加载本地配置，合并下发的配置后再次加载；SIGHUP 与下发的配置变化时按相同的方式重新加载
+	cfg, err := o.load(nil, "")
+	if err != nil {
+		g.fatal(err)
+	}
+	if err := logger.Init(cfg.Log.Level, cfg.Log.File); err != nil {
+		g.fatal(fmt.Errorf("初始化日志失败: %v", err))
+	}
+
+	// 启动时获取下发的配置，服务器不可达时使用本地保存的上一份配置；下发的配置无效时只使用本地配置
+	// seen 为最近一次处理过的下发配置版本，无效的配置不会在每次心跳后重复尝试
+	var remote []byte
+	var remoteETag, seen string
+	if content, etag, ok := fetchRemoteConfig(cfg); ok {
+		seen = etag
+		merged, err := o.load(content, etag)
 		if err != nil {
-			fmt.Println("收集数据错误")
+			logger.Errorf("下发的配置 %s 无效，只使用本地配置: %v", etag, err)
+		} else {
+			cfg, remote, remoteETag = merged, content, etag
+			if err := logger.Init(cfg.Log.Level, cfg.Log.File); err != nil {
+				g.fatal(fmt.Errorf("初始化日志失败: %v", err))
+			}
+		}
+	}
+
+	// 心跳结果交给主循环处理，用于升级后的确认与自动升级；主循环繁忙时丢弃
+	beats := make(chan beatResult, 1)
+	onBeat := func(resp data.HeartbeatResponse, err error) {
+		select {
+		case beats <- beatResult{resp: resp, err: err}:
+		default:
+		}
+	}
+
+	a, err := startAgent(cfg, onBeat)
+	if err != nil {
+		g.fatal(err)
+	}
+	logStarted(cfg)
+	g.started(a)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	for {
+		select {
+		case sig := <-sigs:
+			if sig != syscall.SIGHUP {
+				logger.Infof("收到信号 %v，等待当前采集周期完成后退出", sig)
+				a.stop()
+				g.stopped()
+				logger.Infof("agent 已停止")
+				return 0
+			}
+			logger.Infof("收到 SIGHUP，重新加载配置")
+			a = reload(a, func() (*config.Config, error) { return o.load(remote, remoteETag) }, onBeat)
+			g.started(a)
+		case b := <-beats:
+			g.beat(a, b)
+			// 心跳后获取的下发配置有变化时重新加载
+			if a.remote == nil {
+				continue
+			}
+			content, etag, ok := a.remote.Latest()
+			if !ok || etag == seen {
+				continue
+			}
+			seen = etag
+			logger.Infof("下发的配置变化为 %s，重新加载配置", etag)
+			a = reload(a, func() (*config.Config, error) { return o.load(content, etag) }, onBeat)
+			if a.cfg.RemoteETag == etag {
+				remote, remoteETag = content, etag
+			}
+			g.started(a)
+		case v := <-g.failed:
+			g.downloadFailed(v)
+		case info := <-g.ready:
+			a = g.apply(a, info, onBeat)
+		}
+	}
+}
+
+// reload 重新加载配置并按新配置重建所有任务，新配置无效时继续使用原配置
+func reload(a *agent, loadConfig func() (*config.Config, error), onBeat func(data.HeartbeatResponse, error)) *agent {
+	cfg, err := loadConfig()
+	if err != nil {
+		logger.Errorf("重新加载配置失败，继续使用原配置: %v", err)
+		return a
+	}
+	if cfg.Equal(a.cfg) {
+		logger.Infof("配置未变化，无需重新加载")
+		return a
+	}
+
+	a.stop()
+	if err := logger.Init(cfg.Log.Level, cfg.Log.File); err != nil {
+		logger.Errorf("重新初始化日志失败: %v", err)
+	}
+	next, err := startAgent(cfg, onBeat)
+	if err != nil {
+		// 新配置通过了校验但无法启动（如 metrics 端口被占用），恢复原配置
+		logger.Errorf("按新配置启动失败，恢复原配置: %v", err)
+		if err := logger.Init(a.cfg.Log.Level, a.cfg.Log.File); err != nil {
+			logger.Errorf("重新初始化日志失败: %v", err)
 		}
-		// 发送收集到的数据到服务器
-		err = data.SendMonitorData(serverURL, datas)
+		next, err = startAgent(a.cfg, onBeat)
 		if err != nil {
-			fmt.Printf("发送数据错误%v", err)
+			log.Fatalf("恢复原配置失败: %v", err)
 		}
-	})
-	s.StartBlocking()
+		return next
+	}
+
+	logger.Infof("配置已重新加载，配置摘要 %.12s -> %.12s，采集器 %v", a.cfg.Hash(), cfg.Hash(), next.reg.Names())
+	logStarted(cfg)
+	return next
+}
+
+// startAgent 按配置创建并启动 agent，启动失败时停止已启动的部分
+// 每次心跳成功后获取下发的配置，然后调用 onBeat
+func startAgent(cfg *config.Config, onBeat func(data.HeartbeatResponse, error)) (*agent, error) {
+	a, err := newAgent(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if a.heartbeater != nil {
+		a.heartbeater.OnBeat(func(resp data.HeartbeatResponse, err error) {
+			if err == nil && a.remote != nil {
+				if err := a.remote.Fetch(a.taskCtx); err != nil && a.taskCtx.Err() == nil {
+					logger.Warnf("获取下发的配置失败: %v", err)
+				}
+			}
+			onBeat(resp, err)
+		})
+	}
+	if err := a.start(); err != nil {
+		a.stop()
+		return nil, err
+	}
+	return a, nil
+}
+
+// fetchRemoteConfig 获取下发的配置，获取失败时返回本地保存的上一份配置，都没有时 ok 为 false
+func fetchRemoteConfig(cfg *config.Config) (content []byte, etag string, ok bool) {
+	if !cfg.RemoteConfigEnabled() {
+		return nil, "", false
+	}
+	client, err := data.NewHTTPClient(cfg)
+	if err != nil {
+		logger.Errorf("创建 HTTP 客户端失败: %v", err)
+		return nil, "", false
+	}
+	f := data.NewRemoteConfigFetcher(client, cfg)
+	if err := f.Fetch(context.Background()); err != nil {
+		logger.Warnf("获取下发的配置失败: %v", err)
+	}
+	return f.Latest()
+}
 
+func logStarted(cfg *config.Config) {
+	if cfg.Server.Disabled {
+		logger.Infof("agent %s 启动，采集周期 %v，不向服务器推送数据", version.Version, cfg.Interval)
+		return
+	}
+	if cfg.RemoteETag != "" {
+		logger.Infof("agent %s 启动，采集周期 %v，服务器 %v，下发配置 %s", version.Version, cfg.Interval, cfg.Server.URLs, cfg.RemoteETag)
+		return
+	}
+	logger.Infof("agent %s 启动，采集周期 %v，服务器 %v", version.Version, cfg.Interval, cfg.Server.URLs)
 }
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// 指标类型
+const (
+	Gauge   = "gauge"
+	Counter = "counter"
+)
+
+// Label 指标标签
+type Label struct {
+	Name  string
+	Value string
+}
+
+type sample struct {
+	labels []Label
+	value  float64
+}
+
+// family 同名指标的所有样本，输出时 HELP、TYPE 只出现一次且样本连续
+type family struct {
+	name    string
+	help    string
+	typ     string
+	samples []sample
+}
+
+// Writer 按 Prometheus 文本格式（0.0.4）收集并输出指标，指标按首次添加的顺序输出
+type Writer struct {
+	families []*family
+	byName   map[string]*family
+}
+
+func newWriter() *Writer {
+	return &Writer{byName: map[string]*family{}}
+}
+
+// Add 添加一个样本，同名指标的 help 与类型以首次添加的为准
+func (w *Writer) Add(name, typ, help string, value float64, labels ...Label) {
+	f, ok := w.byName[name]
+	if !ok {
+		f = &family{name: name, help: help, typ: typ}
+		w.byName[name] = f
+		w.families = append(w.families, f)
+	}
+	f.samples = append(f.samples, sample{labels: labels, value: value})
+}
+
+// WriteTo 输出所有指标
+func (w *Writer) WriteTo(out io.Writer) (int64, error) {
+	bw := bufio.NewWriter(out)
+	var n int64
+	write := func(s string) {
+		m, _ := bw.WriteString(s)
+		n += int64(m)
+	}
+	for _, f := range w.families {
+		write("# HELP " + f.name + " " + escapeHelp(f.help) + "\n")
+		write("# TYPE " + f.name + " " + f.typ + "\n")
+		for _, s := range f.samples {
+			write(f.name)
+			if len(s.labels) > 0 {
+				write("{")
+				for i, l := range s.labels {
+					if i > 0 {
+						write(",")
+					}
+					write(l.Name + `="` + escapeLabel(l.Value) + `"`)
+				}
+				write("}")
+			}
+			write(" " + formatValue(s.value) + "\n")
+		}
+	}
+	return n, bw.Flush()
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,242 @@
+package metrics
+
+import (
+	"cmd/agentmonitor/logger"
+	"cmd/agentmonitor/monitor"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ContentType Prometheus 文本格式的 Content-Type
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Store 保存各采集器最近一次的数据，被抓取时输出为 Prometheus 指标
+// 采集器的周期各不相同，未到周期的采集器沿用上一次的数据
+type Store struct {
+	mu          sync.RWMutex
+	collectedAt time.Time
+	host        *monitor.HostInfo
+	cpu         []monitor.CPUInfo
+	mem         *monitor.MemoryInfo
+	process     *monitor.ProcessSummary
+	network     []monitor.NetworkInfo
+	disk        []monitor.DiskInfo
+	diskIO      []monitor.DiskIOInfo
+	conn        *monitor.ConnInfo
+	sessions    []monitor.Session // 为 nil 时未采集
+}
+
+// NewStore 创建空的指标存储
+func NewStore() *Store {
+	return &Store{}
+}
+
+// Update 用一次采集的结果更新指标，sections 为以字段名为 key 的采集数据
+func (s *Store) Update(host monitor.HostInfo, collectedAt time.Time, sections map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.collectedAt = collectedAt
+	s.host = &host
+	for _, v := range sections {
+		switch v := v.(type) {
+		case []monitor.CPUInfo:
+			s.cpu = v
+		case monitor.MemoryInfo:
+			s.mem = &v
+		case monitor.ProcessSummary:
+			s.process = &v
+		case []monitor.NetworkInfo:
+			s.network = v
+		case []monitor.DiskInfo:
+			s.disk = v
+		case []monitor.DiskIOInfo:
+			s.diskIO = v
+		case monitor.ConnInfo:
+			s.conn = &v
+		case []monitor.Session:
+			s.sessions = v
+		}
+	}
+}
+
+// ServeHTTP 输出所有指标
+func (s *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	if _, err := s.WriteTo(w); err != nil {
+		logger.Debugf("输出 metrics 失败: %v", err)
+	}
+}
+
+// WriteTo 按 Prometheus 文本格式输出所有指标
+func (s *Store) WriteTo(out io.Writer) (int64, error) {
+	mw := newWriter()
+	s.write(mw)
+	return mw.WriteTo(out)
+}
+
+// Listen 在 addr 上监听并在 path 提供指标，监听失败时立即返回错误，返回的 Server 用于停止服务
+func Listen(addr, path string, s *Store) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("监听 metrics 地址 %s 失败: %v", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(path, s)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logger.Errorf("metrics 服务退出: %v", err)
+		}
+	}()
+	return srv, nil
+}
+
+func (s *Store) write(w *Writer) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.collectedAt.IsZero() {
+		w.Add("agent_last_collect_timestamp_seconds", Gauge, "最近一次采集的时间（Unix 秒）", float64(s.collectedAt.UnixNano())/1e9)
+	}
+
+	if h := s.host; h != nil {
+		w.Add("agent_host_info", Gauge, "主机信息，值恒为 1", 1,
+			Label{"hostname", h.Hostname}, Label{"os", h.OS}, Label{"platform", h.Platform}, Label{"kernel_arch", h.KernelArch},
+			Label{"virtualization_system", h.VirtualizationSystem}, Label{"virtualization_role", h.VirtualizationRole})
+		w.Add("agent_boot_time_seconds", Gauge, "系统启动时间（Unix 秒）", float64(h.BootTime))
+		w.Add("agent_uptime_seconds", Gauge, "系统运行时长（秒）", float64(h.Uptime))
+		w.Add("agent_load1", Gauge, "1 分钟平均负载", h.Load1)
+		w.Add("agent_load5", Gauge, "5 分钟平均负载", h.Load5)
+		w.Add("agent_load15", Gauge, "15 分钟平均负载", h.Load15)
+	}
+
+	if len(s.cpu) > 0 {
+		w.Add("agent_cpu_usage_percent", Gauge, "整机 CPU 使用率（%）", s.cpu[0].Percent)
+		w.Add("agent_cpu_count", Gauge, "逻辑 CPU 数", float64(len(s.cpu)))
+		for _, c := range s.cpu {
+			cpu := Label{"cpu", strconv.Itoa(c.CPU)}
+			w.Add("agent_cpu_core_usage_percent", Gauge, "逻辑 CPU 的使用率（%）", c.CorePercent, cpu)
+			for _, m := range []struct {
+				mode  string
+				value float64
+			}{
+				{"user", c.User}, {"system", c.System}, {"idle", c.Idle}, {"nice", c.Nice},
+				{"iowait", c.Iowait}, {"irq", c.Irq}, {"softirq", c.Softirq}, {"steal", c.Steal},
+			} {
+				w.Add("agent_cpu_mode_percent", Gauge, "逻辑 CPU 在采样周期内各状态的时间占比（%）", m.value, cpu, Label{"mode", m.mode})
+			}
+		}
+	}
+
+	if m := s.mem; m != nil {
+		w.Add("agent_memory_total_bytes", Gauge, "内存总量（字节）", float64(m.TotalBytes))
+		w.Add("agent_memory_available_bytes", Gauge, "可用内存（字节）", float64(m.AvailableBytes))
+		w.Add("agent_memory_used_bytes", Gauge, "已用内存（字节）", float64(m.UsedBytes))
+		w.Add("agent_memory_free_bytes", Gauge, "空闲内存（字节）", float64(m.FreeBytes))
+		w.Add("agent_memory_used_percent", Gauge, "内存使用率（%）", m.UserPercent)
+		w.Add("agent_swap_total_bytes", Gauge, "交换分区总量（字节）", float64(m.SwapTotalBytes))
+		w.Add("agent_swap_used_bytes", Gauge, "交换分区已用（字节）", float64(m.SwapUsedBytes))
+		w.Add("agent_swap_used_percent", Gauge, "交换分区使用率（%）", m.SwapPercent)
+	}
+
+	for _, n := range s.network {
+		iface := Label{"interface", n.Name}
+		w.Add("agent_network_receive_bytes_total", Counter, "网卡累计接收字节数", float64(n.BytesRecv), iface)
+		w.Add("agent_network_transmit_bytes_total", Counter, "网卡累计发送字节数", float64(n.BytesSent), iface)
+		w.Add("agent_network_receive_packets_total", Counter, "网卡累计接收包数", float64(n.PacketsRecv), iface)
+		w.Add("agent_network_transmit_packets_total", Counter, "网卡累计发送包数", float64(n.PacketsSent), iface)
+		w.Add("agent_network_receive_errors_total", Counter, "网卡累计接收错误数", float64(n.Errin), iface)
+		w.Add("agent_network_transmit_errors_total", Counter, "网卡累计发送错误数", float64(n.Errout), iface)
+		w.Add("agent_network_receive_drop_total", Counter, "网卡累计接收丢包数", float64(n.Dropin), iface)
+		w.Add("agent_network_transmit_drop_total", Counter, "网卡累计发送丢包数", float64(n.Dropout), iface)
+	}
+
+	for _, d := range s.disk {
+		labels := []Label{{"device", d.Device}, {"mountpoint", d.Mountpoint}, {"fstype", d.Fstype}}
+		w.Add("agent_filesystem_size_bytes", Gauge, "文件系统总大小（字节）", float64(d.Total), labels...)
+		w.Add("agent_filesystem_used_bytes", Gauge, "文件系统已用（字节）", float64(d.Used), labels...)
+		w.Add("agent_filesystem_free_bytes", Gauge, "文件系统空闲（字节）", float64(d.Free), labels...)
+		w.Add("agent_filesystem_used_percent", Gauge, "文件系统使用率（%）", d.UsedPercent, labels...)
+		w.Add("agent_filesystem_inodes", Gauge, "文件系统 inode 总数", float64(d.InodesTotal), labels...)
+		w.Add("agent_filesystem_inodes_used", Gauge, "文件系统已用 inode 数", float64(d.InodesUsed), labels...)
+	}
+
+	for _, d := range s.diskIO {
+		device := Label{"device", d.Name}
+		w.Add("agent_disk_read_bytes_total", Counter, "块设备累计读取字节数", float64(d.ReadBytes), device)
+		w.Add("agent_disk_written_bytes_total", Counter, "块设备累计写入字节数", float64(d.WriteBytes), device)
+		w.Add("agent_disk_reads_completed_total", Counter, "块设备累计读操作次数", float64(d.ReadCount), device)
+		w.Add("agent_disk_writes_completed_total", Counter, "块设备累计写操作次数", float64(d.WriteCount), device)
+		w.Add("agent_disk_io_time_seconds_total", Counter, "块设备累计 I/O 耗时（秒）", float64(d.IoTime)/1000, device)
+		w.Add("agent_disk_io_time_weighted_seconds_total", Counter, "块设备累计加权 I/O 耗时（秒）", float64(d.WeightedIO)/1000, device)
+	}
+
+	if c := s.conn; c != nil {
+		states := make([]string, 0, len(c.States))
+		for state := range c.States {
+			states = append(states, state)
+		}
+		sort.Strings(states)
+		for _, state := range states {
+			w.Add("agent_tcp_connections", Gauge, "各状态的 TCP 连接数", float64(c.States[state]), Label{"state", state})
+		}
+		for _, l := range c.Listen {
+			w.Add("agent_listen_info", Gauge, "监听端口，值恒为 1", 1,
+				Label{"proto", l.Proto}, Label{"ip", l.IP}, Label{"port", strconv.FormatUint(uint64(l.Port), 10)}, Label{"pid", strconv.Itoa(int(l.PID))})
+		}
+	}
+
+	if s.sessions != nil {
+		w.Add("agent_login_sessions", Gauge, "当前的登录会话数", float64(len(s.sessions)))
+		byUser := map[string]int{}
+		for _, se := range s.sessions {
+			byUser[se.User]++
+		}
+		users := make([]string, 0, len(byUser))
+		for user := range byUser {
+			users = append(users, user)
+		}
+		sort.Strings(users)
+		for _, user := range users {
+			w.Add("agent_user_login_sessions", Gauge, "用户当前的登录会话数", float64(byUser[user]), Label{"user", user})
+		}
+	}
+
+	if p := s.process; p != nil {
+		w.Add("agent_processes", Gauge, "进程总数", float64(p.Total))
+		// CPU 与内存占用最高的进程可能重复，按 PID 去重
+		seen := map[int]bool{}
+		for _, list := range [][]monitor.ProcessInfo{p.TopCPU, p.TopMem} {
+			for _, pi := range list {
+				if seen[pi.PID] {
+					continue
+				}
+				seen[pi.PID] = true
+				labels := []Label{{"pid", strconv.Itoa(pi.PID)}, {"name", pi.Name}, {"user", pi.Username}}
+				w.Add("agent_process_cpu_percent", Gauge, "CPU 或内存占用最高的进程的 CPU 使用率（%）", pi.CPUPercent, labels...)
+				w.Add("agent_process_memory_percent", Gauge, "CPU 或内存占用最高的进程的内存使用率（%）", float64(pi.MemPercent), labels...)
+				w.Add("agent_process_resident_memory_bytes", Gauge, "CPU 或内存占用最高的进程的常驻内存（字节）", float64(pi.RSS), labels...)
+			}
+		}
+		for _, g := range p.ByName {
+			name := Label{"name", g.Name}
+			w.Add("agent_process_group_count", Gauge, "同名进程数", float64(g.Count), name)
+			w.Add("agent_process_group_cpu_percent", Gauge, "同名进程的 CPU 使用率之和（%）", g.CPUPercent, name)
+			w.Add("agent_process_group_memory_percent", Gauge, "同名进程的内存使用率之和（%）", g.MemPercent, name)
+			w.Add("agent_process_group_resident_memory_bytes", Gauge, "同名进程的常驻内存之和（字节）", float64(g.RSS), name)
+		}
+		for _, g := range p.ByUser {
+			user := Label{"user", g.Name}
+			w.Add("agent_user_process_count", Gauge, "用户的进程数", float64(g.Count), user)
+			w.Add("agent_user_cpu_percent", Gauge, "用户进程的 CPU 使用率之和（%）", g.CPUPercent, user)
+			w.Add("agent_user_memory_percent", Gauge, "用户进程的内存使用率之和（%）", g.MemPercent, user)
+			w.Add("agent_user_resident_memory_bytes", Gauge, "用户进程的常驻内存之和（字节）", float64(g.RSS), user)
+		}
+	}
+}
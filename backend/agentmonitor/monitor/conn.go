@@ -0,0 +1,110 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/shirou/gopsutil/net"
+	"github.com/shirou/gopsutil/process"
+)
+
+// 定义监听端口结构体
+type ListenPort struct {
+	Proto   string `json:"proto"` // tcp、tcp6、udp、udp6
+	IP      string `json:"ip"`
+	Port    uint32 `json:"port"`
+	PID     int32  `json:"pid"`
+	Cmdline string `json:"cmdline"`
+}
+
+// 定义连接状态信息结构体
+type ConnInfo struct {
+	ID        int            `json:"id"`
+	States    map[string]int `json:"states"` // 各 TCP 状态的连接数，如 ESTABLISHED、TIME_WAIT、CLOSE_WAIT
+	Listen    []ListenPort   `json:"listen"`
+	CreatedAt time.Time      `json:"conn_info_created_at"`
+}
+
+// 获取 TCP 连接状态统计与监听端口
+func GetConnInfo(ctx context.Context) (ConnInfo, error) {
+	conns, err := net.ConnectionsWithContext(ctx, "inet")
+	if err != nil {
+		return ConnInfo{}, fmt.Errorf("获取网络连接失败: %v", err)
+	}
+
+	connInfo := ConnInfo{
+		States:    make(map[string]int),
+		CreatedAt: time.Now(),
+	}
+	cmdlines := make(map[int32]string)
+	seen := make(map[string]bool)
+
+	for _, c := range conns {
+		proto := connProto(c)
+		if proto == "" {
+			continue
+		}
+
+		listening := false
+		if c.Type == syscall.SOCK_STREAM {
+			connInfo.States[c.Status]++
+			listening = c.Status == "LISTEN"
+		} else {
+			// UDP 没有连接状态，未连接对端的套接字视为监听
+			listening = c.Raddr.IP == "" && c.Laddr.Port != 0
+		}
+		if !listening {
+			continue
+		}
+
+		key := fmt.Sprintf("%s|%s|%d", proto, c.Laddr.IP, c.Laddr.Port)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		cmdline, ok := cmdlines[c.Pid]
+		if !ok && c.Pid > 0 {
+			if p, err := process.NewProcessWithContext(ctx, c.Pid); err == nil {
+				cmdline, _ = p.CmdlineWithContext(ctx)
+			}
+			cmdlines[c.Pid] = cmdline
+		}
+
+		connInfo.Listen = append(connInfo.Listen, ListenPort{
+			Proto:   proto,
+			IP:      c.Laddr.IP,
+			Port:    c.Laddr.Port,
+			PID:     c.Pid,
+			Cmdline: cmdline,
+		})
+	}
+
+	sort.Slice(connInfo.Listen, func(i, j int) bool {
+		if connInfo.Listen[i].Port != connInfo.Listen[j].Port {
+			return connInfo.Listen[i].Port < connInfo.Listen[j].Port
+		}
+		return connInfo.Listen[i].Proto < connInfo.Listen[j].Proto
+	})
+	return connInfo, nil
+}
+
+// connProto 根据套接字类型与地址族返回协议名
+func connProto(c net.ConnectionStat) string {
+	var proto string
+	switch c.Type {
+	case syscall.SOCK_STREAM:
+		proto = "tcp"
+	case syscall.SOCK_DGRAM:
+		proto = "udp"
+	default:
+		return ""
+	}
+	if c.Family == syscall.AF_INET6 {
+		proto += "6"
+	}
+	return proto
+}
@@ -0,0 +1,58 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/shirou/gopsutil/disk"
+)
+
+// 定义磁盘分区信息结构体
+type DiskInfo struct {
+	ID          int       `json:"id"`
+	Device      string    `json:"device"`
+	Mountpoint  string    `json:"mountpoint"`
+	Fstype      string    `json:"fstype"`
+	Total       uint64    `json:"total"` // 总字节数
+	Used        uint64    `json:"used"`  // 已用字节数
+	Free        uint64    `json:"free"`  // 空闲字节数
+	UsedPercent float64   `json:"used_percent"`
+	InodesTotal uint64    `json:"inodes_total"`
+	InodesUsed  uint64    `json:"inodes_used"`
+	CreatedAt   time.Time `json:"disk_info_created_at"`
+}
+
+// 获取磁盘分区信息
+func GetDiskInfo(ctx context.Context) ([]DiskInfo, error) {
+	partitions, err := disk.PartitionsWithContext(ctx, false) // false 只获取物理设备的分区
+	if err != nil {
+		return nil, fmt.Errorf("获取磁盘分区失败: %v", err)
+	}
+
+	var diskInfos []DiskInfo
+	for _, p := range partitions {
+		usage, err := disk.UsageWithContext(ctx, p.Mountpoint)
+		if err != nil {
+			// 无权限或已卸载的挂载点直接跳过
+			continue
+		}
+
+		usedPercent, _ := strconv.ParseFloat(fmt.Sprintf("%.2f", usage.UsedPercent), 64)
+		diskInfos = append(diskInfos, DiskInfo{
+			Device:      p.Device,
+			Mountpoint:  p.Mountpoint,
+			Fstype:      p.Fstype,
+			Total:       usage.Total,
+			Used:        usage.Used,
+			Free:        usage.Free,
+			UsedPercent: usedPercent,
+			InodesTotal: usage.InodesTotal,
+			InodesUsed:  usage.InodesUsed,
+			CreatedAt:   time.Now(),
+		})
+	}
+
+	return diskInfos, nil
+}
@@ -0,0 +1,112 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/disk"
+)
+
+// 定义块设备 I/O 信息结构体
+// 累计值直接取自内核计数器，速率与利用率由相邻两次采集的差值计算，首次采集时为 0
+type DiskIOInfo struct {
+	ID               int       `json:"id"`
+	Name             string    `json:"name"`
+	ReadBytes        uint64    `json:"read_bytes"`         // 累计读取字节数
+	WriteBytes       uint64    `json:"write_bytes"`        // 累计写入字节数
+	ReadCount        uint64    `json:"read_count"`         // 累计读操作次数
+	WriteCount       uint64    `json:"write_count"`        // 累计写操作次数
+	IoTime           uint64    `json:"io_time"`            // 累计 I/O 耗时(ms)
+	WeightedIO       uint64    `json:"weighted_io"`        // 累计加权 I/O 耗时(ms)
+	ReadBytesPerSec  float64   `json:"read_bytes_per_sec"` // 读取速率(B/s)
+	WriteBytesPerSec float64   `json:"write_bytes_per_sec"`
+	ReadOpsPerSec    float64   `json:"read_ops_per_sec"` // 读 IOPS
+	WriteOpsPerSec   float64   `json:"write_ops_per_sec"`
+	AwaitMs          float64   `json:"await_ms"`    // 平均每次 I/O 耗时(ms)
+	QueueDepth       float64   `json:"queue_depth"` // 平均队列深度
+	Util             float64   `json:"util"`        // 设备繁忙时间占比(%)
+	CreatedAt        time.Time `json:"diskio_info_created_at"`
+}
+
+// 上一次采集的计数器，用于计算速率
+var (
+	diskIOMu       sync.Mutex
+	lastDiskIO     map[string]disk.IOCountersStat
+	lastDiskIOTime time.Time
+)
+
+// 获取块设备 I/O 信息
+func GetDiskIOInfo(ctx context.Context) ([]DiskIOInfo, error) {
+	counters, err := disk.IOCountersWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取磁盘IO信息失败: %v", err)
+	}
+	now := time.Now()
+
+	diskIOMu.Lock()
+	defer diskIOMu.Unlock()
+
+	elapsed := now.Sub(lastDiskIOTime).Seconds()
+
+	var diskIOInfos []DiskIOInfo
+	for name, io := range counters {
+		info := DiskIOInfo{
+			Name:       name,
+			ReadBytes:  io.ReadBytes,
+			WriteBytes: io.WriteBytes,
+			ReadCount:  io.ReadCount,
+			WriteCount: io.WriteCount,
+			IoTime:     io.IoTime,
+			WeightedIO: io.WeightedIO,
+			CreatedAt:  now,
+		}
+
+		if prev, ok := lastDiskIO[name]; ok && elapsed > 0 {
+			readOps := counterDelta(prev.ReadCount, io.ReadCount)
+			writeOps := counterDelta(prev.WriteCount, io.WriteCount)
+			ioTime := counterDelta(prev.ReadTime, io.ReadTime) + counterDelta(prev.WriteTime, io.WriteTime)
+
+			info.ReadBytesPerSec = round2(float64(counterDelta(prev.ReadBytes, io.ReadBytes)) / elapsed)
+			info.WriteBytesPerSec = round2(float64(counterDelta(prev.WriteBytes, io.WriteBytes)) / elapsed)
+			info.ReadOpsPerSec = round2(float64(readOps) / elapsed)
+			info.WriteOpsPerSec = round2(float64(writeOps) / elapsed)
+			if readOps+writeOps > 0 {
+				info.AwaitMs = round2(float64(ioTime) / float64(readOps+writeOps))
+			}
+			info.QueueDepth = round2(float64(counterDelta(prev.WeightedIO, io.WeightedIO)) / (elapsed * 1000))
+			util := float64(counterDelta(prev.IoTime, io.IoTime)) / (elapsed * 1000) * 100
+			if util > 100 {
+				util = 100
+			}
+			info.Util = round2(util)
+		}
+		diskIOInfos = append(diskIOInfos, info)
+	}
+
+	lastDiskIO = counters
+	lastDiskIOTime = now
+
+	sort.Slice(diskIOInfos, func(i, j int) bool {
+		return diskIOInfos[i].Name < diskIOInfos[j].Name
+	})
+	return diskIOInfos, nil
+}
+
+// counterDelta 计算累计计数器的增量
+// 计数器变小时视为被重置（如网卡重新加载、设备重新挂载），本次增量为 0，下次从当前值开始计算
+func counterDelta(prev, cur uint64) uint64 {
+	if cur < prev {
+		return 0
+	}
+	return cur - prev
+}
+
+// 保留两位小数
+func round2(f float64) float64 {
+	r, _ := strconv.ParseFloat(fmt.Sprintf("%.2f", f), 64)
+	return r
+}
@@ -1,13 +1,17 @@
 package monitor
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"sort"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/shirou/gopsutil/cpu"
 	"github.com/shirou/gopsutil/host"
+	"github.com/shirou/gopsutil/load"
 	"github.com/shirou/gopsutil/mem"
 	"github.com/shirou/gopsutil/net"
 	"github.com/shirou/gopsutil/process"
@@ -26,12 +30,23 @@ type MemoryInfo struct {
 	Used        string    `json:"used"`
 	Free        string    `json:"free"`
 	UserPercent float64   `json:"user_percent"`
+	SwapTotal   string    `json:"swap_total"`
+	SwapUsed    string    `json:"swap_used"`
+	SwapPercent float64   `json:"swap_percent"`
 	CreatedAt   time.Time `json:"mem_info_created_at"`
+
+	// 原始字节数，供 metrics 接口使用，不上报
+	TotalBytes     uint64 `json:"-"`
+	AvailableBytes uint64 `json:"-"`
+	UsedBytes      uint64 `json:"-"`
+	FreeBytes      uint64 `json:"-"`
+	SwapTotalBytes uint64 `json:"-"`
+	SwapUsedBytes  uint64 `json:"-"`
 }
 
 // 获取内存信息
-func GetMemInfo() (MemoryInfo, error) {
-	v, err := mem.VirtualMemory()
+func GetMemInfo(ctx context.Context) (MemoryInfo, error) {
+	v, err := mem.VirtualMemoryWithContext(ctx)
 	if err != nil {
 		return MemoryInfo{}, fmt.Errorf("获取内存信息失败: %v", err)
 	}
@@ -42,154 +57,387 @@ func GetMemInfo() (MemoryInfo, error) {
 	free := HanderUnit(v.Free, NUM_GB, "G")
 	userPercent, _ := strconv.ParseFloat(fmt.Sprintf("%.2f", v.UsedPercent), 64)
 
+	// 获取交换分区信息
+	s, err := mem.SwapMemoryWithContext(ctx)
+	if err != nil {
+		return MemoryInfo{}, fmt.Errorf("获取交换分区信息失败: %v", err)
+	}
+	swapPercent, _ := strconv.ParseFloat(fmt.Sprintf("%.2f", s.UsedPercent), 64)
+
 	return MemoryInfo{
 		Total:       total,
 		Available:   available,
 		Used:        used,
 		Free:        free,
 		UserPercent: userPercent,
+		SwapTotal:   HanderUnit(s.Total, NUM_GB, "G"),
+		SwapUsed:    HanderUnit(s.Used, NUM_GB, "G"),
+		SwapPercent: swapPercent,
 		CreatedAt:   time.Now(),
+
+		TotalBytes:     v.Total,
+		AvailableBytes: v.Available,
+		UsedBytes:      v.Used,
+		FreeBytes:      v.Free,
+		SwapTotalBytes: s.Total,
+		SwapUsedBytes:  s.Used,
 	}, nil
 }
 
+// CPUInfo 每个逻辑 CPU 一条记录
+// Percent 为整机使用率，CorePercent 及各时间占比(%)为该逻辑 CPU 在采样周期内的值
 type CPUInfo struct {
-	ID        int       `json:"id"`
-	ModelName string    `json:"model_name"`
-	CoresNum  int       `json:"cores_num"`
-	Percent   float64   `json:"percent"`
-	CreatedAt time.Time `json:"cpu_info_created_at"`
+	ID          int       `json:"id"`
+	CPU         int       `json:"cpu"` // 逻辑 CPU 编号
+	ModelName   string    `json:"model_name"`
+	CoresNum    int       `json:"cores_num"`
+	Percent     float64   `json:"percent"`
+	CorePercent float64   `json:"core_percent"`
+	User        float64   `json:"user"`
+	System      float64   `json:"system"`
+	Idle        float64   `json:"idle"`
+	Nice        float64   `json:"nice"`
+	Iowait      float64   `json:"iowait"`
+	Irq         float64   `json:"irq"`
+	Softirq     float64   `json:"softirq"`
+	Steal       float64   `json:"steal"`
+	CreatedAt   time.Time `json:"cpu_info_created_at"`
 }
 
+// CPU 使用率采样周期
+const cpuSampleInterval = time.Second * 14
+
 // 获取CPU信息
-func GetCpuInfo() ([]CPUInfo, error) {
+func GetCpuInfo(ctx context.Context) ([]CPUInfo, error) {
 	cpuInfos := []CPUInfo{}
-	percent, err := cpu.Percent(time.Second*14, false)
+
+	// 间隔采样两次每个逻辑 CPU 的时间片，通过差值计算使用率及各项占比
+	before, err := cpu.TimesWithContext(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf("获取CPU时间失败: %v", err)
+	}
+	select {
+	case <-time.After(cpuSampleInterval):
+	case <-ctx.Done():
+		return nil, fmt.Errorf("获取CPU使用率失败: %v", ctx.Err())
+	}
+	after, err := cpu.TimesWithContext(ctx, true)
 	if err != nil {
-		return nil, fmt.Errorf("获取CPU使用率失败: %v", err)
+		return nil, fmt.Errorf("获取CPU时间失败: %v", err)
+	}
+	if len(before) != len(after) || len(after) == 0 {
+		return nil, fmt.Errorf("获取CPU使用率失败: CPU 数量在采样期间发生变化")
 	}
 
-	infos, err := cpu.Info()
+	infos, err := cpu.InfoWithContext(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("获取CPU信息失败: %v", err)
 	}
+	if len(infos) == 0 {
+		return nil, fmt.Errorf("获取CPU信息失败: 未找到CPU")
+	}
 
-	cpuPercent := percent[0]
-	for _, ci := range infos {
-		cpuInfo := CPUInfo{
-			ModelName: ci.ModelName,
-			CoresNum:  int(ci.Cores),
-			Percent:   cpuPercent,
-			CreatedAt: time.Now(),
+	var totalBusy, totalAll float64
+	for i := range after {
+		t1, t2 := before[i], after[i]
+		all := cpuTotal(t2) - cpuTotal(t1)
+		if all <= 0 {
+			all = 1
 		}
-		cpuInfos = append(cpuInfos, cpuInfo)
+		pct := func(a, b float64) float64 {
+			return round2(math.Max(b-a, 0) / all * 100)
+		}
+		busy := all - (t2.Idle - t1.Idle) - (t2.Iowait - t1.Iowait)
+		totalBusy += math.Max(busy, 0)
+		totalAll += all
+
+		// Linux 下 cpu.Info() 按逻辑 CPU 返回，其他平台按物理 CPU 返回
+		ci := infos[0]
+		if len(infos) == len(after) {
+			ci = infos[i]
+		}
+		cpuInfos = append(cpuInfos, CPUInfo{
+			CPU:         i,
+			ModelName:   ci.ModelName,
+			CoresNum:    int(ci.Cores),
+			CorePercent: round2(math.Max(busy, 0) / all * 100),
+			User:        pct(t1.User, t2.User),
+			System:      pct(t1.System, t2.System),
+			Idle:        pct(t1.Idle, t2.Idle),
+			Nice:        pct(t1.Nice, t2.Nice),
+			Iowait:      pct(t1.Iowait, t2.Iowait),
+			Irq:         pct(t1.Irq, t2.Irq),
+			Softirq:     pct(t1.Softirq, t2.Softirq),
+			Steal:       pct(t1.Steal, t2.Steal),
+			CreatedAt:   time.Now(),
+		})
+	}
+
+	cpuPercent := round2(totalBusy / totalAll * 100)
+	for i := range cpuInfos {
+		cpuInfos[i].Percent = cpuPercent
 	}
 	return cpuInfos, nil
 }
 
+// cpuTotal 各类 CPU 时间之和；Linux 中 guest 与 guest_nice 已分别计入 user 与 nice，不再重复累加
+func cpuTotal(t cpu.TimesStat) float64 {
+	return t.User + t.System + t.Nice + t.Iowait + t.Irq + t.Softirq + t.Steal + t.Idle
+}
+
 type HostInfo struct {
-	ID         int       `json:"id"`
-	Hostname   string    `json:"hostname"`
-	OS         string    `json:"os"`
-	Platform   string    `json:"platform"`
-	KernelArch string    `json:"kernel_arch"`
-	CreatedAt  time.Time `json:"host_info_created_at"`
-	Token      string    `json:"token"`
+	ID                   int       `json:"id"`
+	Hostname             string    `json:"hostname"`
+	OS                   string    `json:"os"`
+	Platform             string    `json:"platform"`
+	KernelArch           string    `json:"kernel_arch"`
+	Uptime               uint64    `json:"uptime"`    // 运行时长(秒)
+	BootTime             uint64    `json:"boot_time"` // 启动时间(Unix 秒)
+	Procs                uint64    `json:"procs"`     // 进程数
+	VirtualizationSystem string    `json:"virtualization_system"`
+	VirtualizationRole   string    `json:"virtualization_role"` // guest 或 host
+	Load1                float64   `json:"load1"`
+	Load5                float64   `json:"load5"`
+	Load15               float64   `json:"load15"`
+	CreatedAt            time.Time `json:"host_info_created_at"`
 }
 
 // 获取主机信息
-func GetHostInfo() (HostInfo, error) {
-	hInfo, err := host.Info()
+func GetHostInfo(ctx context.Context) (HostInfo, error) {
+	hInfo, err := host.InfoWithContext(ctx)
 	if err != nil {
 		return HostInfo{}, fmt.Errorf("获取主机信息失败: %v", err)
 	}
 
+	avg, err := load.AvgWithContext(ctx)
+	if err != nil {
+		return HostInfo{}, fmt.Errorf("获取系统负载失败: %v", err)
+	}
+
 	return HostInfo{
-		Hostname:   hInfo.Hostname,
-		OS:         hInfo.OS,
-		Platform:   hInfo.Platform + "-" + hInfo.PlatformVersion + " " + hInfo.PlatformFamily,
-		KernelArch: hInfo.KernelArch,
-		CreatedAt:  time.Now(),
+		Hostname:             hInfo.Hostname,
+		OS:                   hInfo.OS,
+		Platform:             hInfo.Platform + "-" + hInfo.PlatformVersion + " " + hInfo.PlatformFamily,
+		KernelArch:           hInfo.KernelArch,
+		Uptime:               hInfo.Uptime,
+		BootTime:             hInfo.BootTime,
+		Procs:                hInfo.Procs,
+		VirtualizationSystem: hInfo.VirtualizationSystem,
+		VirtualizationRole:   hInfo.VirtualizationRole,
+		Load1:                avg.Load1,
+		Load5:                avg.Load5,
+		Load15:               avg.Load15,
+		CreatedAt:            time.Now(),
 	}, nil
 }
 
 type ProcessInfo struct {
 	ID         int       `json:"id"`
 	PID        int       `json:"pid"`
+	Name       string    `json:"name"`
+	Username   string    `json:"username"`
 	CPUPercent float64   `json:"cpu_percent"`
 	MemPercent float32   `json:"mem_percent"`
+	RSS        uint64    `json:"rss"` // 常驻内存（字节）
 	Cmdline    string    `json:"cmdline"`
 	CreatedAt  time.Time `json:"pro_info_created_at"`
 }
 
-// 获取进程信息
-func GetProcess() ([]ProcessInfo, error) {
-	processes, err := process.Processes()
+// ProcessGroup 按可执行文件名或用户汇总的进程信息
+type ProcessGroup struct {
+	Name       string  `json:"name"`
+	Count      int     `json:"count"`
+	CPUPercent float64 `json:"cpu_percent"`
+	MemPercent float64 `json:"mem_percent"`
+	RSS        uint64  `json:"rss"`
+}
+
+// ProcessSummary 进程概况：CPU 与内存占用最高的进程，以及所有进程按名称与用户的汇总
+type ProcessSummary struct {
+	Total  int            `json:"total"`
+	TopCPU []ProcessInfo  `json:"top_cpu"`
+	TopMem []ProcessInfo  `json:"top_mem"`
+	ByName []ProcessGroup `json:"by_name"`
+	ByUser []ProcessGroup `json:"by_user"`
+}
+
+// 获取进程信息，topCPU、topMem 分别为按 CPU、内存使用率选取的进程数，为 0 时不限制
+// 汇总信息基于所有进程计算，不受 topCPU、topMem 限制
+func GetProcess(ctx context.Context, topCPU, topMem int) (ProcessSummary, error) {
+	processes, err := process.ProcessesWithContext(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("获取进程列表失败: %v", err)
+		return ProcessSummary{}, fmt.Errorf("获取进程列表失败: %v", err)
 	}
 
 	var processInfos []ProcessInfo
+	now := time.Now()
 
 	for _, p := range processes {
-		cpuPercent, err := p.CPUPercent()
+		// 进程较多时逐个读取耗时较长，超时后不再继续
+		if err := ctx.Err(); err != nil {
+			return ProcessSummary{}, fmt.Errorf("获取进程信息失败: %v", err)
+		}
+		cpuPercent, err := p.CPUPercentWithContext(ctx)
 		if err != nil {
 			continue
 		}
 
-		memPercent, err := p.MemoryPercent()
+		memPercent, err := p.MemoryPercentWithContext(ctx)
 		if err != nil {
 			continue
 		}
 
-		cmdline, err := p.Cmdline()
-		if err != nil {
-			continue
+		// 以下信息获取失败时（如进程已退出或权限不足）留空
+		name, _ := p.NameWithContext(ctx)
+		username, _ := p.UsernameWithContext(ctx)
+		cmdline, _ := p.CmdlineWithContext(ctx)
+		var rss uint64
+		if memInfo, err := p.MemoryInfoWithContext(ctx); err == nil {
+			rss = memInfo.RSS
 		}
 
 		processInfos = append(processInfos, ProcessInfo{
 			PID:        int(p.Pid),
+			Name:       name,
+			Username:   username,
 			CPUPercent: cpuPercent,
 			MemPercent: memPercent,
+			RSS:        rss,
 			Cmdline:    cmdline,
-			CreatedAt:  time.Now(),
+			CreatedAt:  now,
 		})
 	}
 
-	sort.Slice(processInfos, func(i, j int) bool {
-		return processInfos[i].CPUPercent > processInfos[j].CPUPercent
+	return ProcessSummary{
+		Total:  len(processInfos),
+		TopCPU: topProcesses(processInfos, topCPU, func(a, b ProcessInfo) bool { return a.CPUPercent > b.CPUPercent }),
+		TopMem: topProcesses(processInfos, topMem, func(a, b ProcessInfo) bool { return a.RSS > b.RSS }),
+		ByName: groupProcesses(processInfos, func(p ProcessInfo) string { return p.Name }),
+		ByUser: groupProcesses(processInfos, func(p ProcessInfo) string { return p.Username }),
+	}, nil
+}
+
+// topProcesses 按 less 排序后返回前 n 个进程，n 为 0 时返回全部
+func topProcesses(processInfos []ProcessInfo, n int, less func(a, b ProcessInfo) bool) []ProcessInfo {
+	sorted := make([]ProcessInfo, len(processInfos))
+	copy(sorted, processInfos)
+	sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	if n > 0 && len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// groupProcesses 按 key 汇总进程数与 CPU、内存占用，按 CPU 使用率降序排列
+func groupProcesses(processInfos []ProcessInfo, key func(p ProcessInfo) string) []ProcessGroup {
+	index := map[string]int{}
+	var groups []ProcessGroup
+	for _, p := range processInfos {
+		k := key(p)
+		i, ok := index[k]
+		if !ok {
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, ProcessGroup{Name: k})
+		}
+		groups[i].Count++
+		groups[i].CPUPercent += p.CPUPercent
+		groups[i].MemPercent += float64(p.MemPercent)
+		groups[i].RSS += p.RSS
+	}
+	for i := range groups {
+		groups[i].CPUPercent = round2(groups[i].CPUPercent)
+		groups[i].MemPercent = round2(groups[i].MemPercent)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].CPUPercent != groups[j].CPUPercent {
+			return groups[i].CPUPercent > groups[j].CPUPercent
+		}
+		return groups[i].RSS > groups[j].RSS
 	})
-	return processInfos, nil
+	return groups
 }
 
 // 定义网络信息结构体
+// 累计值直接取自网卡计数器，速率与区间增量由相邻两次采集的差值计算，首次采集时为 0
 type NetworkInfo struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	BytesRecv uint64    `json:"bytes_recv"` // 接收字节数
-	BytesSent uint64    `json:"bytes_sent"` // 发送字节数
-	CreatedAt time.Time `json:"net_info_created_at"`
+	ID                int       `json:"id"`
+	Name              string    `json:"name"`
+	BytesRecv         uint64    `json:"bytes_recv"` // 接收字节数
+	BytesSent         uint64    `json:"bytes_sent"` // 发送字节数
+	PacketsRecv       uint64    `json:"packets_recv"`
+	PacketsSent       uint64    `json:"packets_sent"`
+	Errin             uint64    `json:"errin"`
+	Errout            uint64    `json:"errout"`
+	Dropin            uint64    `json:"dropin"`
+	Dropout           uint64    `json:"dropout"`
+	BytesRecvPerSec   float64   `json:"bytes_recv_per_sec"`
+	BytesSentPerSec   float64   `json:"bytes_sent_per_sec"`
+	PacketsRecvPerSec float64   `json:"packets_recv_per_sec"`
+	PacketsSentPerSec float64   `json:"packets_sent_per_sec"`
+	ErrinDelta        uint64    `json:"errin_delta"` // 本次采集周期内新增的错误/丢包数
+	ErroutDelta       uint64    `json:"errout_delta"`
+	DropinDelta       uint64    `json:"dropin_delta"`
+	DropoutDelta      uint64    `json:"dropout_delta"`
+	CreatedAt         time.Time `json:"net_info_created_at"`
 }
 
+// 上一次采集的网卡计数器，用于计算速率
+var (
+	netIOMu       sync.Mutex
+	lastNetIO     map[string]net.IOCountersStat
+	lastNetIOTime time.Time
+)
+
 // 获取网卡信息
-func GetNetworkInfo() ([]NetworkInfo, error) {
-	netIO, err := net.IOCounters(true) // true 获取每个网卡的统计信息
+func GetNetworkInfo(ctx context.Context) ([]NetworkInfo, error) {
+	netIO, err := net.IOCountersWithContext(ctx, true) // true 获取每个网卡的统计信息
 	if err != nil {
 		return nil, fmt.Errorf("获取网络信息失败: %v", err)
 	}
+	now := time.Now()
+
+	netIOMu.Lock()
+	defer netIOMu.Unlock()
+
+	elapsed := now.Sub(lastNetIOTime).Seconds()
+	current := make(map[string]net.IOCountersStat, len(netIO))
 
 	var networkInfos []NetworkInfo
 	for _, io := range netIO {
+		current[io.Name] = io
 		networkInfo := NetworkInfo{
-			Name:      io.Name,
-			BytesRecv: io.BytesRecv,
-			BytesSent: io.BytesSent,
-			CreatedAt: time.Now(),
+			Name:        io.Name,
+			BytesRecv:   io.BytesRecv,
+			BytesSent:   io.BytesSent,
+			PacketsRecv: io.PacketsRecv,
+			PacketsSent: io.PacketsSent,
+			Errin:       io.Errin,
+			Errout:      io.Errout,
+			Dropin:      io.Dropin,
+			Dropout:     io.Dropout,
+			CreatedAt:   now,
+		}
+
+		if prev, ok := lastNetIO[io.Name]; ok && elapsed > 0 {
+			networkInfo.BytesRecvPerSec = round2(float64(counterDelta(prev.BytesRecv, io.BytesRecv)) / elapsed)
+			networkInfo.BytesSentPerSec = round2(float64(counterDelta(prev.BytesSent, io.BytesSent)) / elapsed)
+			networkInfo.PacketsRecvPerSec = round2(float64(counterDelta(prev.PacketsRecv, io.PacketsRecv)) / elapsed)
+			networkInfo.PacketsSentPerSec = round2(float64(counterDelta(prev.PacketsSent, io.PacketsSent)) / elapsed)
+			networkInfo.ErrinDelta = counterDelta(prev.Errin, io.Errin)
+			networkInfo.ErroutDelta = counterDelta(prev.Errout, io.Errout)
+			networkInfo.DropinDelta = counterDelta(prev.Dropin, io.Dropin)
+			networkInfo.DropoutDelta = counterDelta(prev.Dropout, io.Dropout)
 		}
 		networkInfos = append(networkInfos, networkInfo)
 	}
 
+	lastNetIO = current
+	lastNetIOTime = now
+
 	return networkInfos, nil
 }
+
 func HanderUnit(num uint64, numtype float64, typename string) (newnum string) {
 
 	f := fmt.Sprintf("%.2f", float64(num)/numtype)
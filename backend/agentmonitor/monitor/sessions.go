@@ -0,0 +1,43 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/shirou/gopsutil/host"
+)
+
+// 定义登录会话结构体
+type Session struct {
+	User     string    `json:"user"`
+	Terminal string    `json:"terminal"` // 如 pts/0、tty1
+	Host     string    `json:"host"`     // 登录来源，本地登录时为空或为显示器名称如 :0
+	Started  time.Time `json:"started"`
+}
+
+// 获取当前的登录会话，按登录时间升序排列
+// 没有 utmp 的系统（如大多数容器）不记录会话，返回空列表
+func GetSessions(ctx context.Context) ([]Session, error) {
+	users, err := host.UsersWithContext(ctx)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Session{}, nil
+		}
+		return nil, fmt.Errorf("获取登录会话失败: %v", err)
+	}
+
+	sessions := make([]Session, 0, len(users))
+	for _, u := range users {
+		sessions = append(sessions, Session{
+			User:     u.User,
+			Terminal: u.Terminal,
+			Host:     u.Host,
+			Started:  time.Unix(int64(u.Started), 0).UTC(),
+		})
+	}
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].Started.Before(sessions[j].Started) })
+	return sessions, nil
+}
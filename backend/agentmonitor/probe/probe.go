@@ -0,0 +1,340 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 匹配正文时最多读取的字节数
+const maxBodyBytes = 1 << 20
+
+// Probe 一个拨测目标
+type Probe struct {
+	Name     string
+	Type     string // http、tcp、dns
+	Target   string // http 为 URL，tcp 为 host:port，dns 为域名
+	Interval time.Duration
+	Timeout  time.Duration
+
+	// http
+	Method             string
+	ExpectStatus       []int          // 为空时要求 2xx 或 3xx
+	BodyRegex          *regexp.Regexp // 为 nil 时不检查正文
+	InsecureSkipVerify bool
+
+	// dns
+	RecordType string // A、AAAA、CNAME、MX、TXT、NS
+	Resolver   string // host:port，为空时使用系统解析器
+	Expect     string // 应答中需包含的值，为空时只要求有应答
+}
+
+// Result 一次拨测的结果，各阶段耗时均为毫秒，未经历的阶段为 0
+type Result struct {
+	Name       string  `json:"name"`
+	Type       string  `json:"type"`
+	Target     string  `json:"target"`
+	Success    bool    `json:"success"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+
+	StatusCode int     `json:"status_code,omitempty"`
+	DNSMs      float64 `json:"dns_ms,omitempty"`
+	ConnectMs  float64 `json:"connect_ms,omitempty"`
+	TLSMs      float64 `json:"tls_ms,omitempty"`
+	TTFBMs     float64 `json:"ttfb_ms,omitempty"` // 发出请求到收到首字节
+
+	Answers []string `json:"answers,omitempty"`
+
+	CheckedAt int64 `json:"checked_at"` // Unix 时间戳（秒）
+}
+
+// Runner 按各自的周期运行拨测，未到周期的拨测返回上一次的结果
+type Runner struct {
+	probes []Probe
+
+	mu      sync.Mutex
+	last    map[string]time.Time
+	results map[string]Result
+}
+
+// NewRunner 创建拨测运行器
+func NewRunner(probes []Probe) *Runner {
+	return &Runner{
+		probes:  probes,
+		last:    map[string]time.Time{},
+		results: map[string]Result{},
+	}
+}
+
+// Run 并发运行所有到期的拨测，返回所有拨测的最新结果
+func (r *Runner) Run(ctx context.Context) []Result {
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	for _, p := range r.probes {
+		r.mu.Lock()
+		last, ok := r.last[p.Name]
+		// 留出 1 秒余量，避免调度抖动导致跳过一个周期
+		due := !ok || now.Sub(last) >= p.Interval-time.Second
+		if due {
+			r.last[p.Name] = now
+		}
+		r.mu.Unlock()
+		if !due {
+			continue
+		}
+
+		wg.Add(1)
+		go func(p Probe) {
+			defer wg.Done()
+			res := Run(ctx, p)
+			r.mu.Lock()
+			r.results[p.Name] = res
+			r.mu.Unlock()
+		}(p)
+	}
+	wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	results := make([]Result, 0, len(r.probes))
+	for _, p := range r.probes {
+		if res, ok := r.results[p.Name]; ok {
+			results = append(results, res)
+		}
+	}
+	return results
+}
+
+// Run 运行一次拨测
+func Run(ctx context.Context, p Probe) Result {
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	res := Result{Name: p.Name, Type: p.Type, Target: p.Target}
+	start := time.Now()
+	res.CheckedAt = start.Unix()
+
+	var err error
+	switch p.Type {
+	case "http":
+		err = runHTTP(ctx, p, &res)
+	case "tcp":
+		err = runTCP(ctx, p, &res)
+	case "dns":
+		err = runDNS(ctx, p, &res)
+	default:
+		err = fmt.Errorf("未知的拨测类型 %s", p.Type)
+	}
+
+	res.DurationMs = ms(time.Since(start))
+	res.Success = err == nil
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+func runHTTP(ctx context.Context, p Probe, res *Result) error {
+	method := p.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	// 双栈地址会并发建立多个连接，请求返回后未完成的连接仍可能触发回调
+	// 回调只在加锁后写入局部变量，返回前再加锁复制到 res
+	var mu sync.Mutex
+	var dnsStart, connStart, tlsStart, wroteRequest time.Time
+	var dnsMs, connectMs, tlsMs, ttfbMs float64
+	timed := func(f func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		f()
+	}
+	defer timed(func() {
+		res.DNSMs, res.ConnectMs, res.TLSMs, res.TTFBMs = dnsMs, connectMs, tlsMs, ttfbMs
+	})
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { timed(func() { dnsStart = time.Now() }) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { timed(func() { dnsMs = ms(time.Since(dnsStart)) }) },
+		ConnectStart: func(string, string) {
+			timed(func() {
+				if connStart.IsZero() {
+					connStart = time.Now()
+				}
+			})
+		},
+		ConnectDone: func(_, _ string, err error) {
+			timed(func() {
+				if err == nil {
+					connectMs = ms(time.Since(connStart))
+				}
+			})
+		},
+		TLSHandshakeStart:    func() { timed(func() { tlsStart = time.Now() }) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { timed(func() { tlsMs = ms(time.Since(tlsStart)) }) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { timed(func() { wroteRequest = time.Now() }) },
+		GotFirstResponseByte: func() { timed(func() { ttfbMs = ms(time.Since(wroteRequest)) }) },
+	}
+
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), method, p.Target, nil)
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %v", err)
+	}
+
+	// 每次拨测使用新连接，保证各阶段耗时都被测量
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			DisableKeepAlives: true,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: p.InsecureSkipVerify},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	res.StatusCode = resp.StatusCode
+
+	if !statusExpected(resp.StatusCode, p.ExpectStatus) {
+		return fmt.Errorf("状态码 %d 不符合预期", resp.StatusCode)
+	}
+
+	if p.BodyRegex != nil {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+		if err != nil {
+			return fmt.Errorf("读取响应失败: %v", err)
+		}
+		if !p.BodyRegex.Match(body) {
+			return fmt.Errorf("响应内容不匹配 %s", p.BodyRegex)
+		}
+	}
+	return nil
+}
+
+func statusExpected(code int, expect []int) bool {
+	if len(expect) == 0 {
+		return code >= 200 && code < 400
+	}
+	for _, e := range expect {
+		if code == e {
+			return true
+		}
+	}
+	return false
+}
+
+func runTCP(ctx context.Context, p Probe, res *Result) error {
+	start := time.Now()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", p.Target)
+	if err != nil {
+		return fmt.Errorf("连接失败: %v", err)
+	}
+	res.ConnectMs = ms(time.Since(start))
+	conn.Close()
+	return nil
+}
+
+func runDNS(ctx context.Context, p Probe, res *Result) error {
+	resolver := net.DefaultResolver
+	if p.Resolver != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, p.Resolver)
+			},
+		}
+	}
+
+	start := time.Now()
+	answers, err := lookup(ctx, resolver, strings.ToUpper(p.RecordType), p.Target)
+	res.DNSMs = ms(time.Since(start))
+	if err != nil {
+		return fmt.Errorf("解析失败: %v", err)
+	}
+	sort.Strings(answers)
+	res.Answers = answers
+
+	if len(answers) == 0 {
+		return fmt.Errorf("没有 %s 记录", p.RecordType)
+	}
+	if p.Expect != "" {
+		for _, a := range answers {
+			if strings.TrimSuffix(a, ".") == strings.TrimSuffix(p.Expect, ".") {
+				return nil
+			}
+		}
+		return fmt.Errorf("应答中没有 %s", p.Expect)
+	}
+	return nil
+}
+
+func lookup(ctx context.Context, r *net.Resolver, recordType, name string) ([]string, error) {
+	var answers []string
+	switch recordType {
+	case "", "A", "AAAA":
+		network := "ip"
+		if recordType == "A" {
+			network = "ip4"
+		} else if recordType == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := r.LookupIP(ctx, network, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			answers = append(answers, ip.String())
+		}
+	case "CNAME":
+		cname, err := r.LookupCNAME(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, cname)
+	case "MX":
+		mxs, err := r.LookupMX(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, mx := range mxs {
+			answers = append(answers, mx.Host)
+		}
+	case "TXT":
+		return r.LookupTXT(ctx, name)
+	case "NS":
+		nss, err := r.LookupNS(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range nss {
+			answers = append(answers, ns.Host)
+		}
+	default:
+		return nil, fmt.Errorf("不支持的记录类型 %s", recordType)
+	}
+	return answers, nil
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,38 @@
+package spool
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff 指数退避，每次失败后等待时间翻倍直到 Max，实际等待时间在 [d/2, d) 之间随机
+// 避免大量 agent 在服务器恢复后同时补发
+type Backoff struct {
+	Base time.Duration
+	Max  time.Duration
+
+	attempt int
+}
+
+// Next 返回下一次重试前的等待时间
+func (b *Backoff) Next() time.Duration {
+	d := b.Base
+	for i := 0; i < b.attempt && d < b.Max; i++ {
+		d *= 2
+	}
+	if d > b.Max {
+		d = b.Max
+	}
+	b.attempt++
+
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + time.Duration(rand.Int63n(int64(half)))
+}
+
+// Reset 发送成功后重置退避
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
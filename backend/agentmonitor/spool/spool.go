@@ -0,0 +1,194 @@
+package spool
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 缓存文件后缀，写入过程中的临时文件使用 .tmp 后缀，不会被读取
+const fileSuffix = ".json"
+
+// Spool 本地磁盘缓存，按写入顺序保存发送失败的数据
+// 文件名以写入时间的纳秒时间戳开头，按文件名排序即为写入顺序
+type Spool struct {
+	dir      string
+	maxBytes int64
+	maxFiles int
+	maxAge   time.Duration
+
+	mu  sync.Mutex
+	seq int
+}
+
+// Entry 一条缓存的数据
+type Entry struct {
+	Name    string
+	Size    int64
+	Written time.Time
+}
+
+// New 创建缓存目录，maxBytes、maxFiles、maxAge 为 0 时表示不限制
+func New(dir string, maxBytes int64, maxFiles int, maxAge time.Duration) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("创建缓存目录失败: %v", err)
+	}
+	return &Spool{
+		dir:      dir,
+		maxBytes: maxBytes,
+		maxFiles: maxFiles,
+		maxAge:   maxAge,
+	}, nil
+}
+
+// Dir 缓存目录
+func (s *Spool) Dir() string {
+	return s.dir
+}
+
+// Put 写入一条数据，写入后按数量、大小、时间限制淘汰最旧的数据，返回被淘汰的条数
+func (s *Spool) Put(payload []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq = (s.seq + 1) % 10000
+	name := fmt.Sprintf("%020d-%04d%s", time.Now().UnixNano(), s.seq, fileSuffix)
+	path := filepath.Join(s.dir, name)
+
+	// 先写临时文件再重命名，避免进程中断时留下不完整的数据
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, payload, 0600); err != nil {
+		os.Remove(tmp)
+		return 0, fmt.Errorf("写入缓存文件失败: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return 0, fmt.Errorf("写入缓存文件失败: %v", err)
+	}
+
+	return s.evict()
+}
+
+// evict 删除过期数据，并在超出数量或大小限制时从最旧的开始删除
+func (s *Spool) evict() (int, error) {
+	entries, err := s.list()
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+
+	evicted := 0
+	now := time.Now()
+	for len(entries) > 0 {
+		oldest := entries[0]
+		expired := s.maxAge > 0 && now.Sub(oldest.Written) > s.maxAge
+		tooMany := s.maxFiles > 0 && len(entries) > s.maxFiles
+		tooLarge := s.maxBytes > 0 && total > s.maxBytes
+		if !expired && !tooMany && !tooLarge {
+			break
+		}
+		if err := os.Remove(filepath.Join(s.dir, oldest.Name)); err != nil && !os.IsNotExist(err) {
+			return evicted, fmt.Errorf("删除缓存文件失败: %v", err)
+		}
+		total -= oldest.Size
+		entries = entries[1:]
+		evicted++
+	}
+	return evicted, nil
+}
+
+// list 按写入顺序列出所有缓存数据
+func (s *Spool) list() ([]Entry, error) {
+	dirEntries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取缓存目录失败: %v", err)
+	}
+
+	var entries []Entry
+	for _, de := range dirEntries {
+		name := de.Name()
+		if de.IsDir() || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		nanos, err := strconv.ParseInt(strings.SplitN(name, "-", 2)[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, Entry{Name: name, Size: info.Size(), Written: time.Unix(0, nanos)})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+// Entries 按写入顺序列出所有缓存数据
+func (s *Spool) Entries() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list()
+}
+
+// Depth 返回缓存的条数与总字节数
+func (s *Spool) Depth() (int, int64, error) {
+	entries, err := s.Entries()
+	if err != nil {
+		return 0, 0, err
+	}
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+	return len(entries), total, nil
+}
+
+// Replay 从最旧的数据开始依次调用 send，成功的数据从缓存中删除
+// send 返回错误时停止补发并返回该错误，未发送的数据保留到下次补发；过期的数据直接丢弃
+func (s *Spool) Replay(send func(payload []byte) error) (int, error) {
+	sent := 0
+	for {
+		s.mu.Lock()
+		entries, err := s.list()
+		s.mu.Unlock()
+		if err != nil {
+			return sent, err
+		}
+		if len(entries) == 0 {
+			return sent, nil
+		}
+
+		oldest := entries[0]
+		path := filepath.Join(s.dir, oldest.Name)
+		if s.maxAge > 0 && time.Since(oldest.Written) > s.maxAge {
+			os.Remove(path)
+			continue
+		}
+
+		payload, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return sent, fmt.Errorf("读取缓存文件失败: %v", err)
+		}
+		if err := send(payload); err != nil {
+			return sent, err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return sent, fmt.Errorf("删除缓存文件失败: %v", err)
+		}
+		sent++
+	}
+}
@@ -0,0 +1,264 @@
+package update
+
+import (
+	"bytes"
+	"cmd/agentmonitor/logger"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Info 服务器在心跳响应中下发的目标版本
+// Signature 为 ed25519 私钥对二进制文件 SHA-256 摘要（32 字节原始值）的签名，base64 编码
+type Info struct {
+	Version   string `json:"version"`
+	URL       string `json:"url"`
+	SHA256    string `json:"sha256"`
+	Signature string `json:"signature"`
+}
+
+// state 升级过程的状态，保存在可执行文件旁，用于新版本启动后确认或回滚
+type state struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Starts    int       `json:"starts"` // 新版本未正常退出的启动次数，超过 1 次说明新版本在确认前异常退出了
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Updater 下载、校验并替换 agent 的可执行文件
+// 替换前的文件保存为 .old，新版本心跳成功后删除，失败时恢复
+type Updater struct {
+	exe string
+}
+
+// New 创建升级器，操作当前进程的可执行文件
+func New() (*Updater, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("获取可执行文件路径失败: %v", err)
+	}
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return nil, fmt.Errorf("获取可执行文件路径失败: %v", err)
+	}
+	return &Updater{exe: exe}, nil
+}
+
+// ParsePublicKey 解析 base64 编码的 ed25519 公钥
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("公钥不是有效的 base64: %v", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("公钥长度应为 %d 字节，实际为 %d", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+func (u *Updater) newPath() string    { return u.exe + ".new" }
+func (u *Updater) oldPath() string    { return u.exe + ".old" }
+func (u *Updater) statePath() string  { return u.exe + ".update.json" }
+func (u *Updater) failedPath() string { return u.exe + ".update-failed" }
+
+// Download 下载新版本到 .new 文件，校验 SHA-256、签名以及文件自身报告的版本号
+// client 不应设置整体超时，下载时间由 ctx 控制
+func (u *Updater) Download(ctx context.Context, client *http.Client, publicKey ed25519.PublicKey, info Info) error {
+	want, err := hex.DecodeString(info.SHA256)
+	if err != nil || len(want) != sha256.Size {
+		return fmt.Errorf("无效的 sha256: %q", info.SHA256)
+	}
+	sig, err := base64.StdEncoding.DecodeString(info.Signature)
+	if err != nil {
+		return fmt.Errorf("无效的签名: %v", err)
+	}
+	// 先验证签名，签名不对时不必下载
+	if !ed25519.Verify(publicKey, want, sig) {
+		return errors.New("签名校验失败")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, info.URL, nil)
+	if err != nil {
+		return fmt.Errorf("创建下载请求失败: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("下载新版本失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("下载新版本失败: %s", resp.Status)
+	}
+
+	f, err := os.OpenFile(u.newPath(), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return fmt.Errorf("创建文件失败: %v", err)
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(u.newPath())
+		return fmt.Errorf("下载新版本失败: %v", err)
+	}
+	if got := h.Sum(nil); !bytes.Equal(got, want) {
+		os.Remove(u.newPath())
+		return fmt.Errorf("sha256 不一致: 期望 %s，实际 %x", info.SHA256, got)
+	}
+
+	// 运行新文件确认其能在本机执行且版本与下发的一致
+	vctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(vctx, u.newPath(), "-version").Output()
+	if err != nil {
+		os.Remove(u.newPath())
+		return fmt.Errorf("新版本无法运行: %v", err)
+	}
+	if v := strings.TrimSpace(string(out)); v != info.Version {
+		os.Remove(u.newPath())
+		return fmt.Errorf("新版本报告的版本号为 %q，与下发的 %q 不一致", v, info.Version)
+	}
+	return nil
+}
+
+// Swap 用已下载的新版本替换当前可执行文件，当前文件保存为 .old
+func (u *Updater) Swap(from, to string) error {
+	os.Remove(u.oldPath())
+	if err := os.Link(u.exe, u.oldPath()); err != nil {
+		return fmt.Errorf("备份当前版本失败: %v", err)
+	}
+	st := state{From: from, To: to, UpdatedAt: time.Now()}
+	if err := u.writeState(st); err != nil {
+		return err
+	}
+	// rename 是原子操作，任何时刻可执行文件要么是旧版本，要么是完整的新版本
+	if err := os.Rename(u.newPath(), u.exe); err != nil {
+		os.Remove(u.statePath())
+		return fmt.Errorf("替换可执行文件失败: %v", err)
+	}
+	return nil
+}
+
+// Restart 以相同的参数与环境变量重新执行可执行文件，进程号不变，成功时不返回
+func (u *Updater) Restart() error {
+	return syscall.Exec(u.exe, os.Args, os.Environ())
+}
+
+// Begin 启动时检查是否处于升级后的观察期，当前版本是刚升级的新版本时返回 true
+// 新版本此前启动过却未确认也未正常退出，说明新版本异常退出了，此时恢复旧版本并重新执行，成功时不返回
+func (u *Updater) Begin(current string) (bool, error) {
+	st, err := u.readState()
+	if err != nil || st.To != current {
+		return false, err
+	}
+	st.Starts++
+	if st.Starts > 1 {
+		reason := fmt.Sprintf("新版本 %s 在确认前异常退出", current)
+		logger.Errorf("%s，回滚到 %s", reason, st.From)
+		if err := u.Rollback(reason); err != nil {
+			return false, err
+		}
+		return false, u.Restart()
+	}
+	return true, u.writeState(st)
+}
+
+// Confirm 新版本心跳成功，删除备份与升级状态
+func (u *Updater) Confirm() {
+	os.Remove(u.statePath())
+	os.Remove(u.oldPath())
+}
+
+// Stopped 观察期内的新版本正常退出，不计入启动次数，下次启动时继续观察
+func (u *Updater) Stopped() error {
+	st, err := u.readState()
+	if err != nil || st.Starts == 0 {
+		return err
+	}
+	st.Starts--
+	return u.writeState(st)
+}
+
+// Rollback 恢复 .old 备份并记录失败的版本，之后不再尝试升级到该版本，调用方随后应调用 Restart
+func (u *Updater) Rollback(reason string) error {
+	st, err := u.restore()
+	if err != nil {
+		return err
+	}
+	os.WriteFile(u.failedPath(), []byte(st.To+"\n"+reason+"\n"), 0644)
+	return nil
+}
+
+// Revert 恢复 .old 备份但不记录失败，用于新版本因服务器不可达等外部原因未能确认，之后仍会再次升级到该版本
+// 调用方随后应调用 Restart
+func (u *Updater) Revert() error {
+	_, err := u.restore()
+	return err
+}
+
+func (u *Updater) restore() (state, error) {
+	st, err := u.readState()
+	if err != nil {
+		return st, err
+	}
+	if err := os.Rename(u.oldPath(), u.exe); err != nil {
+		return st, fmt.Errorf("恢复旧版本失败: %v", err)
+	}
+	os.Remove(u.statePath())
+	return st, nil
+}
+
+// Failed 该版本此前升级失败并已回滚
+func (u *Updater) Failed(version string) bool {
+	content, err := os.ReadFile(u.failedPath())
+	if err != nil {
+		return false
+	}
+	first, _, _ := strings.Cut(string(content), "\n")
+	return first == version
+}
+
+func (u *Updater) readState() (state, error) {
+	var st state
+	content, err := os.ReadFile(u.statePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return st, fmt.Errorf("读取升级状态失败: %v", err)
+	}
+	if err := json.Unmarshal(content, &st); err != nil {
+		return st, fmt.Errorf("解析升级状态失败: %v", err)
+	}
+	return st, nil
+}
+
+func (u *Updater) writeState(st state) error {
+	content, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("序列化升级状态失败: %v", err)
+	}
+	tmp := u.statePath() + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return fmt.Errorf("保存升级状态失败: %v", err)
+	}
+	if err := os.Rename(tmp, u.statePath()); err != nil {
+		return fmt.Errorf("保存升级状态失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"cmd/agentmonitor/data"
+	"cmd/agentmonitor/logger"
+	"cmd/agentmonitor/update"
+	"cmd/agentmonitor/version"
+	"context"
+	"log"
+	"time"
+)
+
+// 下载或校验失败后等待多久再尝试同一版本
+const upgradeRetry = 10 * time.Minute
+
+// 升级后的观察期：新版本的心跳因网络或服务器故障失败时，至少尝试 probationBeats 次
+// 并等待 probationWindow 后才恢复旧版本
+const (
+	probationBeats  = 3
+	probationWindow = 10 * time.Minute
+)
+
+// beatResult 一次心跳的结果，由心跳 goroutine 交给主循环处理
+type beatResult struct {
+	resp data.HeartbeatResponse
+	err  error
+}
+
+// upgrader 处理服务器下发的升级，以及升级后新版本的确认与回滚，只在主循环中使用
+type upgrader struct {
+	u         *update.Updater // 无法确定可执行文件路径时为 nil，不支持升级
+	probation bool            // 当前是刚升级的新版本，等待首次成功的心跳
+	since     time.Time       // 观察期开始的时间
+	failures  int             // 观察期内心跳失败的次数
+	busy      bool            // 正在下载新版本
+	failedAt  map[string]time.Time
+	ready     chan update.Info
+	failed    chan string
+}
+
+// newUpgrader 创建升级器并检查上一次升级的状态，新版本在确认前异常退出时在此回滚并重新执行旧版本
+func newUpgrader() *upgrader {
+	g := &upgrader{
+		failedAt: map[string]time.Time{},
+		ready:    make(chan update.Info, 1),
+		failed:   make(chan string, 1),
+	}
+	u, err := update.New()
+	if err != nil {
+		logger.Warnf("无法自动升级: %v", err)
+		return g
+	}
+	g.u = u
+	g.probation, err = u.Begin(version.Version)
+	if err != nil {
+		logger.Errorf("检查升级状态失败: %v", err)
+	}
+	if g.probation {
+		g.since = time.Now()
+		logger.Infof("已升级到 %s，等待心跳确认", version.Version)
+	}
+	return g
+}
+
+// started agent 启动后调用，不发送心跳时无法确认新版本，直接视为成功
+func (g *upgrader) started(a *agent) {
+	if g.probation && a.heartbeater == nil {
+		logger.Warnf("未启用心跳，无法确认新版本 %s 是否正常，直接保留", version.Version)
+		g.u.Confirm()
+		g.probation = false
+	}
+}
+
+// stopped agent 正常退出前调用，观察期内的正常退出不视为新版本异常
+func (g *upgrader) stopped() {
+	if g.probation {
+		if err := g.u.Stopped(); err != nil {
+			logger.Errorf("保存升级状态失败: %v", err)
+		}
+	}
+}
+
+// beat 处理一次心跳的结果：观察期内据此确认或回滚，否则检查服务器是否下发了新版本
+func (g *upgrader) beat(a *agent, b beatResult) {
+	if g.probation {
+		g.beatProbation(a, b.err)
+		return
+	}
+
+	info := b.resp.Update
+	if b.err != nil || info == nil || g.u == nil || g.busy || !a.cfg.Update.Enabled || info.Version == version.Version {
+		return
+	}
+	if g.u.Failed(info.Version) {
+		logger.Debugf("版本 %s 此前升级失败已回滚，不再尝试", info.Version)
+		return
+	}
+	if t, ok := g.failedAt[info.Version]; ok && time.Since(t) < upgradeRetry {
+		return
+	}
+
+	publicKey, err := update.ParsePublicKey(a.cfg.Update.PublicKey) // 已在配置校验中检查
+	if err != nil {
+		logger.Errorf("自动升级公钥无效: %v", err)
+		return
+	}
+	client, err := data.NewHTTPClient(a.cfg)
+	if err != nil {
+		logger.Errorf("创建 HTTP 客户端失败: %v", err)
+		return
+	}
+	client.Timeout = 0
+	timeout := a.cfg.Update.DownloadTimeout
+
+	// 下载与校验期间 agent 照常运行，完成后交给主循环替换并重启
+	g.busy = true
+	logger.Infof("服务器要求升级到 %s，开始下载 %s", info.Version, info.URL)
+	go func(info update.Info) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := g.u.Download(ctx, client, publicKey, info); err != nil {
+			logger.Errorf("下载新版本 %s 失败: %v", info.Version, err)
+			g.failed <- info.Version
+			return
+		}
+		g.ready <- info
+	}(*info)
+}
+
+// beatProbation 观察期内的心跳：成功时确认新版本
+// 服务器拒绝新版本的请求说明新版本本身有问题，立即回滚并不再尝试该版本；
+// 网络或服务器故障导致的失败在观察期内继续等待，观察期结束仍未成功时恢复旧版本，但不记录为失败
+func (g *upgrader) beatProbation(a *agent, err error) {
+	if err == nil {
+		g.probation = false
+		g.u.Confirm()
+		logger.Infof("升级到 %s 成功", version.Version)
+		return
+	}
+	if !data.Retryable(err) {
+		logger.Errorf("新版本 %s 的心跳被服务器拒绝，回滚到上一版本: %v", version.Version, err)
+		g.rollback(a, func() error { return g.u.Rollback(err.Error()) })
+	}
+
+	g.failures++
+	if g.failures < probationBeats || time.Since(g.since) < probationWindow {
+		logger.Warnf("新版本 %s 第 %d 次心跳失败，继续等待确认: %v", version.Version, g.failures, err)
+		return
+	}
+	logger.Errorf("新版本 %s 在 %s 内未能完成心跳，恢复上一版本，之后仍会再次尝试: %v", version.Version, probationWindow, err)
+	g.rollback(a, g.u.Revert)
+}
+
+// fatal agent 无法按配置启动时调用，不返回
+// 观察期内说明新版本不接受现有配置，恢复旧版本并重新执行，之后不再尝试该版本
+func (g *upgrader) fatal(err error) {
+	if g.probation {
+		logger.Errorf("新版本 %s 无法启动，回滚到上一版本: %v", version.Version, err)
+		if err := g.u.Rollback(err.Error()); err != nil {
+			log.Fatalf("回滚失败: %v", err)
+		}
+		log.Fatalf("重新执行旧版本失败: %v", g.u.Restart())
+	}
+	log.Fatal(err)
+}
+
+// rollback 停止 agent、恢复旧版本并重新执行，不返回
+func (g *upgrader) rollback(a *agent, restore func() error) {
+	a.stop()
+	if err := restore(); err != nil {
+		log.Fatalf("回滚失败: %v", err)
+	}
+	log.Fatalf("重新执行旧版本失败: %v", g.u.Restart())
+}
+
+// downloadFailed 下载失败，一段时间内不再尝试该版本
+func (g *upgrader) downloadFailed(v string) {
+	g.busy = false
+	g.failedAt[v] = time.Now()
+}
+
+// apply 停止 agent、替换可执行文件并重新执行，成功时不返回；失败时按原配置重新启动 agent
+func (g *upgrader) apply(a *agent, info update.Info, onBeat func(data.HeartbeatResponse, error)) *agent {
+	g.busy = false
+	logger.Infof("新版本 %s 校验通过，等待当前采集周期完成后替换并重启", info.Version)
+	a.stop()
+	if err := g.u.Swap(version.Version, info.Version); err != nil {
+		logger.Errorf("升级到 %s 失败: %v", info.Version, err)
+	} else {
+		err = g.u.Restart()
+		logger.Errorf("重新执行新版本失败，回滚: %v", err)
+		if err := g.u.Rollback(err.Error()); err != nil {
+			log.Fatalf("回滚失败: %v", err)
+		}
+	}
+	g.failedAt[info.Version] = time.Now()
+
+	next, err := startAgent(a.cfg, onBeat)
+	if err != nil {
+		log.Fatalf("重新启动失败: %v", err)
+	}
+	return next
+}
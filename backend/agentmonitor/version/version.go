@@ -0,0 +1,4 @@
+package version
+
+// Version agent 版本号，构建时通过 -ldflags "-X cmd/agentmonitor/version.Version=1.0.0" 指定
+var Version = "dev"
@@ -0,0 +1,183 @@
+package watchlist
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/process"
+)
+
+// 进程状态
+const (
+	StateUp   = "up"
+	StateDown = "down"
+)
+
+// Entry 一个被监视的进程，ProcessName、Cmdline、PidFile 三种匹配方式只使用一种
+type Entry struct {
+	Name         string
+	ProcessName  string         // 可执行文件名完全匹配
+	Cmdline      *regexp.Regexp // 命令行正则匹配
+	PidFile      string         // pid 文件中记录的进程
+	MinInstances int            // 匹配的进程数不少于该值时为 up
+}
+
+// Status 被监视进程的状态
+// 相邻两次采集之间 PID 被替换的次数计为重启，两次采集之间多次重启只能记为一次
+type Status struct {
+	Name          string  `json:"name"`
+	State         string  `json:"state"`
+	Instances     int     `json:"instances"`
+	PIDs          []int32 `json:"pids"`
+	Restarts      int     `json:"restarts"`       // 距上一次采集的重启次数
+	RestartsTotal int     `json:"restarts_total"` // agent 启动以来的重启次数
+	Uptime        uint64  `json:"uptime"`         // 最早启动的匹配进程的运行时长（秒）
+	Error         string  `json:"error,omitempty"`
+}
+
+// Watcher 记录各监视项上一次的 PID，用于判断重启
+type Watcher struct {
+	entries []Entry
+
+	mu            sync.Mutex
+	lastPIDs      map[string]map[int32]bool
+	restartsTotal map[string]int
+}
+
+// New 创建进程监视
+func New(entries []Entry) *Watcher {
+	return &Watcher{
+		entries:       entries,
+		lastPIDs:      map[string]map[int32]bool{},
+		restartsTotal: map[string]int{},
+	}
+}
+
+// procInfo 一次采集中缓存的进程信息，名称与命令行按需获取
+type procInfo struct {
+	p          *process.Process
+	name       *string
+	cmdline    *string
+	createTime int64
+}
+
+func (pi *procInfo) getName(ctx context.Context) string {
+	if pi.name == nil {
+		name, _ := pi.p.NameWithContext(ctx)
+		pi.name = &name
+	}
+	return *pi.name
+}
+
+func (pi *procInfo) getCmdline(ctx context.Context) string {
+	if pi.cmdline == nil {
+		cmdline, _ := pi.p.CmdlineWithContext(ctx)
+		pi.cmdline = &cmdline
+	}
+	return *pi.cmdline
+}
+
+// Check 检查所有监视项的状态
+func (w *Watcher) Check(ctx context.Context) ([]Status, error) {
+	processes, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取进程列表失败: %v", err)
+	}
+	procs := make([]*procInfo, len(processes))
+	byPID := make(map[int32]*procInfo, len(processes))
+	for i, p := range processes {
+		procs[i] = &procInfo{p: p}
+		byPID[p.Pid] = procs[i]
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	statuses := make([]Status, 0, len(w.entries))
+	for _, e := range w.entries {
+		st := Status{Name: e.Name, PIDs: []int32{}}
+
+		var matched []*procInfo
+		if e.PidFile != "" {
+			pid, err := readPidFile(e.PidFile)
+			if err != nil {
+				st.Error = err.Error()
+			} else if pi, ok := byPID[pid]; ok {
+				matched = append(matched, pi)
+			}
+		} else {
+			for _, pi := range procs {
+				if (e.ProcessName != "" && pi.getName(ctx) == e.ProcessName) ||
+					(e.Cmdline != nil && e.Cmdline.MatchString(pi.getCmdline(ctx))) {
+					matched = append(matched, pi)
+				}
+			}
+		}
+
+		pids := make(map[int32]bool, len(matched))
+		var oldest int64
+		for _, pi := range matched {
+			pids[pi.p.Pid] = true
+			st.PIDs = append(st.PIDs, pi.p.Pid)
+			if pi.createTime == 0 {
+				pi.createTime, _ = pi.p.CreateTimeWithContext(ctx)
+			}
+			if pi.createTime > 0 && (oldest == 0 || pi.createTime < oldest) {
+				oldest = pi.createTime
+			}
+		}
+		sort.Slice(st.PIDs, func(i, j int) bool { return st.PIDs[i] < st.PIDs[j] })
+
+		st.Instances = len(matched)
+		st.State = StateDown
+		if st.Instances >= e.MinInstances && st.Instances > 0 {
+			st.State = StateUp
+		}
+		if oldest > 0 {
+			st.Uptime = uint64(now.Sub(time.UnixMilli(oldest)) / time.Second)
+		}
+
+		// 退出的旧进程被新进程替换计为重启，单纯的进程数增减不算
+		if last, ok := w.lastPIDs[e.Name]; ok {
+			gone, added := 0, 0
+			for pid := range last {
+				if !pids[pid] {
+					gone++
+				}
+			}
+			for pid := range pids {
+				if !last[pid] {
+					added++
+				}
+			}
+			st.Restarts = min(gone, added)
+		}
+		w.lastPIDs[e.Name] = pids
+		w.restartsTotal[e.Name] += st.Restarts
+		st.RestartsTotal = w.restartsTotal[e.Name]
+
+		statuses = append(statuses, st)
+	}
+	return statuses, nil
+}
+
+// readPidFile 读取 pid 文件中的进程号
+func readPidFile(path string) (int32, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("读取 pid 文件失败: %v", err)
+	}
+	pid, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 32)
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("pid 文件 %s 内容无效", path)
+	}
+	return int32(pid), nil
+}
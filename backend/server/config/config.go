@@ -1,8 +1,13 @@
 package config
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
 	"path/filepath"
 	"runtime"
 
@@ -41,6 +46,52 @@ type SMTPServerConfig struct {
 	Port string `yaml:"SMTPServer_port"`
 }
 
+// ReleaseConfig agent 升级文件的存放配置
+type ReleaseConfig struct {
+	Dir       string `yaml:"dir"`        // 升级文件存放目录
+	PublicKey string `yaml:"public_key"` // base64 编码的 ed25519 公钥，上传时校验签名，未配置时不能上传
+}
+
+// TLSConfig 服务器 HTTPS 配置，cert_file 为空时使用 HTTP
+type TLSConfig struct {
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file"` // 校验 agent 客户端证书的 CA
+	MTLS         bool   `yaml:"mtls"`           // agent 上报的接口要求客户端证书，且证书的 CN 或 SAN 与主机名一致
+}
+
+// ServerTLS 根据配置生成服务器的 TLS 配置，未配置 cert_file 时返回 nil
+// 浏览器等不带客户端证书的请求仍可连接，客户端证书只在 agent 上报的接口中检查
+func (t TLSConfig) ServerTLS() (*tls.Config, error) {
+	if t.CertFile == "" {
+		if t.MTLS || t.ClientCAFile != "" {
+			return nil, errors.New("tls: 启用 mTLS 或配置 client_ca_file 时必须配置 cert_file 与 key_file")
+		}
+		return nil, nil
+	}
+	if t.KeyFile == "" {
+		return nil, errors.New("tls: cert_file 与 key_file 必须同时配置")
+	}
+	if t.MTLS && t.ClientCAFile == "" {
+		return nil, errors.New("tls: 启用 mTLS 时必须配置 client_ca_file")
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if t.ClientCAFile != "" {
+		caPEM, err := os.ReadFile(t.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取客户端 CA 证书失败: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("客户端 CA 证书 %s 中没有有效的 PEM 证书", t.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
 // Config 用于保存所有配置项
 type Config struct {
 	DB         DBConfig         `yaml:"db"`
@@ -48,6 +99,8 @@ type Config struct {
 	Redis      RedisConfig      `yaml:"redis"`
 	Email      EMAILConfig      `yaml:"email"`
 	SMTPServer SMTPServerConfig `yaml:"smtp_server"`
+	Release    ReleaseConfig    `yaml:"release"`
+	TLS        TLSConfig        `yaml:"tls"`
 }
 
 // getDBConfigPath 获取数据库配置文件的路径
@@ -0,0 +1,353 @@
+package agentconfig
+
+import (
+	"cmd/server/middlewire"
+	"cmd/server/model"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/lib/pq"
+)
+
+// ConfigRequest 保存下发配置的请求，Content 为 YAML，格式与 agent 配置文件相同
+type ConfigRequest struct {
+	Content  string `json:"content"`
+	Priority int    `json:"priority"` // 仅对分组配置有效，数值小的先合并
+}
+
+// GroupRequest 设置分组成员的请求
+type GroupRequest struct {
+	Hosts []string `json:"hosts"`
+}
+
+// checkScope 检查路径中的范围与名称
+func checkScope(c *gin.Context) (string, string, bool) {
+	scope := c.Param("scope")
+	name := c.Param("name")
+	if scope != model.ConfigScopeHost && scope != model.ConfigScopeGroup {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("范围只能是 %s 或 %s", model.ConfigScopeHost, model.ConfigScopeGroup)})
+		return "", "", false
+	}
+	if len(name) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "名称不能为空"})
+		return "", "", false
+	}
+	return scope, name, true
+}
+
+// checkOwner 检查用户能否操作主机或分组的配置：主机必须属于该用户，分组必须由该用户创建
+func checkOwner(c *gin.Context, db *sql.DB, scope, name, username string) bool {
+	var owned bool
+	var err error
+	if scope == model.ConfigScopeHost {
+		owned, err = model.HostOwnedBy(db, name, username)
+	} else {
+		owned, err = model.GroupOwnedBy(db, name, username)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if !owned {
+		if scope == model.ConfigScopeHost {
+			c.JSON(http.StatusForbidden, gin.H{"error": "主机不存在或不属于当前用户"})
+		} else {
+			c.JSON(http.StatusForbidden, gin.H{"error": "分组属于其他用户"})
+		}
+		return false
+	}
+	return true
+}
+
+// SaveConfig 新增或修改主机或分组的下发配置，agent 在下一次心跳时获取
+func SaveConfig(c *gin.Context) {
+	scope, name, ok := checkScope(c)
+	if !ok {
+		return
+	}
+	var req ConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s := fmt.Sprintf("Invalid JSON data: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": s})
+		return
+	}
+	if err := model.ValidateConfigContent(req.Content); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	// 从上下文中获取用户名
+	Username, exists := c.Get("username")
+	if !exists {
+		log.Printf("未找到用户名")
+		c.JSON(401, gin.H{
+			"code":    401,
+			"success": false,
+			"message": "未找到用户信息",
+		})
+		return
+	}
+	username := Username.(string)
+	if !checkOwner(c, db, scope, name, username) {
+		return
+	}
+
+	saved, err := model.SaveAgentConfig(db, scope, name, req.Content, req.Priority, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("用户 %s 保存 agent 下发配置 %s/%s，版本 %d", username, scope, name, saved.Version)
+	c.JSON(http.StatusOK, saved)
+}
+
+// GetConfig 查询主机或分组的下发配置
+func GetConfig(c *gin.Context) {
+	scope, name, ok := checkScope(c)
+	if !ok {
+		return
+	}
+
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	// 从上下文中获取用户名
+	Username, exists := c.Get("username")
+	if !exists {
+		log.Printf("未找到用户名")
+		c.JSON(401, gin.H{
+			"code":    401,
+			"success": false,
+			"message": "未找到用户信息",
+		})
+		return
+	}
+	username := Username.(string)
+	if !checkOwner(c, db, scope, name, username) {
+		return
+	}
+
+	cfg, err := model.ReadAgentConfig(db, scope, name)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "配置不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, cfg)
+}
+
+// DeleteConfig 删除主机或分组的下发配置
+func DeleteConfig(c *gin.Context) {
+	scope, name, ok := checkScope(c)
+	if !ok {
+		return
+	}
+
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	// 从上下文中获取用户名
+	Username, exists := c.Get("username")
+	if !exists {
+		log.Printf("未找到用户名")
+		c.JSON(401, gin.H{
+			"code":    401,
+			"success": false,
+			"message": "未找到用户信息",
+		})
+		return
+	}
+	username := Username.(string)
+	if !checkOwner(c, db, scope, name, username) {
+		return
+	}
+
+	found, err := model.DeleteAgentConfig(db, scope, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "配置不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// ListConfigs 查询当前用户的主机与分组的下发配置，以及用户的主机分组
+func ListConfigs(c *gin.Context) {
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	// 从上下文中获取用户名
+	Username, exists := c.Get("username")
+	if !exists {
+		log.Printf("未找到用户名")
+		c.JSON(401, gin.H{
+			"code":    401,
+			"success": false,
+			"message": "未找到用户信息",
+		})
+		return
+	}
+	username := Username.(string)
+
+	configs, err := model.ListAgentConfigs(db, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	groups, err := model.ListHostGroups(db, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"configs": configs, "groups": groups})
+}
+
+// SetGroupHosts 设置分组包含的主机，替换原有成员，分组与其中的主机都必须属于当前用户
+func SetGroupHosts(c *gin.Context) {
+	group := c.Param("group")
+	if len(group) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "分组名不能为空"})
+		return
+	}
+	var req GroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s := fmt.Sprintf("Invalid JSON data: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": s})
+		return
+	}
+	for _, host := range req.Hosts {
+		if strings.TrimSpace(host) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "主机名不能为空"})
+			return
+		}
+	}
+
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	// 从上下文中获取用户名
+	Username, exists := c.Get("username")
+	if !exists {
+		log.Printf("未找到用户名")
+		c.JSON(401, gin.H{
+			"code":    401,
+			"success": false,
+			"message": "未找到用户信息",
+		})
+		return
+	}
+	username := Username.(string)
+	if !checkOwner(c, db, model.ConfigScopeGroup, group, username) {
+		return
+	}
+	for _, host := range req.Hosts {
+		owned, err := model.HostOwnedBy(db, host, username)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !owned {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("主机 %s 不存在或不属于当前用户", host)})
+			return
+		}
+	}
+
+	if err := model.SetGroupHosts(db, group, req.Hosts, username); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"group": group, "hosts": req.Hosts})
+}
+
+// ConfigStatus 查询当前用户每台主机应当运行的配置版本与 agent 实际运行的版本
+func ConfigStatus(c *gin.Context) {
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	// 从上下文中获取用户名
+	Username, exists := c.Get("username")
+	if !exists {
+		log.Printf("未找到用户名")
+		c.JSON(401, gin.H{
+			"code":    401,
+			"success": false,
+			"message": "未找到用户信息",
+		})
+		return
+	}
+	username := Username.(string)
+
+	statuses, err := model.ReadConfigStatus(db, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, statuses)
+}
+
+// FetchConfig agent 获取合并后的下发配置，请求由 AgentSignatureMiddleware 校验签名
+// 配置的版本通过 ETag 返回，请求头 If-None-Match 与当前版本一致时返回 304
+func FetchConfig(c *gin.Context) {
+	hostname := c.GetString("agent_host")
+	if err := middlewire.CheckClientCert(c, hostname); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	content, etag, err := model.EffectiveAgentConfig(db, hostname)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	quoted := `"` + etag + `"`
+	c.Header("ETag", quoted)
+	if match := c.GetHeader("If-None-Match"); match == quoted || match == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "application/yaml; charset=utf-8", content)
+}
@@ -0,0 +1,409 @@
+package command
+
+import (
+	"cmd/server/middlewire"
+	"cmd/server/model"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/lib/pq"
+)
+
+// 长轮询的默认与最长等待时间
+const (
+	defaultWait = 30 * time.Second
+	maxWait     = 60 * time.Second
+	// 同一服务器实例内提交命令或回传输出时立即唤醒等待者，多个实例时靠定期重新查询
+	recheckInterval = 2 * time.Second
+)
+
+// 参数数量与长度上限，agent 只对允许传参的命令接受参数
+const (
+	maxArgs   = 32
+	maxArgLen = 4096
+)
+
+// 命令名称与 agent 配置中 commands.allow 的 name 一致
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// waiters 等待新命令的 agent（key 为 host:主机名）与等待新输出的用户（key 为 cmd:命令 ID）
+var waiters = &notifier{chans: map[string]chan struct{}{}}
+
+type notifier struct {
+	mu    sync.Mutex
+	chans map[string]chan struct{}
+}
+
+// channel 返回 key 的下一次通知，需在查询数据库之前获取，避免漏掉查询与等待之间的通知
+func (n *notifier) channel(key string) <-chan struct{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	ch, ok := n.chans[key]
+	if !ok {
+		ch = make(chan struct{})
+		n.chans[key] = ch
+	}
+	return ch
+}
+
+func (n *notifier) notify(key string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if ch, ok := n.chans[key]; ok {
+		close(ch)
+		delete(n.chans, key)
+	}
+}
+
+// waitFor 等待通知、重新查询的时间或截止时间，请求结束或已到截止时间时返回 false
+func waitFor(c *gin.Context, ch <-chan struct{}, deadline time.Time) bool {
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return false
+	}
+	if remaining > recheckInterval {
+		remaining = recheckInterval
+	}
+	timer := time.NewTimer(remaining)
+	defer timer.Stop()
+	select {
+	case <-ch:
+	case <-timer.C:
+	case <-c.Request.Context().Done():
+		return false
+	}
+	return true
+}
+
+// parseWait 解析 wait 参数，为空时使用 defaultWait
+func parseWait(c *gin.Context) (time.Duration, error) {
+	v := c.Query("wait")
+	if v == "" {
+		return defaultWait, nil
+	}
+	wait, err := time.ParseDuration(v)
+	if err != nil || wait < 0 {
+		return 0, fmt.Errorf("无效的 wait 参数")
+	}
+	if wait > maxWait {
+		wait = maxWait
+	}
+	return wait, nil
+}
+
+// SubmitRequest 提交命令的请求
+type SubmitRequest struct {
+	HostName string   `json:"host_name"`
+	Command  string   `json:"command"`
+	Args     []string `json:"args"`
+}
+
+// SubmitCommand 向当前用户的主机提交一条命令，agent 在下一次轮询时领取
+func SubmitCommand(c *gin.Context) {
+	Username, exists := c.Get("username")
+	if !exists {
+		log.Printf("未找到用户名")
+		c.JSON(401, gin.H{
+			"code":    401,
+			"success": false,
+			"message": "未找到用户信息",
+		})
+		return
+	}
+	username := Username.(string)
+
+	var req SubmitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s := fmt.Sprintf("Invalid JSON data: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": s})
+		return
+	}
+	if len(req.HostName) == 0 {
+		log.Printf("名字出错！")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "主机名不能为空"})
+		return
+	}
+	if !namePattern.MatchString(req.Command) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "command 无效，只能包含字母、数字、点、下划线与短横线"})
+		return
+	}
+	if len(req.Args) > maxArgs {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("参数不能超过 %d 个", maxArgs)})
+		return
+	}
+	for _, arg := range req.Args {
+		if len(arg) > maxArgLen {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("单个参数不能超过 %d 字节", maxArgLen)})
+			return
+		}
+	}
+
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	owned, err := model.HostOwnedBy(db, req.HostName, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !owned {
+		c.JSON(http.StatusForbidden, gin.H{"error": "主机不存在或不属于当前用户"})
+		return
+	}
+
+	cmd, err := model.InsertCommand(db, req.HostName, req.Command, req.Args, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	waiters.notify("host:" + req.HostName)
+	log.Printf("用户 %s 向主机 %s 提交命令 #%d %s", username, req.HostName, cmd.ID, req.Command)
+	c.JSON(http.StatusOK, cmd)
+}
+
+// ListCommands 查询当前用户主机最近的命令，可按 host_name 过滤，limit 默认 50
+func ListCommands(c *gin.Context) {
+	Username, exists := c.Get("username")
+	if !exists {
+		log.Printf("未找到用户名")
+		c.JSON(401, gin.H{
+			"code":    401,
+			"success": false,
+			"message": "未找到用户信息",
+		})
+		return
+	}
+	username := Username.(string)
+
+	limit := 50
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 limit 参数，应为 1 到 1000"})
+			return
+		}
+		limit = n
+	}
+
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	if err := model.ExpireCommands(db, c.Query("host_name")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	cmds, err := model.ListCommands(db, username, c.Query("host_name"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, cmds)
+}
+
+// FollowCommand 查询命令的状态与 seq 大于 after 的输出
+// 没有新输出且命令未结束时最多等待 wait（默认 30s，最长 60s），wait=0 时立即返回
+func FollowCommand(c *gin.Context) {
+	Username, exists := c.Get("username")
+	if !exists {
+		log.Printf("未找到用户名")
+		c.JSON(401, gin.H{
+			"code":    401,
+			"success": false,
+			"message": "未找到用户信息",
+		})
+		return
+	}
+	username := Username.(string)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的命令 ID"})
+		return
+	}
+	after, err := strconv.Atoi(c.DefaultQuery("after", "0"))
+	if err != nil || after < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 after 参数"})
+		return
+	}
+	wait, err := parseWait(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	deadline := time.Now().Add(wait)
+	for {
+		ch := waiters.channel(fmt.Sprintf("cmd:%d", id))
+		cmd, err := model.ReadCommand(db, id)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "命令不存在"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		owned, err := model.HostOwnedBy(db, cmd.HostName, username)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !owned {
+			c.JSON(http.StatusNotFound, gin.H{"error": "命令不存在"})
+			return
+		}
+		// agent 异常退出时命令不会回传结果，超过期限后在此结束
+		if cmd.Status == model.CommandQueued || cmd.Status == model.CommandRunning {
+			if err := model.ExpireCommands(db, cmd.HostName); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if cmd, err = model.ReadCommand(db, id); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		output, err := model.ReadCommandOutput(db, id, after)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		finished := cmd.Status == model.CommandDone || cmd.Status == model.CommandExpired
+		if len(output) > 0 || finished || !waitFor(c, ch, deadline) {
+			c.JSON(http.StatusOK, gin.H{"command": cmd, "output": output})
+			return
+		}
+	}
+}
+
+// PollCommands agent 领取待执行的命令，请求由 AgentSignatureMiddleware 校验签名
+// max 为 agent 还能同时执行的命令数，没有待执行的命令时最多等待 wait；timeout 为 agent 允许列表中最长的超时时间
+func PollCommands(c *gin.Context) {
+	hostname := c.GetString("agent_host")
+	if err := middlewire.CheckClientCert(c, hostname); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	max, err := strconv.Atoi(c.DefaultQuery("max", "1"))
+	if err != nil || max <= 0 || max > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 max 参数，应为 1 到 100"})
+		return
+	}
+	wait, err := parseWait(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	timeout := model.DefaultCommandTimeout
+	if v := c.Query("timeout"); v != "" {
+		timeout, err = time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 timeout 参数"})
+			return
+		}
+		if timeout > model.MaxCommandTimeout {
+			timeout = model.MaxCommandTimeout
+		}
+	}
+
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	deadline := time.Now().Add(wait)
+	for {
+		ch := waiters.channel("host:" + hostname)
+		cmds, err := model.ClaimCommands(db, hostname, max, timeout)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(cmds) > 0 || !waitFor(c, ch, deadline) {
+			for _, cmd := range cmds {
+				waiters.notify(fmt.Sprintf("cmd:%d", cmd.ID))
+			}
+			c.JSON(http.StatusOK, gin.H{"commands": cmds})
+			return
+		}
+	}
+}
+
+// OutputRequest agent 回传的输出，Result 不为空时表示命令已结束
+type OutputRequest struct {
+	Output []model.CommandOutput `json:"output"`
+	Result *model.CommandResult  `json:"result"`
+}
+
+// ReportOutput 保存 agent 回传的命令输出与结果，请求由 AgentSignatureMiddleware 校验签名
+func ReportOutput(c *gin.Context) {
+	hostname := c.GetString("agent_host")
+	if err := middlewire.CheckClientCert(c, hostname); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的命令 ID"})
+		return
+	}
+	var req OutputRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s := fmt.Sprintf("Invalid JSON data: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": s})
+		return
+	}
+	for _, o := range req.Output {
+		if o.Seq <= 0 || (o.Stream != "stdout" && o.Stream != "stderr") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "输出的 seq 必须大于 0，stream 只能是 stdout 或 stderr"})
+			return
+		}
+	}
+
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	err = model.AppendCommandOutput(db, id, hostname, req.Output, req.Result)
+	if err == model.ErrCommandNotRunning {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	waiters.notify(fmt.Sprintf("cmd:%d", id))
+	if req.Result != nil {
+		log.Printf("主机 %s 的命令 #%d 执行结束，退出码 %d", hostname, id, req.Result.ExitCode)
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -52,8 +53,21 @@ func InstallAgent(c *gin.Context) {
 	}
 	agentInfo.Token = token
 
+	// 从上下文中获取用户名，agent 上报数据时主机归属于该用户
+	Username, exists := c.Get("username")
+	if !exists {
+		log.Printf("未找到用户名")
+		c.JSON(401, gin.H{
+			"code":    401,
+			"success": false,
+			"message": "未找到用户信息",
+		})
+		return
+	}
+	username := Username.(string)
+
 	// 存储host_name和token到数据库
-	err = model.InsertHostandToken(model.DB, agentInfo.Host_Name, agentInfo.Token)
+	err = model.InsertHostandToken(model.DB, agentInfo.Host_Name, agentInfo.Token, username)
 	if err != nil {
 		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert host info into database"})
 		return
@@ -126,6 +140,7 @@ func DoInstallAgent(ss SshInfo) error {
 		[Service]
 		Type=simple
 		ExecStart=$HOME/agent/agent/main -host_name=%s -token=%s
+		ExecReload=/bin/kill -HUP \$MAINPID
 		Restart=always
 
 		[Install]
@@ -0,0 +1,249 @@
+package release
+
+import (
+	"cmd/server/model"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/lib/pq"
+)
+
+// 版本号与平台名会出现在文件路径中，只允许安全的字符
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// UploadRelease 上传 agent 升级文件
+// multipart 表单字段：version、os、arch、signature（对文件 SHA-256 摘要的 ed25519 签名，base64），文件字段 file
+func UploadRelease(c *gin.Context) {
+	version := c.PostForm("version")
+	goos := c.PostForm("os")
+	arch := c.PostForm("arch")
+	signature := c.PostForm("signature")
+	for field, v := range map[string]string{"version": version, "os": goos, "arch": arch} {
+		if !namePattern.MatchString(v) || v == "." || v == ".." {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s 无效，只能包含字母、数字、点、下划线与短横线", field)})
+			return
+		}
+	}
+	// 服务器必须配置公钥，只接受签名正确的文件，agent 始终会再校验一次
+	publicKey, err := base64.StdEncoding.DecodeString(os.Getenv("RELEASE_PUBLIC_KEY"))
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "服务器没有配置有效的 release.public_key，不能上传升级文件"})
+		return
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "signature 不是有效的 ed25519 签名"})
+		return
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少升级文件"})
+		return
+	}
+
+	// 先写入临时文件并计算摘要，校验通过后再替换
+	dir := filepath.Join(os.Getenv("RELEASE_DIR"), version, goos+"-"+arch)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("创建目录失败: %v", err)})
+		return
+	}
+	path := filepath.Join(dir, "agentmonitor")
+	sum, err := saveFile(file, path+".tmp")
+	if err != nil {
+		os.Remove(path + ".tmp")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !ed25519.Verify(ed25519.PublicKey(publicKey), sum, sig) {
+		os.Remove(path + ".tmp")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "签名校验失败"})
+		return
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		os.Remove(path + ".tmp")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("保存升级文件失败: %v", err)})
+		return
+	}
+
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	r := model.AgentRelease{
+		Version:   version,
+		OS:        goos,
+		Arch:      arch,
+		SHA256:    hex.EncodeToString(sum),
+		Signature: signature,
+		Size:      file.Size,
+		Path:      path,
+	}
+	if err := model.InsertAgentRelease(db, r); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("上传 agent 升级文件 %s %s/%s，sha256 %s", version, goos, arch, r.SHA256)
+	c.JSON(http.StatusOK, r)
+}
+
+// saveFile 保存上传的文件并返回其 SHA-256 摘要
+func saveFile(file *multipart.FileHeader, path string) ([]byte, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("读取上传文件失败: %v", err)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("保存升级文件失败: %v", err)
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(dst, h), src)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("保存升级文件失败: %v", err)
+	}
+	return h.Sum(nil), nil
+}
+
+// ListReleases 查询所有升级文件与目标版本
+func ListReleases(c *gin.Context) {
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	releases, err := model.ListAgentReleases(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	targets, err := model.ListTargetVersions(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"releases": releases, "targets": targets})
+}
+
+// TargetRequest 设置目标版本的请求，HostName 为空时对所有主机生效，Version 为空时取消
+type TargetRequest struct {
+	HostName string `json:"host_name"`
+	Version  string `json:"version"`
+}
+
+// SetTargetVersion 设置 agent 的目标版本，agent 在下一次心跳时收到并自动升级
+// 只能设置当前用户的主机，对所有主机生效的目标版本只有管理员能设置
+func SetTargetVersion(c *gin.Context) {
+	// 从上下文中获取用户名
+	Username, exists := c.Get("username")
+	if !exists {
+		log.Printf("未找到用户名")
+		c.JSON(401, gin.H{
+			"code":    401,
+			"success": false,
+			"message": "未找到用户信息",
+		})
+		return
+	}
+	username := Username.(string)
+
+	var req TargetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s := fmt.Sprintf("Invalid JSON data: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": s})
+		return
+	}
+	if req.HostName == "" {
+		req.HostName = model.TargetAllHosts
+	}
+
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	if req.HostName == model.TargetAllHosts {
+		admin, err := model.IsAdmin(db, username)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !admin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只有管理员能设置所有主机的目标版本"})
+			return
+		}
+	} else {
+		owner, err := model.HostOwner(db, req.HostName)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if owner != username {
+			c.JSON(http.StatusForbidden, gin.H{"error": "主机不存在或不属于当前用户"})
+			return
+		}
+	}
+
+	if req.Version != "" {
+		exists, err := model.AgentReleaseExists(db, req.Version)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("版本 %s 没有上传升级文件", req.Version)})
+			return
+		}
+	}
+	if err := model.SetTargetVersion(db, req.HostName, req.Version); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"host_name": req.HostName, "version": req.Version})
+}
+
+// DownloadRelease 下载升级文件，agent 通过签名校验文件，不需要认证
+func DownloadRelease(c *gin.Context) {
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	r, err := model.ReadAgentRelease(db, c.Param("version"), c.Param("os"), c.Param("arch"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "升级文件不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("X-Checksum-Sha256", r.SHA256)
+	c.FileAttachment(r.Path, "agentmonitor")
+}
@@ -1,11 +1,12 @@
 package monitor
 
 import (
+	"cmd/server/middlewire"
 	"cmd/server/model"
-	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/lib/pq"
@@ -14,24 +15,40 @@ import (
 // RequestData 用于接收系统监控数据的请求体
 // @Description RequestData 包含所有需要收集的系统信息
 type RequestData struct {
-	CPUInfo  []model.CPUInfo   `json:"cpu_info"`  // CPU 信息
-	HostInfo model.HostInfo    `json:"host_info"` // 主机信息
-	MemInfo  model.MemoryInfo  `json:"mem_info"`  // 内存信息
-	ProInfo  model.ProcessInfo `json:"pro_info"`  // 进程信息
-	NetInfo  model.NetworkInfo `json:"net_info"`  // 网络信息
+	CPUInfo     []model.CPUInfo      `json:"cpu_info"`     // CPU 信息
+	HostInfo    model.HostInfo       `json:"host_info"`    // 主机信息
+	MemInfo     model.MemoryInfo     `json:"mem_info"`     // 内存信息
+	ProInfo     model.ProcessSummary `json:"pro_info"`     // 进程概况
+	NetInfo     []model.NetworkInfo  `json:"net_info"`     // 网络信息
+	DiskInfo    []model.DiskInfo     `json:"disk_info"`    // 磁盘分区信息
+	DiskIOInfo  []model.DiskIOInfo   `json:"diskio_info"`  // 磁盘IO信息
+	ConnInfo    model.ConnInfo       `json:"conn_info"`    // 连接状态与监听端口
+	Checks      []model.CheckResult  `json:"checks"`       // 检查脚本结果
+	Probes      []model.ProbeResult  `json:"probes"`       // 拨测结果
+	LogEvents   []model.LogEvent     `json:"log_events"`   // 日志事件
+	Watchlist   []model.WatchStatus  `json:"watchlist"`    // 被监视进程状态
+	FileChanges []model.FileChange   `json:"file_changes"` // 文件完整性监控发现的变化
+	// 当前的登录会话，agent 未采集时没有该字段，不更新保存的会话
+	Sessions    []model.LoginSession `json:"sessions"`
+	LoginEvents []model.LoginEvent   `json:"login_events"` // sshd 登录事件
+	// 采集时间，agent 补发缓存数据时以此作为数据时间
+	CollectedAt time.Time `json:"collected_at"`
+	// 采集器错误，key 为采集器名称，出错的采集器对应字段为空
+	CollectorErrors map[string]string `json:"collector_errors"`
 }
 
 // AddSystemInfo 接收并处理系统监控数据
 //
 // @Summary 接收系统监控信息（CPU、内存、主机信息等）
-// @Description 该API用于接收客户端发送的系统监控数据，并验证token和JWT后将数据存储到数据库中。
+// @Description 该API用于接收 agent 发送的系统监控数据，校验 agent 签名后将数据存储到数据库中，主机归属于安装 agent 的用户。
 // @Tags Monitor
 // @Accept json
 // @Produce json
 // @Param request body RequestData true "请求体包含系统监控数据"
 // @Success 201 {object} map[string]string "成功响应"
 // @Failure 400 {object} map[string]string "无效的JSON数据或令牌长度错误"
-// @Failure 401 {object} map[string]string "授权头缺失或无效的token格式或无效的JWT token"
+// @Failure 401 {object} map[string]string "agent 签名校验失败"
+// @Failure 403 {object} map[string]string "主机没有所属用户"
 // @Failure 500 {object} map[string]string "数据库操作失败"
 // @Router /monitor [post]
 func ReceiveAndStoreSystemMetrics(c *gin.Context) {
@@ -51,22 +68,15 @@ func ReceiveAndStoreSystemMetrics(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": s})
 		return
 	}
-	tokenh := requestData.HostInfo.Token
-	var tokens string
-	querySQL := `
-	SELECT token 
-	FROM hostandtoken WHERE host_name = $1` //(SELECT 1 FROM hostandtoken WHERE host_name = $1)
-
-	err = db.QueryRow(querySQL, requestData.HostInfo.Hostname).Scan(&tokens)
-	if err == sql.ErrNoRows {
-		fmt.Println("No matching token.")
+	// 启用 mTLS 时客户端证书必须属于上报的主机
+	if err := middlewire.CheckClientCert(c, requestData.HostInfo.Hostname); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
 	}
-	if len(tokenh) != 16 {
-		//c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong token length"})
-		//return
-	} else if tokenh != tokens {
-		//c.JSON(http.StatusBadRequest, gin.H{"error": "Unequal string"})
-		//return
+	// 请求已由 agent 签名校验，主机名必须与签名的主机一致
+	if err := middlewire.CheckAgentHost(c, requestData.HostInfo.Hostname); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
 	}
 
 	// 更新心跳时间和状态为在线
@@ -80,19 +90,17 @@ func ReceiveAndStoreSystemMetrics(c *gin.Context) {
 		return
 	}
 
-	// 从解析的 token 中获取 username存入数据库
-	// 从上下文中获取用户名
-	Username, exists := c.Get("username")
-	if !exists {
-		log.Printf("未找到用户名")
-		c.JSON(401, gin.H{
-			"code":    401,
-			"success": false,
-			"message": "未找到用户信息",
-		})
+	// agent 请求不携带 JWT，主机所属的用户为安装 agent 的用户
+	username, err := model.HostOwner(db, requestData.HostInfo.Hostname)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if username == "" {
+		log.Printf("主机 %s 没有所属用户", requestData.HostInfo.Hostname)
+		c.JSON(http.StatusForbidden, gin.H{"error": "主机没有所属用户，请通过 /agent/install 安装 agent"})
 		return
 	}
-	username := Username.(string)
 
 	// 将数据插入数据库
 	// 插入 host_info 表
@@ -103,18 +111,114 @@ func ReceiveAndStoreSystemMetrics(c *gin.Context) {
 		return
 	}
 
-	// 插入 hostandtoken 表
-	err = model.InsertHostandToken(db, requestData.HostInfo.Hostname, tokenh)
+	// 插入 system_info 表
+	err = model.InsertSystemInfo(db, requestData.HostInfo.Hostname, requestData.CPUInfo, requestData.MemInfo, requestData.NetInfo, requestData.CollectedAt)
 	if err != nil {
-		s := fmt.Sprintf("Failed to insert host and token info %s", err)
+		s := fmt.Sprintf("Failed to insert system info: %s", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": s})
 		return
 	}
 
-	// 插入 system_info 表
-	err = model.InsertSystemInfo(db, requestData.HostInfo.Hostname, requestData.CPUInfo, requestData.MemInfo, requestData.ProInfo, requestData.NetInfo)
+	// 追加进程概况
+	err = model.InsertProcessInfo(db, requestData.HostInfo.Hostname, requestData.ProInfo, requestData.CollectedAt)
 	if err != nil {
-		s := fmt.Sprintf("Failed to insert system info: %s", err)
+		s := fmt.Sprintf("Failed to insert process info: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": s})
+		return
+	}
+
+	// 追加负载信息
+	err = model.InsertLoadInfo(db, requestData.HostInfo.Hostname, requestData.HostInfo, requestData.CollectedAt)
+	if err != nil {
+		s := fmt.Sprintf("Failed to insert load info: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": s})
+		return
+	}
+
+	// 追加磁盘信息
+	err = model.InsertDiskInfo(db, requestData.HostInfo.Hostname, requestData.DiskInfo, requestData.CollectedAt)
+	if err != nil {
+		s := fmt.Sprintf("Failed to insert disk info: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": s})
+		return
+	}
+
+	// 追加磁盘IO信息
+	err = model.InsertDiskIOInfo(db, requestData.HostInfo.Hostname, requestData.DiskIOInfo, requestData.CollectedAt)
+	if err != nil {
+		s := fmt.Sprintf("Failed to insert disk io info: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": s})
+		return
+	}
+
+	// 追加连接状态与监听端口信息
+	err = model.InsertConnInfo(db, requestData.HostInfo.Hostname, requestData.ConnInfo, requestData.CollectedAt)
+	if err != nil {
+		s := fmt.Sprintf("Failed to insert conn info: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": s})
+		return
+	}
+
+	// 追加检查脚本结果
+	err = model.InsertCheckResults(db, requestData.HostInfo.Hostname, requestData.Checks, requestData.CollectedAt)
+	if err != nil {
+		s := fmt.Sprintf("Failed to insert check results: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": s})
+		return
+	}
+
+	// 保存拨测结果
+	err = model.InsertProbeResults(db, requestData.HostInfo.Hostname, requestData.Probes)
+	if err != nil {
+		s := fmt.Sprintf("Failed to insert probe results: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": s})
+		return
+	}
+
+	// 保存日志事件
+	err = model.InsertLogEvents(db, requestData.HostInfo.Hostname, requestData.LogEvents)
+	if err != nil {
+		s := fmt.Sprintf("Failed to insert log events: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": s})
+		return
+	}
+
+	// 保存被监视进程状态及其变化
+	err = model.InsertWatchStatuses(db, requestData.HostInfo.Hostname, requestData.Watchlist, requestData.CollectedAt)
+	if err != nil {
+		s := fmt.Sprintf("Failed to insert watchlist: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": s})
+		return
+	}
+
+	// 保存文件变化审计事件
+	err = model.InsertFileChanges(db, requestData.HostInfo.Hostname, requestData.FileChanges)
+	if err != nil {
+		s := fmt.Sprintf("Failed to insert file changes: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": s})
+		return
+	}
+
+	// 保存登录会话与登录事件
+	if requestData.Sessions != nil {
+		err = model.SaveLoginSessions(db, requestData.HostInfo.Hostname, requestData.Sessions, requestData.CollectedAt)
+		if err != nil {
+			s := fmt.Sprintf("Failed to save sessions: %s", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": s})
+			return
+		}
+	}
+	err = model.InsertLoginEvents(db, requestData.HostInfo.Hostname, requestData.LoginEvents)
+	if err != nil {
+		s := fmt.Sprintf("Failed to insert login events: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": s})
+		return
+	}
+
+	// 追加采集器错误
+	err = model.InsertCollectorErrors(db, requestData.HostInfo.Hostname, requestData.CollectorErrors, requestData.CollectedAt)
+	if err != nil {
+		s := fmt.Sprintf("Failed to insert collector errors: %s", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": s})
 		return
 	}
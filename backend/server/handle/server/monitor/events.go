@@ -0,0 +1,110 @@
+package monitor
+
+import (
+	"cmd/server/model"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/lib/pq"
+)
+
+// 日志事件级别，由低到高
+var severities = []string{"info", "warning", "error", "critical"}
+
+// GetLogEvents 查询当前用户主机的日志事件，可按时间范围、级别与规则过滤
+func GetLogEvents(c *gin.Context) {
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	// 从上下文中获取用户名
+	Username, exists := c.Get("username")
+	if !exists {
+		log.Printf("未找到用户名")
+		c.JSON(401, gin.H{
+			"code":    401,
+			"success": false,
+			"message": "未找到用户信息",
+		})
+		return
+	}
+	username := Username.(string)
+
+	hostname := c.Param("hostname")
+	if len(hostname) == 0 {
+		log.Printf("名字出错！")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "主机名不能为空"})
+		return
+	}
+	owned, err := model.HostOwnedBy(db, hostname, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !owned {
+		c.JSON(http.StatusForbidden, gin.H{"error": "主机不存在或不属于当前用户"})
+		return
+	}
+
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter := model.EventFilter{From: from, To: to, Rule: c.Query("rule"), Limit: 1000}
+
+	// severity 为逗号分隔的级别列表，min_severity 表示不低于该级别
+	if s := c.Query("severity"); s != "" {
+		for _, sev := range strings.Split(s, ",") {
+			sev = strings.TrimSpace(sev)
+			if severityIndex(sev) < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 severity 参数: " + sev})
+				return
+			}
+			filter.Severities = append(filter.Severities, sev)
+		}
+	}
+	if s := c.Query("min_severity"); s != "" {
+		i := severityIndex(s)
+		if i < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 min_severity 参数: " + s})
+			return
+		}
+		if filter.Severities != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "severity 与 min_severity 不能同时使用"})
+			return
+		}
+		filter.Severities = severities[i:]
+	}
+
+	if s := c.Query("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit <= 0 || limit > 10000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 limit 参数，范围为 1-10000"})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	events, err := model.ReadLogEvents(db, hostname, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+func severityIndex(s string) int {
+	for i, sev := range severities {
+		if sev == s {
+			return i
+		}
+	}
+	return -1
+}
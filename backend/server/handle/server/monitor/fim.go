@@ -0,0 +1,175 @@
+package monitor
+
+import (
+	"cmd/server/model"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/lib/pq"
+)
+
+// 单次确认的变化数上限
+const maxAckIDs = 1000
+
+// parseFileChangeFilter 解析文件变化的查询参数：from、to、status（unacked、acked、all，默认 all）、path 前缀与 limit
+func parseFileChangeFilter(c *gin.Context) (model.FileChangeFilter, error) {
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return model.FileChangeFilter{}, err
+	}
+	filter := model.FileChangeFilter{From: from, To: to, Status: c.DefaultQuery("status", "all"), Path: c.Query("path"), Limit: 1000}
+	if filter.Status != "unacked" && filter.Status != "acked" && filter.Status != "all" {
+		return filter, fmt.Errorf("无效的 status 参数，可选值: unacked、acked、all")
+	}
+	if s := c.Query("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit <= 0 || limit > 10000 {
+			return filter, fmt.Errorf("无效的 limit 参数，范围为 1-10000")
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
+}
+
+// GetFileChanges 查询当前用户主机文件完整性监控发现的变化，可按时间范围、确认状态与路径前缀过滤
+func GetFileChanges(c *gin.Context) {
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	// 从上下文中获取用户名
+	Username, exists := c.Get("username")
+	if !exists {
+		log.Printf("未找到用户名")
+		c.JSON(401, gin.H{
+			"code":    401,
+			"success": false,
+			"message": "未找到用户信息",
+		})
+		return
+	}
+	username := Username.(string)
+
+	hostname := c.Param("hostname")
+	if len(hostname) == 0 {
+		log.Printf("名字出错！")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "主机名不能为空"})
+		return
+	}
+	owned, err := model.HostOwnedBy(db, hostname, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !owned {
+		c.JSON(http.StatusForbidden, gin.H{"error": "主机不存在或不属于当前用户"})
+		return
+	}
+
+	filter, err := parseFileChangeFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	changes, err := model.ReadFileChanges(db, hostname, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, changes)
+}
+
+// ListFileChanges 查询当前用户所有主机的文件变化，默认返回全部状态，status=unacked 时为待确认的变化
+func ListFileChanges(c *gin.Context) {
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	// 从上下文中获取用户名
+	Username, exists := c.Get("username")
+	if !exists {
+		log.Printf("未找到用户名")
+		c.JSON(401, gin.H{
+			"code":    401,
+			"success": false,
+			"message": "未找到用户信息",
+		})
+		return
+	}
+	username := Username.(string)
+
+	filter, err := parseFileChangeFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	changes, err := model.ListFileChanges(db, username, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, changes)
+}
+
+// AckRequest 确认文件变化的请求，ids 与 host_name 至少指定一个；只指定 host_name 时确认该主机所有未确认的变化
+type AckRequest struct {
+	IDs      []int64 `json:"ids"`
+	HostName string  `json:"host_name"`
+	Note     string  `json:"note"`
+}
+
+// AckFileChanges 确认当前用户主机的文件变化，记录确认人、时间与备注，已确认的变化不会被再次修改
+func AckFileChanges(c *gin.Context) {
+	// 从上下文中获取用户名
+	Username, exists := c.Get("username")
+	if !exists {
+		log.Printf("未找到用户名")
+		c.JSON(401, gin.H{
+			"code":    401,
+			"success": false,
+			"message": "未找到用户信息",
+		})
+		return
+	}
+	username := Username.(string)
+
+	var req AckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s := fmt.Sprintf("Invalid JSON data: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": s})
+		return
+	}
+	if len(req.IDs) == 0 && req.HostName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids 与 host_name 至少指定一个"})
+		return
+	}
+	if len(req.IDs) > maxAckIDs {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("ids 不能超过 %d 个", maxAckIDs)})
+		return
+	}
+
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	n, err := model.AckFileChanges(db, username, req.IDs, req.HostName, req.Note)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"acked": n})
+}
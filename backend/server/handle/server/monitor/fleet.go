@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"cmd/server/model"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/lib/pq"
+)
+
+// FleetListen 查询当前用户的哪些主机正在监听指定端口
+func FleetListen(c *gin.Context) {
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	// 从上下文中获取用户名
+	Username, exists := c.Get("username")
+	if !exists {
+		log.Printf("未找到用户名")
+		c.JSON(401, gin.H{
+			"code":    401,
+			"success": false,
+			"message": "未找到用户信息",
+		})
+		return
+	}
+	username := Username.(string)
+
+	port, err := strconv.ParseUint(c.Query("port"), 10, 16)
+	if err != nil || port == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 port 参数"})
+		return
+	}
+
+	hosts, err := model.FindListeningHosts(db, username, uint32(port))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, hosts)
+}
+
+// FleetListenChanges 查询当前用户所有主机自 since 以来监听端口的变化，默认为最近 24 小时
+func FleetListenChanges(c *gin.Context) {
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	// 从上下文中获取用户名
+	Username, exists := c.Get("username")
+	if !exists {
+		log.Printf("未找到用户名")
+		c.JSON(401, gin.H{
+			"code":    401,
+			"success": false,
+			"message": "未找到用户信息",
+		})
+		return
+	}
+	username := Username.(string)
+
+	since := time.Now().Add(-24 * time.Hour)
+	if s := c.Query("since"); s != "" {
+		since, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 since 时间格式"})
+			return
+		}
+	}
+
+	changes, err := model.ListListenChanges(db, username, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, changes)
+}
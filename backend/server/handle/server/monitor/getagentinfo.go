@@ -44,5 +44,23 @@ func GetAgentInfo(c *gin.Context) {
 		log.Printf("error:%f", err)
 		return
 	}
+	// 只查看指定网卡
+	if iface := c.Query("iface"); iface != "" {
+		model.FilterNetInterface(result, iface)
+	}
+	// 只查看进程概况的指定部分
+	if view := c.Query("process_view"); view != "" {
+		valid := false
+		for _, v := range model.ProcessViews {
+			if v == view {
+				valid = true
+			}
+		}
+		if !valid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 process_view 参数"})
+			return
+		}
+		model.FilterProcessView(result, view)
+	}
 	c.JSON(http.StatusOK, result)
 }
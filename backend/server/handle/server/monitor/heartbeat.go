@@ -0,0 +1,129 @@
+package monitor
+
+import (
+	"cmd/server/middlewire"
+	"cmd/server/model"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/lib/pq"
+)
+
+// ReceiveHeartbeat 接收 agent 心跳，更新主机在线状态并保存 agent 运行状态
+// 心跳不经过 JWT 认证，由 AgentSignatureMiddleware 校验 agent 使用主机 token 做的签名
+func ReceiveHeartbeat(c *gin.Context) {
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	var hb model.Heartbeat
+	if err := c.ShouldBindJSON(&hb); err != nil {
+		s := fmt.Sprintf("Invalid JSON data: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": s})
+		return
+	}
+	if len(hb.HostName) == 0 {
+		log.Printf("名字出错！")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "主机名不能为空"})
+		return
+	}
+	if err := middlewire.CheckClientCert(c, hb.HostName); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err := middlewire.CheckAgentHost(c, hb.HostName); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := model.UpdateAgentHealth(db, hb); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 主机运行的版本与目标版本不一致时下发升级信息，查询失败不影响心跳
+	resp := gin.H{"status": "ok"}
+	release, err := model.DesiredRelease(db, hb.HostName, hb.OS, hb.Arch)
+	if err != nil {
+		log.Printf("查询主机 %s 的目标版本失败: %v", hb.HostName, err)
+	} else if release != nil && release.Version != hb.Version {
+		resp["update"] = gin.H{
+			"version":   release.Version,
+			"url":       releaseURL(c, *release),
+			"sha256":    release.SHA256,
+			"signature": release.Signature,
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// releaseURL 升级文件的下载地址，与心跳使用相同的服务器地址
+func releaseURL(c *gin.Context, r model.AgentRelease) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	u := url.URL{Scheme: scheme, Host: c.Request.Host, Path: path.Join("/agent/download", r.Version, r.OS, r.Arch)}
+	return u.String()
+}
+
+// GetAgentHealth 查询当前用户主机最近一次心跳中的 agent 运行状态
+func GetAgentHealth(c *gin.Context) {
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	// 从上下文中获取用户名
+	Username, exists := c.Get("username")
+	if !exists {
+		log.Printf("未找到用户名")
+		c.JSON(401, gin.H{
+			"code":    401,
+			"success": false,
+			"message": "未找到用户信息",
+		})
+		return
+	}
+	username := Username.(string)
+
+	hostname := c.Param("hostname")
+	if len(hostname) == 0 {
+		log.Printf("名字出错！")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "主机名不能为空"})
+		return
+	}
+	owned, err := model.HostOwnedBy(db, hostname, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !owned {
+		c.JSON(http.StatusForbidden, gin.H{"error": "主机不存在或不属于当前用户"})
+		return
+	}
+
+	health, err := model.ReadAgentHealth(db, hostname)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "该主机没有心跳记录"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, health)
+}
@@ -0,0 +1,190 @@
+package monitor
+
+import (
+	"cmd/server/model"
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/lib/pq"
+)
+
+// GetLoginSessions 查询当前用户主机最近一次上报的登录会话，主机没有上报过会话时返回 404
+func GetLoginSessions(c *gin.Context) {
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	// 从上下文中获取用户名
+	Username, exists := c.Get("username")
+	if !exists {
+		log.Printf("未找到用户名")
+		c.JSON(401, gin.H{
+			"code":    401,
+			"success": false,
+			"message": "未找到用户信息",
+		})
+		return
+	}
+	username := Username.(string)
+
+	hostname := c.Param("hostname")
+	if len(hostname) == 0 {
+		log.Printf("名字出错！")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "主机名不能为空"})
+		return
+	}
+	owned, err := model.HostOwnedBy(db, hostname, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !owned {
+		c.JSON(http.StatusForbidden, gin.H{"error": "主机不存在或不属于当前用户"})
+		return
+	}
+
+	sessions, err := model.ReadLoginSessions(db, hostname)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "该主机没有登录会话记录"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+// GetLoginEvents 查询当前用户主机的登录历史，可按时间范围、结果、用户与来源 IP 过滤
+func GetLoginEvents(c *gin.Context) {
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	// 从上下文中获取用户名
+	Username, exists := c.Get("username")
+	if !exists {
+		log.Printf("未找到用户名")
+		c.JSON(401, gin.H{
+			"code":    401,
+			"success": false,
+			"message": "未找到用户信息",
+		})
+		return
+	}
+	username := Username.(string)
+
+	hostname := c.Param("hostname")
+	if len(hostname) == 0 {
+		log.Printf("名字出错！")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "主机名不能为空"})
+		return
+	}
+	owned, err := model.HostOwnedBy(db, hostname, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !owned {
+		c.JSON(http.StatusForbidden, gin.H{"error": "主机不存在或不属于当前用户"})
+		return
+	}
+
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter := model.LoginFilter{
+		From:     from,
+		To:       to,
+		Result:   c.Query("result"),
+		User:     c.Query("user"),
+		SourceIP: c.Query("source_ip"),
+		Limit:    1000,
+	}
+	if filter.Result != "" && filter.Result != "success" && filter.Result != "failure" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 result 参数，可选值: success、failure"})
+		return
+	}
+	if s := c.Query("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit <= 0 || limit > 10000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 limit 参数，范围为 1-10000"})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	events, err := model.ReadLoginEvents(db, hostname, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+// FleetFailedLogins 统计当前用户所有主机自 since 以来按来源 IP 汇总的登录失败，默认为最近 24 小时
+func FleetFailedLogins(c *gin.Context) {
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	// 从上下文中获取用户名
+	Username, exists := c.Get("username")
+	if !exists {
+		log.Printf("未找到用户名")
+		c.JSON(401, gin.H{
+			"code":    401,
+			"success": false,
+			"message": "未找到用户信息",
+		})
+		return
+	}
+	username := Username.(string)
+
+	since := time.Now().Add(-24 * time.Hour)
+	if s := c.Query("since"); s != "" {
+		since, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 since 时间格式"})
+			return
+		}
+	}
+	minFailures := 1
+	if s := c.Query("min_failures"); s != "" {
+		minFailures, err = strconv.Atoi(s)
+		if err != nil || minFailures <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 min_failures 参数"})
+			return
+		}
+	}
+	limit := 100
+	if s := c.Query("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit <= 0 || limit > 10000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 limit 参数，范围为 1-10000"})
+			return
+		}
+	}
+
+	sources, err := model.CountFailedLogins(db, username, since, minFailures, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sources)
+}
@@ -0,0 +1,80 @@
+package monitor
+
+import (
+	"cmd/server/model"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/lib/pq"
+)
+
+// GetProbeResults 查询当前用户主机的拨测历史，可按拨测名称与时间范围过滤
+func GetProbeResults(c *gin.Context) {
+	db, err := model.InitDB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库初始化失败"})
+		return
+	}
+	defer db.Close()
+
+	// 从上下文中获取用户名
+	Username, exists := c.Get("username")
+	if !exists {
+		log.Printf("未找到用户名")
+		c.JSON(401, gin.H{
+			"code":    401,
+			"success": false,
+			"message": "未找到用户信息",
+		})
+		return
+	}
+	username := Username.(string)
+
+	hostname := c.Param("hostname")
+	if len(hostname) == 0 {
+		log.Printf("名字出错！")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "主机名不能为空"})
+		return
+	}
+	owned, err := model.HostOwnedBy(db, hostname, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !owned {
+		c.JSON(http.StatusForbidden, gin.H{"error": "主机不存在或不属于当前用户"})
+		return
+	}
+
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results, err := model.ReadProbeResults(db, hostname, c.Query("name"), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// parseTimeRange 解析 from 与 to 查询参数，未提供时不限制
+func parseTimeRange(c *gin.Context) (time.Time, time.Time, error) {
+	from := c.DefaultQuery("from", "1970-01-01T00:00:00Z")
+	to := c.DefaultQuery("to", "9999-12-31T23:59:59Z")
+
+	fromTime, err := time.Parse(time.RFC3339, from)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("无效的 from 时间格式，需要 RFC3339 格式")
+	}
+	toTime, err := time.Parse(time.RFC3339, to)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("无效的 to 时间格式，需要 RFC3339 格式")
+	}
+	return fromTime, toTime, nil
+}
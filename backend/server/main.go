@@ -2,7 +2,10 @@ package main
 
 import (
 	"cmd/server/config"
+	"cmd/server/handle/agent/agentconfig"
+	"cmd/server/handle/agent/command"
 	"cmd/server/handle/agent/install"
+	"cmd/server/handle/agent/release"
 	"cmd/server/handle/server/monitor" // 引入 monitor 包
 	"cmd/server/handle/user/info"
 	"cmd/server/handle/user/login"
@@ -14,6 +17,7 @@ import (
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"log"
+	"net/http"
 	"os"
 
 	"github.com/gin-gonic/gin"
@@ -51,6 +55,12 @@ func main() {
 	os.Setenv("REDIS_ADDR", config.Redis.Addr)
 	os.Setenv("REDIS_PASSWORD", config.Redis.Password)
 	os.Setenv("REDIS_DB", config.Redis.DB)
+	// agent 升级文件
+	if config.Release.Dir == "" {
+		config.Release.Dir = "./releases"
+	}
+	os.Setenv("RELEASE_DIR", config.Release.Dir)
+	os.Setenv("RELEASE_PUBLIC_KEY", config.Release.PublicKey)
 
 	// fmt.Println(os.Getenv("DB_USER"))
 	// fmt.Println(os.Getenv("DB_PASSWORD"))
@@ -84,6 +94,17 @@ func main() {
 
 	router.POST("/agent/register", login.Register)
 	router.POST("/agent/login", login.Login)
+	// agent 心跳，校验 agent 使用主机 token 做的签名
+	router.POST("/agent/heartbeat", middlewire.AgentSignatureMiddleware(), monitor.ReceiveHeartbeat)
+	// agent 上报监控数据，校验签名，主机归属于安装 agent 的用户
+	router.POST("/agent/addSystemInfo", middlewire.AgentSignatureMiddleware(), monitor.ReceiveAndStoreSystemMetrics)
+	// agent 升级文件下载，agent 自行校验签名
+	router.GET("/agent/download/:version/:os/:arch", release.DownloadRelease)
+	// agent 获取下发的配置，校验签名
+	router.GET("/agent/config", middlewire.AgentSignatureMiddleware(), agentconfig.FetchConfig)
+	// agent 领取远程命令并回传输出，校验签名
+	router.GET("/agent/commands/poll", middlewire.AgentSignatureMiddleware(), command.PollCommands)
+	router.POST("/agent/commands/:id/output", middlewire.AgentSignatureMiddleware(), command.ReportOutput)
 	// 需要 JWT 认证的路由
 	auth := router.Group("/agent", middlewire.JWTAuthMiddleware())
 	{
@@ -94,12 +115,49 @@ func main() {
 		auth.POST("/request_reset_password", update.RequestResetPassword)
 		// 监控
 		auth.POST("/install", install.InstallAgent)
-		auth.POST("/addSystemInfo", monitor.ReceiveAndStoreSystemMetrics)
-		auth.POST("/addSystemInfo", monitor.ReceiveAndStoreSystemMetrics)
 		auth.GET("/list", monitor.ListAgent)
+		// agent 升级
+		auth.POST("/releases", release.UploadRelease)
+		auth.GET("/releases", release.ListReleases)
+		auth.PUT("/releases/target", release.SetTargetVersion)
+		// agent 下发配置
+		auth.GET("/configs", agentconfig.ListConfigs)
+		auth.GET("/configs/status", agentconfig.ConfigStatus)
+		auth.GET("/configs/:scope/:name", agentconfig.GetConfig)
+		auth.PUT("/configs/:scope/:name", agentconfig.SaveConfig)
+		auth.DELETE("/configs/:scope/:name", agentconfig.DeleteConfig)
+		auth.PUT("/groups/:group/hosts", agentconfig.SetGroupHosts)
+		// 远程命令
+		auth.POST("/commands", command.SubmitCommand)
+		auth.GET("/commands", command.ListCommands)
+		auth.GET("/commands/:id", command.FollowCommand)
+		auth.GET("/fleet/listen", monitor.FleetListen)
+		auth.GET("/fleet/listen/changes", monitor.FleetListenChanges)
+		auth.GET("/fleet/logins/failed", monitor.FleetFailedLogins)
+		auth.GET("/fim/events", monitor.ListFileChanges)
+		auth.POST("/fim/ack", monitor.AckFileChanges)
 		router.GET("/monitor/:hostname", monitor.GetAgentInfo)
 		router.GET("/monitor/:hostname", monitor.GetAgentInfo)
+		// 主机监控与审计数据需要 JWT，只能查询当前用户的主机
+		router.GET("/monitor/:hostname/probes", middlewire.JWTAuthMiddleware(), monitor.GetProbeResults)
+		router.GET("/monitor/:hostname/events", middlewire.JWTAuthMiddleware(), monitor.GetLogEvents)
+		router.GET("/monitor/:hostname/watchlist", middlewire.JWTAuthMiddleware(), monitor.GetWatchTransitions)
+		router.GET("/monitor/:hostname/health", middlewire.JWTAuthMiddleware(), monitor.GetAgentHealth)
+		router.GET("/monitor/:hostname/fim", middlewire.JWTAuthMiddleware(), monitor.GetFileChanges)
+		router.GET("/monitor/:hostname/sessions", middlewire.JWTAuthMiddleware(), monitor.GetLoginSessions)
+		router.GET("/monitor/:hostname/logins", middlewire.JWTAuthMiddleware(), monitor.GetLoginEvents)
 	}
 
-	router.Run("0.0.0.0:8080")
+	// 配置了证书时使用 HTTPS
+	tlsConfig, err := config.TLS.ServerTLS()
+	if err != nil {
+		log.Fatalf("TLS 配置错误: %v", err)
+	}
+	if tlsConfig == nil {
+		router.Run("0.0.0.0:8080")
+		return
+	}
+	middlewire.MTLS = config.TLS.MTLS
+	srv := &http.Server{Addr: "0.0.0.0:8080", Handler: router, TLSConfig: tlsConfig}
+	log.Fatal(srv.ListenAndServeTLS(config.TLS.CertFile, config.TLS.KeyFile))
 }
@@ -0,0 +1,34 @@
+package middlewire
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MTLS 为 true 时，agent 上报的接口要求客户端证书的 CN 或 SAN 与主机名一致，由 main 按配置设置
+var MTLS bool
+
+// CheckClientCert 启用 mTLS 时检查请求的客户端证书是否属于该主机
+// 证书链已在 TLS 握手时由 client_ca_file 校验，这里只比较主机名
+func CheckClientCert(c *gin.Context, hostname string) error {
+	if !MTLS {
+		return nil
+	}
+	state := c.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return errors.New("缺少有效的客户端证书")
+	}
+	cert := state.VerifiedChains[0][0]
+	if strings.EqualFold(cert.Subject.CommonName, hostname) {
+		return nil
+	}
+	for _, name := range cert.DNSNames {
+		if strings.EqualFold(name, hostname) {
+			return nil
+		}
+	}
+	return fmt.Errorf("客户端证书 %q 与主机 %s 不一致", cert.Subject.CommonName, hostname)
+}
@@ -0,0 +1,175 @@
+package middlewire
+
+import (
+	"bytes"
+	"cmd/server/model"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// agent 请求签名使用的请求头
+const (
+	HeaderAgentHost      = "X-Agent-Host"
+	HeaderAgentTimestamp = "X-Agent-Timestamp"
+	HeaderAgentNonce     = "X-Agent-Nonce"
+	HeaderAgentSignature = "X-Agent-Signature"
+)
+
+// SignatureMaxSkew 请求时间戳与服务器时间允许的最大偏差，nonce 至少保留两倍于此的时间
+const SignatureMaxSkew = 5 * time.Minute
+
+// 请求体上限，与 gin 默认的 multipart 内存上限一致
+const maxSignedBody = 32 << 20
+
+// 过期 nonce 的清理每分钟最多进行一次
+var (
+	purgeMu   sync.Mutex
+	lastPurge time.Time
+)
+
+// useNonce 记录 nonce，已经使用过时返回 false
+// nonce 保存在数据库中，服务器重启后或部署多个实例时仍能发现重放的请求
+var useNonce = func(host, nonce string, now time.Time) (bool, error) {
+	db, err := model.InitDB()
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	purgeMu.Lock()
+	purge := now.Sub(lastPurge) > time.Minute
+	if purge {
+		lastPurge = now
+	}
+	purgeMu.Unlock()
+	if purge {
+		if err := model.PurgeAgentNonces(db, now.Add(-2*SignatureMaxSkew)); err != nil {
+			log.Printf("清理过期的 nonce 失败: %v", err)
+		}
+	}
+	return model.UseAgentNonce(db, host, nonce, now)
+}
+
+// SignatureString agent 签名的内容：方法、路径（含查询参数）、时间戳、nonce 与请求体的 SHA-256，以换行分隔
+func SignatureString(method, uri, timestamp, nonce string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return method + "\n" + uri + "\n" + timestamp + "\n" + nonce + "\n" + hex.EncodeToString(sum[:])
+}
+
+// AgentSignatureMiddleware 校验 agent 使用主机 token 对请求做的 HMAC-SHA256 签名
+// 校验通过后将主机名保存到上下文的 agent_host 中，处理函数需确认请求体中的主机名与之一致
+func AgentSignatureMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		host := c.GetHeader(HeaderAgentHost)
+		timestamp := c.GetHeader(HeaderAgentTimestamp)
+		nonce := c.GetHeader(HeaderAgentNonce)
+		signature := c.GetHeader(HeaderAgentSignature)
+		for _, h := range []struct{ name, value string }{
+			{HeaderAgentHost, host},
+			{HeaderAgentTimestamp, timestamp},
+			{HeaderAgentNonce, nonce},
+			{HeaderAgentSignature, signature},
+		} {
+			if h.value == "" {
+				abortUnauthorized(c, fmt.Sprintf("缺少请求头 %s", h.name))
+				return
+			}
+		}
+
+		// 先检查时间戳，过期的请求不必查询数据库
+		now := time.Now()
+		sec, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			abortUnauthorized(c, "时间戳格式错误，应为 Unix 秒")
+			return
+		}
+		if skew := time.Unix(sec, 0).Sub(now); skew > SignatureMaxSkew {
+			abortUnauthorized(c, fmt.Sprintf("时间戳比服务器时间快 %v，超过允许的 %v，请检查 agent 时钟", skew.Round(time.Second), SignatureMaxSkew))
+			return
+		} else if -skew > SignatureMaxSkew {
+			abortUnauthorized(c, fmt.Sprintf("时间戳比服务器时间慢 %v，超过允许的 %v，请检查 agent 时钟或是否为重放的请求", (-skew).Round(time.Second), SignatureMaxSkew))
+			return
+		}
+		if len(nonce) < 16 || len(nonce) > 64 {
+			abortUnauthorized(c, "nonce 长度应为 16 到 64 个字符")
+			return
+		}
+		sig, err := hex.DecodeString(signature)
+		if err != nil {
+			abortUnauthorized(c, "签名格式错误，应为十六进制")
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxSignedBody))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("读取请求体失败: %v", err)})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		token, err := hostToken(host)
+		if err == sql.ErrNoRows {
+			abortUnauthorized(c, "主机未注册")
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "查询主机 token 失败"})
+			return
+		}
+
+		mac := hmac.New(sha256.New, []byte(token))
+		mac.Write([]byte(SignatureString(c.Request.Method, c.Request.URL.RequestURI(), timestamp, nonce, body)))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			abortUnauthorized(c, "签名错误")
+			return
+		}
+		// 签名正确后才记录 nonce，避免伪造的请求占用 nonce
+		fresh, err := useNonce(host, nonce, now)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "记录 nonce 失败"})
+			return
+		}
+		if !fresh {
+			abortUnauthorized(c, "nonce 已使用，疑似重放的请求")
+			return
+		}
+
+		c.Set("agent_host", host)
+		c.Next()
+	}
+}
+
+// hostToken 查询安装 agent 时分配给主机的 token，主机未注册时返回 sql.ErrNoRows
+var hostToken = func(host string) (string, error) {
+	db, err := model.InitDB()
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	var token string
+	err = db.QueryRow("SELECT token FROM hostandtoken WHERE host_name = $1", host).Scan(&token)
+	return token, err
+}
+
+// CheckAgentHost 确认请求体中的主机名与签名的主机一致
+func CheckAgentHost(c *gin.Context, hostname string) error {
+	if signed := c.GetString("agent_host"); signed != hostname {
+		return fmt.Errorf("请求中的主机 %s 与签名的主机 %s 不一致", hostname, signed)
+	}
+	return nil
+}
+
+func abortUnauthorized(c *gin.Context, reason string) {
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": reason})
+}
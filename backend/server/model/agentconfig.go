@@ -0,0 +1,317 @@
+package model
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// 下发配置的范围
+const (
+	ConfigScopeHost  = "host"
+	ConfigScopeGroup = "group"
+)
+
+// ForbiddenConfigKeys 下发的配置不能修改的字段，嵌套字段以 . 分隔；agent 同样会拒绝
+// 避免下发错误的配置后 agent 无法再连接服务器，或通过下发配置让 agent 执行命令（commands、checks）、改变指标的监听地址、读写任意本机文件
+var ForbiddenConfigKeys = []string{"host_name", "token", "server", "tls", "update", "remote_config", "commands", "checks", "metrics.listen",
+	"logwatch.files", "fim.paths", "fim.baseline_file", "logins.auth_logs", "spool.dir", "log.file"}
+
+// AgentConfig 服务器保存的一份 agent 配置（YAML），合并在 agent 的本地配置之上
+// 主机所属分组的配置按 Priority 从小到大依次合并，主机自身的配置最后合并
+type AgentConfig struct {
+	Scope     string    `json:"scope"`
+	Name      string    `json:"name"` // 主机名或分组名
+	Content   string    `json:"content"`
+	Priority  int       `json:"priority"`
+	Version   int       `json:"version"` // 每次修改加 1
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ValidateConfigContent 检查配置是否为 YAML 映射，且不包含禁止下发的字段
+func ValidateConfigContent(content string) error {
+	var m map[string]interface{}
+	if err := yaml.Unmarshal([]byte(content), &m); err != nil {
+		return fmt.Errorf("配置不是有效的 YAML 映射: %v", err)
+	}
+	for _, key := range ForbiddenConfigKeys {
+		if hasConfigKey(m, key) {
+			return fmt.Errorf("不允许下发 %s", key)
+		}
+	}
+	return nil
+}
+
+// hasConfigKey 判断配置中是否包含以 . 分隔的嵌套字段
+func hasConfigKey(m map[string]interface{}, key string) bool {
+	first, rest, nested := strings.Cut(key, ".")
+	v, ok := m[first]
+	if !ok || !nested {
+		return ok
+	}
+	sub, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return false
+	}
+	sm := make(map[string]interface{}, len(sub))
+	for k, v := range sub {
+		sm[fmt.Sprint(k)] = v
+	}
+	return hasConfigKey(sm, rest)
+}
+
+// SaveAgentConfig 新增或修改配置，返回保存后的配置，username 为保存配置的用户
+func SaveAgentConfig(db *sql.DB, scope, name, content string, priority int, username string) (AgentConfig, error) {
+	c := AgentConfig{Scope: scope, Name: name, Content: content, Priority: priority}
+	err := db.QueryRow(`
+	INSERT INTO agent_configs (scope, name, content, priority, version, updated_at, user_name)
+	VALUES ($1, $2, $3, $4, 1, $5, $6)
+	ON CONFLICT (scope, name) DO UPDATE SET
+		content = EXCLUDED.content, priority = EXCLUDED.priority,
+		version = agent_configs.version + 1, updated_at = EXCLUDED.updated_at, user_name = EXCLUDED.user_name
+	RETURNING version, updated_at`,
+		scope, name, content, priority, time.Now().UTC(), username).Scan(&c.Version, &c.UpdatedAt)
+	if err != nil {
+		return AgentConfig{}, fmt.Errorf("failed to save agent config: %v", err)
+	}
+	c.UpdatedAt = c.UpdatedAt.UTC()
+	return c, nil
+}
+
+// ReadAgentConfig 查询一份配置，不存在时返回 sql.ErrNoRows
+func ReadAgentConfig(db *sql.DB, scope, name string) (AgentConfig, error) {
+	c := AgentConfig{Scope: scope, Name: name}
+	err := db.QueryRow(`
+	SELECT content, priority, version, updated_at
+	FROM agent_configs
+	WHERE scope = $1 AND name = $2`, scope, name).Scan(&c.Content, &c.Priority, &c.Version, &c.UpdatedAt)
+	if err != nil {
+		return AgentConfig{}, err
+	}
+	c.UpdatedAt = c.UpdatedAt.UTC()
+	return c, nil
+}
+
+// ListAgentConfigs 查询用户可见的配置：用户主机的配置与用户的分组配置
+func ListAgentConfigs(db *sql.DB, username string) ([]AgentConfig, error) {
+	rows, err := db.Query(`
+	SELECT scope, name, content, priority, version, updated_at
+	FROM agent_configs
+	WHERE (scope = $1 AND name IN (SELECT host_name FROM host_info WHERE user_name = $3))
+		OR (scope = $2 AND user_name = $3)
+	ORDER BY scope, priority, name`, ConfigScopeHost, ConfigScopeGroup, username)
+	if err != nil {
+		return nil, fmt.Errorf("查询配置失败: %v", err)
+	}
+	defer rows.Close()
+
+	configs := []AgentConfig{}
+	for rows.Next() {
+		var c AgentConfig
+		if err := rows.Scan(&c.Scope, &c.Name, &c.Content, &c.Priority, &c.Version, &c.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("读取配置失败: %v", err)
+		}
+		c.UpdatedAt = c.UpdatedAt.UTC()
+		configs = append(configs, c)
+	}
+	return configs, rows.Err()
+}
+
+// DeleteAgentConfig 删除配置，返回是否存在
+func DeleteAgentConfig(db *sql.DB, scope, name string) (bool, error) {
+	res, err := db.Exec(`DELETE FROM agent_configs WHERE scope = $1 AND name = $2`, scope, name)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete agent config: %v", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete agent config: %v", err)
+	}
+	return n > 0, nil
+}
+
+// GroupOwnedBy 分组是否属于该用户：分组的配置与成员都由该用户设置，还不存在的分组可以由任何用户创建
+func GroupOwnedBy(db *sql.DB, group, username string) (bool, error) {
+	var owned bool
+	err := db.QueryRow(`
+	SELECT NOT EXISTS (SELECT 1 FROM agent_configs WHERE scope = $1 AND name = $2 AND user_name IS DISTINCT FROM $3)
+		AND NOT EXISTS (SELECT 1 FROM host_group_members WHERE group_name = $2 AND user_name IS DISTINCT FROM $3)`,
+		ConfigScopeGroup, group, username).Scan(&owned)
+	if err != nil {
+		return false, fmt.Errorf("查询分组信息失败: %v", err)
+	}
+	return owned, nil
+}
+
+// SetGroupHosts 设置分组包含的主机，替换原有成员，hosts 为空时删除分组，username 为设置成员的用户
+func SetGroupHosts(db *sql.DB, group string, hosts []string, username string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM host_group_members WHERE group_name = $1`, group); err != nil {
+		return fmt.Errorf("failed to clear group members: %v", err)
+	}
+	for _, host := range hosts {
+		_, err := tx.Exec(`
+		INSERT INTO host_group_members (group_name, host_name, user_name) VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`, group, host, username)
+		if err != nil {
+			return fmt.Errorf("failed to add group member: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ListHostGroups 查询用户的分组及其主机
+func ListHostGroups(db *sql.DB, username string) (map[string][]string, error) {
+	rows, err := db.Query(`
+	SELECT group_name, host_name FROM host_group_members
+	WHERE user_name = $1
+	ORDER BY group_name, host_name`, username)
+	if err != nil {
+		return nil, fmt.Errorf("查询主机分组失败: %v", err)
+	}
+	defer rows.Close()
+
+	groups := map[string][]string{}
+	for rows.Next() {
+		var group, host string
+		if err := rows.Scan(&group, &host); err != nil {
+			return nil, fmt.Errorf("读取主机分组失败: %v", err)
+		}
+		groups[group] = append(groups[group], host)
+	}
+	return groups, rows.Err()
+}
+
+// EffectiveAgentConfig 主机最终生效的下发配置及其 ETag
+// 主机所属分组的配置按优先级从小到大合并，主机自身的配置最后合并；映射按键合并，其余值整体替换
+func EffectiveAgentConfig(db *sql.DB, hostname string) ([]byte, string, error) {
+	rows, err := db.Query(`
+	SELECT c.content FROM agent_configs c
+	JOIN host_group_members m ON c.scope = $2 AND c.name = m.group_name
+	WHERE m.host_name = $1
+	ORDER BY c.priority, c.name`, hostname, ConfigScopeGroup)
+	if err != nil {
+		return nil, "", fmt.Errorf("查询分组配置失败: %v", err)
+	}
+	defer rows.Close()
+
+	var docs []string
+	for rows.Next() {
+		var content string
+		if err := rows.Scan(&content); err != nil {
+			return nil, "", fmt.Errorf("读取分组配置失败: %v", err)
+		}
+		docs = append(docs, content)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("读取分组配置失败: %v", err)
+	}
+
+	host, err := ReadAgentConfig(db, ConfigScopeHost, hostname)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, "", fmt.Errorf("查询主机配置失败: %v", err)
+	}
+	if err == nil {
+		docs = append(docs, host.Content)
+	}
+
+	merged := map[interface{}]interface{}{}
+	for _, doc := range docs {
+		var m map[interface{}]interface{}
+		if err := yaml.Unmarshal([]byte(doc), &m); err != nil {
+			return nil, "", fmt.Errorf("解析配置失败: %v", err)
+		}
+		mergeConfig(merged, m)
+	}
+	var content []byte
+	if len(merged) > 0 {
+		content, err = yaml.Marshal(merged)
+		if err != nil {
+			return nil, "", fmt.Errorf("序列化配置失败: %v", err)
+		}
+	}
+	return content, ConfigETag(content), nil
+}
+
+// ConfigETag 配置内容的 SHA-256 前 16 位，作为配置的版本
+func ConfigETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:8])
+}
+
+// mergeConfig 将 src 合并到 dst，两边都是映射时逐键合并，否则以 src 为准
+func mergeConfig(dst, src map[interface{}]interface{}) {
+	for k, v := range src {
+		sm, sok := v.(map[interface{}]interface{})
+		dm, dok := dst[k].(map[interface{}]interface{})
+		if sok && dok {
+			mergeConfig(dm, sm)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// ConfigStatus 主机应当运行的下发配置与 agent 实际运行的配置
+type ConfigStatus struct {
+	HostName     string     `json:"host_name"`
+	ExpectedETag string     `json:"expected_etag"`
+	RunningETag  string     `json:"running_etag"` // agent 最近一次心跳中报告的下发配置版本
+	ConfigHash   string     `json:"config_hash"`  // 合并后生效配置的 SHA-256
+	InSync       bool       `json:"in_sync"`
+	ReceivedAt   *time.Time `json:"received_at"` // 最近一次心跳的时间，没有心跳时为 null
+}
+
+// ReadConfigStatus 查询用户所有主机的配置状态
+func ReadConfigStatus(db *sql.DB, username string) ([]ConfigStatus, error) {
+	rows, err := db.Query(`
+	SELECT t.host_name, COALESCE(h.config_etag, ''), COALESCE(h.config_hash, ''), h.received_at
+	FROM (SELECT DISTINCT host_name FROM host_info WHERE user_name = $1) t
+	LEFT JOIN agent_health h ON h.host_name = t.host_name`, username)
+	if err != nil {
+		return nil, fmt.Errorf("查询配置状态失败: %v", err)
+	}
+	var statuses []ConfigStatus
+	for rows.Next() {
+		var s ConfigStatus
+		var receivedAt sql.NullTime
+		if err := rows.Scan(&s.HostName, &s.RunningETag, &s.ConfigHash, &receivedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("读取配置状态失败: %v", err)
+		}
+		if receivedAt.Valid {
+			t := receivedAt.Time.UTC()
+			s.ReceivedAt = &t
+		}
+		statuses = append(statuses, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取配置状态失败: %v", err)
+	}
+
+	for i := range statuses {
+		_, etag, err := EffectiveAgentConfig(db, statuses[i].HostName)
+		if err != nil {
+			return nil, err
+		}
+		statuses[i].ExpectedETag = etag
+		statuses[i].InSync = etag == statuses[i].RunningETag
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].HostName < statuses[j].HostName })
+	if statuses == nil {
+		statuses = []ConfigStatus{}
+	}
+	return statuses, nil
+}
@@ -0,0 +1,271 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 远程命令的状态
+const (
+	CommandQueued  = "queued"  // 等待 agent 领取
+	CommandRunning = "running" // agent 已领取
+	CommandDone    = "done"    // 执行结束，结果见 exit_code 与 error
+	CommandExpired = "expired" // 超过 CommandTTL 未被领取
+)
+
+// CommandTTL 命令等待 agent 领取的最长时间，超过后不再执行
+const CommandTTL = 10 * time.Minute
+
+// 命令领取后的执行期限为 agent 报告的超时时间加上 CommandRunMargin，超过后仍未回传结果的命令
+// 视为 agent 异常退出，标记为结束；agent 未报告超时时间（旧版本）时使用 DefaultCommandTimeout
+const (
+	CommandRunMargin      = time.Minute
+	DefaultCommandTimeout = time.Hour
+	MaxCommandTimeout     = 24 * time.Hour
+)
+
+// commandLostError 超过执行期限仍未回传结果的命令的错误信息
+const commandLostError = "agent 未在执行期限内回传结果，可能已异常退出"
+
+// ErrCommandNotRunning 命令不属于该主机或不在执行中，agent 不能再回传输出
+var ErrCommandNotRunning = errors.New("命令不存在或不在执行中")
+
+// AgentCommand 提交给某台主机的一条远程命令，Command 为 agent 允许列表中的命令名称
+type AgentCommand struct {
+	ID         int64      `json:"id"`
+	HostName   string     `json:"host_name"`
+	Command    string     `json:"command"`
+	Args       []string   `json:"args"`
+	Status     string     `json:"status"`
+	ExitCode   *int       `json:"exit_code"` // 执行结束前为 null，未能运行或被信号结束时为 -1
+	Error      string     `json:"error,omitempty"`
+	Truncated  bool       `json:"truncated"` // 输出超过 agent 的上限被截断
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// CommandOutput 命令的一段输出，Seq 由 agent 从 1 开始递增
+type CommandOutput struct {
+	Seq    int    `json:"seq"`
+	Stream string `json:"stream"` // stdout 或 stderr
+	Data   string `json:"data"`
+}
+
+// CommandResult agent 回传的执行结果
+type CommandResult struct {
+	ExitCode  int    `json:"exit_code"`
+	Error     string `json:"error,omitempty"`
+	Truncated bool   `json:"truncated"`
+}
+
+const commandColumns = `id, host_name, command, args, status, exit_code, COALESCE(error, ''), COALESCE(truncated, false),
+	COALESCE(created_by, ''), created_at, started_at, finished_at`
+
+func scanCommand(row interface{ Scan(...interface{}) error }) (AgentCommand, error) {
+	var cmd AgentCommand
+	var argsJSON []byte
+	var exitCode sql.NullInt64
+	var startedAt, finishedAt sql.NullTime
+	err := row.Scan(&cmd.ID, &cmd.HostName, &cmd.Command, &argsJSON, &cmd.Status, &exitCode, &cmd.Error, &cmd.Truncated,
+		&cmd.CreatedBy, &cmd.CreatedAt, &startedAt, &finishedAt)
+	if err != nil {
+		return AgentCommand{}, err
+	}
+	cmd.Args = []string{}
+	if len(argsJSON) > 0 {
+		if err := json.Unmarshal(argsJSON, &cmd.Args); err != nil {
+			return AgentCommand{}, fmt.Errorf("解析 JSON 数据时发生错误: %v", err)
+		}
+	}
+	if exitCode.Valid {
+		n := int(exitCode.Int64)
+		cmd.ExitCode = &n
+	}
+	cmd.CreatedAt = cmd.CreatedAt.UTC()
+	if startedAt.Valid {
+		t := startedAt.Time.UTC()
+		cmd.StartedAt = &t
+	}
+	if finishedAt.Valid {
+		t := finishedAt.Time.UTC()
+		cmd.FinishedAt = &t
+	}
+	return cmd, nil
+}
+
+// HostOwnedBy 主机是否属于该用户
+func HostOwnedBy(db *sql.DB, hostname, username string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM host_info WHERE host_name = $1 AND user_name = $2)`,
+		hostname, username).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("查询主机信息失败: %v", err)
+	}
+	return exists, nil
+}
+
+// InsertCommand 提交一条命令，等待 agent 领取
+func InsertCommand(db *sql.DB, hostname, command string, args []string, createdBy string) (AgentCommand, error) {
+	if args == nil {
+		args = []string{}
+	}
+	argsJSON, err := json.Marshal(args)
+	if err != nil {
+		return AgentCommand{}, fmt.Errorf("failed to marshal command args: %v", err)
+	}
+	now := time.Now().UTC()
+	row := db.QueryRow(`
+	INSERT INTO agent_commands (host_name, command, args, status, created_by, created_at, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING `+commandColumns,
+		hostname, command, argsJSON, CommandQueued, createdBy, now, now.Add(CommandTTL))
+	cmd, err := scanCommand(row)
+	if err != nil {
+		return AgentCommand{}, fmt.Errorf("failed to insert command: %v", err)
+	}
+	return cmd, nil
+}
+
+// ExpireCommands 将超时未领取的命令标记为过期，将超过执行期限仍未回传结果的命令标记为结束，hostname 为空时处理所有主机
+func ExpireCommands(db *sql.DB, hostname string) error {
+	_, err := db.Exec(`
+	UPDATE agent_commands SET status = $2, finished_at = NOW()
+	WHERE ($1 = '' OR host_name = $1) AND status = $3 AND expires_at <= NOW()`, hostname, CommandExpired, CommandQueued)
+	if err != nil {
+		return fmt.Errorf("failed to expire commands: %v", err)
+	}
+	_, err = db.Exec(`
+	UPDATE agent_commands SET status = $2, exit_code = -1, error = $4, finished_at = NOW()
+	WHERE ($1 = '' OR host_name = $1) AND status = $3 AND deadline_at <= NOW()`, hostname, CommandDone, CommandRunning, commandLostError)
+	if err != nil {
+		return fmt.Errorf("failed to expire running commands: %v", err)
+	}
+	return nil
+}
+
+// ClaimCommands 领取主机最多 max 条待执行的命令并标记为执行中，执行期限为 timeout 加上 CommandRunMargin
+// 领取前先处理过期的命令
+func ClaimCommands(db *sql.DB, hostname string, max int, timeout time.Duration) ([]AgentCommand, error) {
+	if err := ExpireCommands(db, hostname); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+	UPDATE agent_commands SET status = $2, started_at = NOW(), deadline_at = $5
+	WHERE id IN (
+		SELECT id FROM agent_commands
+		WHERE host_name = $1 AND status = $3
+		ORDER BY id
+		LIMIT $4
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING `+commandColumns, hostname, CommandRunning, CommandQueued, max, time.Now().UTC().Add(timeout+CommandRunMargin))
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim commands: %v", err)
+	}
+	defer rows.Close()
+
+	cmds := []AgentCommand{}
+	for rows.Next() {
+		cmd, err := scanCommand(rows)
+		if err != nil {
+			return nil, fmt.Errorf("读取命令失败: %v", err)
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds, rows.Err()
+}
+
+// AppendCommandOutput 保存 agent 回传的输出，result 不为 nil 时将命令标记为结束
+// 重复回传的同一段输出（相同的 seq）只保存一次
+func AppendCommandOutput(db *sql.DB, id int64, hostname string, output []CommandOutput, result *CommandResult) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRow(`SELECT status FROM agent_commands WHERE id = $1 AND host_name = $2 FOR UPDATE`, id, hostname).Scan(&status)
+	if err == sql.ErrNoRows || (err == nil && status != CommandRunning) {
+		return ErrCommandNotRunning
+	}
+	if err != nil {
+		return fmt.Errorf("查询命令失败: %v", err)
+	}
+
+	for _, o := range output {
+		_, err := tx.Exec(`
+		INSERT INTO agent_command_output (command_id, seq, stream, data) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (command_id, seq) DO NOTHING`, id, o.Seq, o.Stream, o.Data)
+		if err != nil {
+			return fmt.Errorf("failed to save command output: %v", err)
+		}
+	}
+
+	if result != nil {
+		_, err := tx.Exec(`
+		UPDATE agent_commands SET status = $2, exit_code = $3, error = $4, truncated = $5, finished_at = NOW()
+		WHERE id = $1`, id, CommandDone, result.ExitCode, result.Error, result.Truncated)
+		if err != nil {
+			return fmt.Errorf("failed to save command result: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ReadCommand 查询一条命令，不存在时返回 sql.ErrNoRows
+func ReadCommand(db *sql.DB, id int64) (AgentCommand, error) {
+	return scanCommand(db.QueryRow(`SELECT `+commandColumns+` FROM agent_commands WHERE id = $1`, id))
+}
+
+// ReadCommandOutput 查询命令 seq 大于 after 的输出，按 seq 升序排列
+func ReadCommandOutput(db *sql.DB, id int64, after int) ([]CommandOutput, error) {
+	rows, err := db.Query(`
+	SELECT seq, stream, data FROM agent_command_output
+	WHERE command_id = $1 AND seq > $2
+	ORDER BY seq`, id, after)
+	if err != nil {
+		return nil, fmt.Errorf("查询命令输出失败: %v", err)
+	}
+	defer rows.Close()
+
+	output := []CommandOutput{}
+	for rows.Next() {
+		var o CommandOutput
+		if err := rows.Scan(&o.Seq, &o.Stream, &o.Data); err != nil {
+			return nil, fmt.Errorf("读取命令输出失败: %v", err)
+		}
+		output = append(output, o)
+	}
+	return output, rows.Err()
+}
+
+// ListCommands 查询用户所有主机最近的命令，hostname 不为空时只查询该主机，按提交时间倒序
+func ListCommands(db *sql.DB, username, hostname string, limit int) ([]AgentCommand, error) {
+	rows, err := db.Query(`
+	SELECT `+commandColumns+` FROM agent_commands
+	WHERE host_name IN (SELECT host_name FROM host_info WHERE user_name = $1)
+		AND ($2 = '' OR host_name = $2)
+	ORDER BY id DESC
+	LIMIT $3`, username, hostname, limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询命令失败: %v", err)
+	}
+	defer rows.Close()
+
+	cmds := []AgentCommand{}
+	for rows.Next() {
+		cmd, err := scanCommand(rows)
+		if err != nil {
+			return nil, fmt.Errorf("读取命令失败: %v", err)
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds, rows.Err()
+}
@@ -0,0 +1,86 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// 定义日志事件结构体
+type LogEvent struct {
+	ID         int               `json:"id"`
+	Time       time.Time         `json:"time"`
+	File       string            `json:"file"`
+	Rule       string            `json:"rule"`
+	Severity   string            `json:"severity"`
+	Message    string            `json:"message"`
+	Fields     map[string]string `json:"fields,omitempty"`
+	Suppressed int               `json:"suppressed,omitempty"` // 限流丢弃的同规则匹配数
+}
+
+// EventFilter 日志事件查询条件
+type EventFilter struct {
+	From       time.Time
+	To         time.Time
+	Severities []string // 为空时不过滤
+	Rule       string   // 为空时不过滤
+	Limit      int
+}
+
+// InsertLogEvents 保存日志事件，agent 补发的重复数据只保存一次
+func InsertLogEvents(db *sql.DB, hostname string, events []LogEvent) error {
+	for _, e := range events {
+		fieldsJSON, err := json.Marshal(e.Fields)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event fields: %v", err)
+		}
+		_, err = db.Exec(`
+		INSERT INTO log_events (host_name, event_time, file, rule, severity, message, fields, suppressed)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (host_name, event_time, file, rule, md5(message)) DO NOTHING`,
+			hostname, e.Time.UTC(), e.File, e.Rule, e.Severity, e.Message, fieldsJSON, e.Suppressed)
+		if err != nil {
+			return fmt.Errorf("failed to insert log event: %v", err)
+		}
+	}
+	return nil
+}
+
+// ReadLogEvents 按条件查询主机的日志事件，按时间倒序返回最近的 Limit 条
+func ReadLogEvents(db *sql.DB, hostname string, filter EventFilter) ([]LogEvent, error) {
+	rows, err := db.Query(`
+	SELECT id, event_time, file, rule, severity, message, fields, COALESCE(suppressed, 0)
+	FROM log_events
+	WHERE host_name = $1 AND event_time BETWEEN $2 AND $3
+		AND (cardinality($4::text[]) = 0 OR severity = ANY($4))
+		AND ($5 = '' OR rule = $5)
+	ORDER BY event_time DESC, id DESC
+	LIMIT $6`, hostname, filter.From.UTC(), filter.To.UTC(), pq.Array(filter.Severities), filter.Rule, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询日志事件时发生错误: %v", err)
+	}
+	defer rows.Close()
+
+	events := []LogEvent{}
+	for rows.Next() {
+		var e LogEvent
+		var fieldsJSON []byte
+		if err := rows.Scan(&e.ID, &e.Time, &e.File, &e.Rule, &e.Severity, &e.Message, &fieldsJSON, &e.Suppressed); err != nil {
+			return nil, fmt.Errorf("扫描日志事件时发生错误: %v", err)
+		}
+		if len(fieldsJSON) > 0 {
+			if err := json.Unmarshal(fieldsJSON, &e.Fields); err != nil {
+				return nil, fmt.Errorf("解析 JSON 数据时发生错误: %v", err)
+			}
+		}
+		e.Time = e.Time.UTC()
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("处理日志事件时发生错误: %v", err)
+	}
+	return events, nil
+}
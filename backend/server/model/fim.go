@@ -0,0 +1,167 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// FileState 文件完整性监控记录的文件属性，SHA256 为空表示 agent 没有计算哈希
+type FileState struct {
+	Size       int64     `json:"size"`
+	Mode       string    `json:"mode"`
+	UID        uint32    `json:"uid"`
+	GID        uint32    `json:"gid"`
+	Owner      string    `json:"owner"`
+	Group      string    `json:"group"`
+	SHA256     string    `json:"sha256,omitempty"`
+	Link       string    `json:"link,omitempty"`
+	ModTime    time.Time `json:"mtime"`
+	ChangeTime time.Time `json:"ctime"`
+	Inode      uint64    `json:"inode"`
+}
+
+// FileChange 文件相对基线的变化，作为审计事件保存，确认后记录确认人、时间与备注
+type FileChange struct {
+	ID         int        `json:"id"`
+	HostName   string     `json:"host_name,omitempty"`
+	Path       string     `json:"path"`
+	Change     string     `json:"change"` // added、removed 或 modified
+	Fields     []string   `json:"fields,omitempty"`
+	Before     *FileState `json:"before,omitempty"`
+	After      *FileState `json:"after,omitempty"`
+	DetectedAt time.Time  `json:"detected_at"`
+	AckedAt    *time.Time `json:"acked_at,omitempty"`
+	AckedBy    string     `json:"acked_by,omitempty"`
+	AckNote    string     `json:"ack_note,omitempty"`
+}
+
+// FileChangeFilter 文件变化查询条件
+type FileChangeFilter struct {
+	From   time.Time
+	To     time.Time
+	Status string // unacked、acked 或 all
+	Path   string // 路径前缀，为空时不过滤
+	Limit  int
+}
+
+// InsertFileChanges 保存文件变化，agent 补发的重复数据只保存一次
+func InsertFileChanges(db *sql.DB, hostname string, changes []FileChange) error {
+	for _, ch := range changes {
+		fieldsJSON, err := json.Marshal(ch.Fields)
+		if err != nil {
+			return fmt.Errorf("failed to marshal change fields: %v", err)
+		}
+		beforeJSON, err := json.Marshal(ch.Before)
+		if err != nil {
+			return fmt.Errorf("failed to marshal file state: %v", err)
+		}
+		afterJSON, err := json.Marshal(ch.After)
+		if err != nil {
+			return fmt.Errorf("failed to marshal file state: %v", err)
+		}
+		_, err = db.Exec(`
+		INSERT INTO fim_events (host_name, path, change, fields, before_state, after_state, detected_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (host_name, path, change, detected_at) DO NOTHING`,
+			hostname, ch.Path, ch.Change, fieldsJSON, beforeJSON, afterJSON, ch.DetectedAt.UTC())
+		if err != nil {
+			return fmt.Errorf("failed to insert file change: %v", err)
+		}
+	}
+	return nil
+}
+
+const fileChangeColumns = `id, host_name, path, change, fields, before_state, after_state, detected_at,
+	acked_at, COALESCE(acked_by, ''), COALESCE(ack_note, '')`
+
+// fileChangeWhere 按 FileChangeFilter 过滤的条件，参数从 $2 开始
+const fileChangeWhere = `detected_at BETWEEN $2 AND $3
+		AND ($4 = 'all' OR ($4 = 'acked') = (acked_at IS NOT NULL))
+		AND ($5 = '' OR left(path, length($5)) = $5)`
+
+// ReadFileChanges 按条件查询主机的文件变化，按发现时间倒序返回最近的 Limit 条
+func ReadFileChanges(db *sql.DB, hostname string, filter FileChangeFilter) ([]FileChange, error) {
+	rows, err := db.Query(`
+	SELECT `+fileChangeColumns+`
+	FROM fim_events
+	WHERE host_name = $1 AND `+fileChangeWhere+`
+	ORDER BY detected_at DESC, id DESC
+	LIMIT $6`, hostname, filter.From.UTC(), filter.To.UTC(), filter.Status, filter.Path, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询文件变化时发生错误: %v", err)
+	}
+	return scanFileChanges(rows)
+}
+
+// ListFileChanges 按条件查询用户所有主机的文件变化，按发现时间倒序返回最近的 Limit 条
+func ListFileChanges(db *sql.DB, username string, filter FileChangeFilter) ([]FileChange, error) {
+	rows, err := db.Query(`
+	SELECT `+fileChangeColumns+`
+	FROM fim_events
+	WHERE host_name IN (SELECT host_name FROM host_info WHERE user_name = $1) AND `+fileChangeWhere+`
+	ORDER BY detected_at DESC, id DESC
+	LIMIT $6`, username, filter.From.UTC(), filter.To.UTC(), filter.Status, filter.Path, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询文件变化时发生错误: %v", err)
+	}
+	return scanFileChanges(rows)
+}
+
+func scanFileChanges(rows *sql.Rows) ([]FileChange, error) {
+	defer rows.Close()
+	changes := []FileChange{}
+	for rows.Next() {
+		var ch FileChange
+		var fieldsJSON, beforeJSON, afterJSON []byte
+		var ackedAt sql.NullTime
+		if err := rows.Scan(&ch.ID, &ch.HostName, &ch.Path, &ch.Change, &fieldsJSON, &beforeJSON, &afterJSON,
+			&ch.DetectedAt, &ackedAt, &ch.AckedBy, &ch.AckNote); err != nil {
+			return nil, fmt.Errorf("扫描文件变化时发生错误: %v", err)
+		}
+		for _, v := range []struct {
+			raw  []byte
+			dest interface{}
+		}{{fieldsJSON, &ch.Fields}, {beforeJSON, &ch.Before}, {afterJSON, &ch.After}} {
+			if len(v.raw) == 0 {
+				continue
+			}
+			if err := json.Unmarshal(v.raw, v.dest); err != nil {
+				return nil, fmt.Errorf("解析 JSON 数据时发生错误: %v", err)
+			}
+		}
+		ch.DetectedAt = ch.DetectedAt.UTC()
+		if ackedAt.Valid {
+			t := ackedAt.Time.UTC()
+			ch.AckedAt = &t
+		}
+		changes = append(changes, ch)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("处理文件变化时发生错误: %v", err)
+	}
+	return changes, nil
+}
+
+// AckFileChanges 确认用户主机的文件变化，ids 为空时确认 hostname 的所有未确认变化
+// 已确认的变化与其他用户主机的变化不会被修改，返回确认的条数
+func AckFileChanges(db *sql.DB, username string, ids []int64, hostname, note string) (int64, error) {
+	res, err := db.Exec(`
+	UPDATE fim_events SET acked_at = $1, acked_by = $2, ack_note = $3
+	WHERE acked_at IS NULL
+		AND host_name IN (SELECT host_name FROM host_info WHERE user_name = $2)
+		AND (cardinality($4::int[]) = 0 OR id = ANY($4))
+		AND ($5 = '' OR host_name = $5)`,
+		time.Now().UTC(), username, note, pq.Array(ids), hostname)
+	if err != nil {
+		return 0, fmt.Errorf("确认文件变化时发生错误: %v", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("确认文件变化时发生错误: %v", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,172 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// HostListen 某台主机最新一次上报中匹配的监听端口
+type HostListen struct {
+	HostName string       `json:"host_name"`
+	Time     string       `json:"time"`
+	Listen   []ListenPort `json:"listen"`
+}
+
+// ListenChange 某台主机在两个时间点之间监听端口的变化
+type ListenChange struct {
+	HostName string       `json:"host_name"`
+	FromTime string       `json:"from_time"`
+	ToTime   string       `json:"to_time"`
+	Added    []ListenPort `json:"added"`
+	Removed  []ListenPort `json:"removed"`
+	Changed  []ListenPort `json:"changed"` // 端口仍在监听，但监听进程的命令行发生了变化
+}
+
+// readUserConnData 读取用户所有主机的连接信息历史，按主机名分组并按时间升序排列
+func readUserConnData(db *sql.DB, username string) (map[string][]ConnData, error) {
+	rows, err := db.Query(`
+	SELECT s.host_name, s.conn_info
+	FROM system_info s
+	JOIN host_info h ON h.host_name = s.host_name
+	WHERE h.user_name = $1 AND s.conn_info IS NOT NULL`, username)
+	if err != nil {
+		return nil, fmt.Errorf("查询连接信息时发生错误: %v", err)
+	}
+	defer rows.Close()
+
+	connByHost := make(map[string][]ConnData)
+	for rows.Next() {
+		var hostname string
+		var connJSON []byte
+		if err := rows.Scan(&hostname, &connJSON); err != nil {
+			return nil, fmt.Errorf("扫描连接信息记录时发生错误: %v", err)
+		}
+		var connData []ConnData
+		if err := json.Unmarshal(connJSON, &connData); err != nil {
+			return nil, fmt.Errorf("解析 JSON 数据时发生错误: %v", err)
+		}
+		connByHost[hostname] = append(connByHost[hostname], connData...)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("处理连接信息记录时发生错误: %v", err)
+	}
+
+	// RFC3339 的 UTC 时间字符串可直接按字典序比较
+	for hostname := range connByHost {
+		data := connByHost[hostname]
+		sort.SliceStable(data, func(i, j int) bool { return data[i].Time < data[j].Time })
+	}
+	return connByHost, nil
+}
+
+// FindListeningHosts 查询用户的哪些主机在最新一次上报中监听了指定端口
+func FindListeningHosts(db *sql.DB, username string, port uint32) ([]HostListen, error) {
+	connByHost, err := readUserConnData(db, username)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := []HostListen{}
+	for hostname, data := range connByHost {
+		if len(data) == 0 {
+			continue
+		}
+		latest := data[len(data)-1]
+
+		var matched []ListenPort
+		for _, l := range latest.Data.Listen {
+			if l.Port == port {
+				matched = append(matched, l)
+			}
+		}
+		if len(matched) > 0 {
+			hosts = append(hosts, HostListen{HostName: hostname, Time: latest.Time, Listen: matched})
+		}
+	}
+
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].HostName < hosts[j].HostName })
+	return hosts, nil
+}
+
+// ListListenChanges 对比每台主机在 since 时刻与最新一次上报的监听端口
+// since 之前没有数据的主机以 since 之后的第一次上报作为基准
+func ListListenChanges(db *sql.DB, username string, since time.Time) ([]ListenChange, error) {
+	connByHost, err := readUserConnData(db, username)
+	if err != nil {
+		return nil, err
+	}
+	sinceStr := since.UTC().Format(time.RFC3339)
+
+	changes := []ListenChange{}
+	for hostname, data := range connByHost {
+		if len(data) < 2 {
+			continue
+		}
+
+		base := data[0]
+		for _, d := range data {
+			if d.Time > sinceStr {
+				break
+			}
+			base = d
+		}
+		latest := data[len(data)-1]
+		if base.Time == latest.Time {
+			continue
+		}
+
+		change := diffListen(base.Data.Listen, latest.Data.Listen)
+		if len(change.Added) == 0 && len(change.Removed) == 0 && len(change.Changed) == 0 {
+			continue
+		}
+		change.HostName = hostname
+		change.FromTime = base.Time
+		change.ToTime = latest.Time
+		changes = append(changes, change)
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].HostName < changes[j].HostName })
+	return changes, nil
+}
+
+// diffListen 以协议、地址、端口为标识对比两组监听端口
+func diffListen(before, after []ListenPort) ListenChange {
+	key := func(l ListenPort) string {
+		return fmt.Sprintf("%s|%s|%d", l.Proto, l.IP, l.Port)
+	}
+
+	beforeMap := make(map[string]ListenPort, len(before))
+	for _, l := range before {
+		beforeMap[key(l)] = l
+	}
+	afterMap := make(map[string]ListenPort, len(after))
+	for _, l := range after {
+		afterMap[key(l)] = l
+	}
+
+	var change ListenChange
+	for k, l := range afterMap {
+		old, ok := beforeMap[k]
+		if !ok {
+			change.Added = append(change.Added, l)
+		} else if old.Cmdline != l.Cmdline {
+			change.Changed = append(change.Changed, l)
+		}
+	}
+	for k, l := range beforeMap {
+		if _, ok := afterMap[k]; !ok {
+			change.Removed = append(change.Removed, l)
+		}
+	}
+
+	byPort := func(ls []ListenPort) {
+		sort.Slice(ls, func(i, j int) bool { return key(ls[i]) < key(ls[j]) })
+	}
+	byPort(change.Added)
+	byPort(change.Removed)
+	byPort(change.Changed)
+	return change
+}
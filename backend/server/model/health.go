@@ -0,0 +1,100 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// 定义 agent 心跳结构体
+type Heartbeat struct {
+	HostName      string             `json:"host_name"`
+	Version       string             `json:"version"`
+	OS            string             `json:"os,omitempty"` // 用于选择升级文件，不保存
+	Arch          string             `json:"arch,omitempty"`
+	StartedAt     time.Time          `json:"started_at"`
+	Uptime        int64              `json:"uptime"`
+	ConfigHash    string             `json:"config_hash"`
+	ConfigETag    string             `json:"config_etag"` // agent 正在运行的下发配置版本，未使用下发配置时为空
+	Collectors    map[string]float64 `json:"collectors"`
+	SendFailures  uint64             `json:"send_failures"`
+	LastSendError string             `json:"last_send_error,omitempty"`
+	SpoolDepth    int                `json:"spool_depth"`
+	SpoolBytes    int64              `json:"spool_bytes"`
+	SentAt        time.Time          `json:"sent_at"`
+}
+
+// AgentHealth 主机最近一次心跳中 agent 的运行状态
+type AgentHealth struct {
+	Heartbeat
+	ReceivedAt time.Time `json:"received_at"`
+	ClockSkew  float64   `json:"clock_skew"` // agent 时钟相对服务器的偏差（秒），正数表示 agent 较快
+}
+
+// UpdateAgentHealth 保存心跳中的 agent 运行状态，并将主机标记为在线
+func UpdateAgentHealth(db *sql.DB, hb Heartbeat) error {
+	collectorsJSON, err := json.Marshal(hb.Collectors)
+	if err != nil {
+		return fmt.Errorf("failed to marshal collector durations: %v", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	INSERT INTO agent_health (host_name, version, started_at, uptime, config_hash, config_etag, collectors,
+		send_failures, last_send_error, spool_depth, spool_bytes, sent_at, received_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	ON CONFLICT (host_name) DO UPDATE SET
+		version = EXCLUDED.version, started_at = EXCLUDED.started_at, uptime = EXCLUDED.uptime,
+		config_hash = EXCLUDED.config_hash, config_etag = EXCLUDED.config_etag, collectors = EXCLUDED.collectors,
+		send_failures = EXCLUDED.send_failures, last_send_error = EXCLUDED.last_send_error,
+		spool_depth = EXCLUDED.spool_depth, spool_bytes = EXCLUDED.spool_bytes,
+		sent_at = EXCLUDED.sent_at, received_at = EXCLUDED.received_at`,
+		hb.HostName, hb.Version, hb.StartedAt.UTC(), hb.Uptime, hb.ConfigHash, hb.ConfigETag, collectorsJSON,
+		int64(hb.SendFailures), hb.LastSendError, hb.SpoolDepth, hb.SpoolBytes, hb.SentAt.UTC(), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to save agent health: %v", err)
+	}
+
+	_, err = tx.Exec(`
+	UPDATE hostandtoken
+	SET last_heartbeat = NOW(), status = 'online'
+	WHERE host_name = $1`, hb.HostName)
+	if err != nil {
+		return fmt.Errorf("failed to update heartbeat and status: %v", err)
+	}
+	return tx.Commit()
+}
+
+// ReadAgentHealth 查询主机最近一次心跳中的 agent 运行状态，没有心跳记录时返回 sql.ErrNoRows
+func ReadAgentHealth(db *sql.DB, hostname string) (AgentHealth, error) {
+	var h AgentHealth
+	var collectorsJSON []byte
+	var sendFailures int64
+	err := db.QueryRow(`
+	SELECT host_name, COALESCE(version, ''), started_at, COALESCE(uptime, 0), COALESCE(config_hash, ''), COALESCE(config_etag, ''), collectors,
+		COALESCE(send_failures, 0), COALESCE(last_send_error, ''), COALESCE(spool_depth, 0), COALESCE(spool_bytes, 0),
+		sent_at, received_at
+	FROM agent_health
+	WHERE host_name = $1`, hostname).Scan(&h.HostName, &h.Version, &h.StartedAt, &h.Uptime, &h.ConfigHash, &h.ConfigETag, &collectorsJSON,
+		&sendFailures, &h.LastSendError, &h.SpoolDepth, &h.SpoolBytes, &h.SentAt, &h.ReceivedAt)
+	if err != nil {
+		return AgentHealth{}, err
+	}
+	if len(collectorsJSON) > 0 {
+		if err := json.Unmarshal(collectorsJSON, &h.Collectors); err != nil {
+			return AgentHealth{}, fmt.Errorf("解析 JSON 数据时发生错误: %v", err)
+		}
+	}
+	h.SendFailures = uint64(sendFailures)
+	h.StartedAt = h.StartedAt.UTC()
+	h.SentAt = h.SentAt.UTC()
+	h.ReceivedAt = h.ReceivedAt.UTC()
+	h.ClockSkew = h.SentAt.Sub(h.ReceivedAt).Seconds()
+	return h, nil
+}
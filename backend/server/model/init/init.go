@@ -50,9 +50,17 @@ CREATE TABLE IF NOT EXISTS host_info (
 	os TEXT NOT NULL,
 	platform TEXT NOT NULL,
 	kernel_arch TEXT NOT NULL,
+	boot_time BIGINT, -- 启动时间(Unix 秒)
+	virtualization_system TEXT,
+	virtualization_role TEXT,
 	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP -- TIMESTAMP WITH TIME ZONE 加上时区
 );
 
+-- 已存在的 host_info 表补充新增的列
+ALTER TABLE host_info ADD COLUMN IF NOT EXISTS boot_time BIGINT;
+ALTER TABLE host_info ADD COLUMN IF NOT EXISTS virtualization_system TEXT;
+ALTER TABLE host_info ADD COLUMN IF NOT EXISTS virtualization_role TEXT;
+
 -- system_info表
 CREATE TABLE IF NOT EXISTS system_info (
 	id SERIAL PRIMARY KEY,
@@ -64,9 +72,25 @@ CREATE TABLE IF NOT EXISTS system_info (
 	memory_info JSONB,
 	process_info JSONB,
 	network_info JSONB,
+	disk_info JSONB,
+	diskio_info JSONB,
+	load_info JSONB,
+	conn_info JSONB,
+	checks JSONB,
+	watchlist JSONB,
+	collector_errors JSONB,
 	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- 已存在的 system_info 表补充新增的列
+ALTER TABLE system_info ADD COLUMN IF NOT EXISTS disk_info JSONB;
+ALTER TABLE system_info ADD COLUMN IF NOT EXISTS diskio_info JSONB;
+ALTER TABLE system_info ADD COLUMN IF NOT EXISTS load_info JSONB;
+ALTER TABLE system_info ADD COLUMN IF NOT EXISTS conn_info JSONB;
+ALTER TABLE system_info ADD COLUMN IF NOT EXISTS checks JSONB;
+ALTER TABLE system_info ADD COLUMN IF NOT EXISTS watchlist JSONB;
+ALTER TABLE system_info ADD COLUMN IF NOT EXISTS collector_errors JSONB;
+
 -- token表
 CREATE TABLE IF NOT EXISTS hostandtoken (
 	id SERIAL PRIMARY KEY,
@@ -77,6 +101,238 @@ CREATE TABLE IF NOT EXISTS hostandtoken (
 	status VARCHAR(10) DEFAULT 'offline'
 );
 
+-- 安装 agent 的用户，agent 上报数据时据此确定主机所属的用户
+ALTER TABLE hostandtoken ADD COLUMN IF NOT EXISTS user_name VARCHAR(255);
+
+-- agent_health表，agent 心跳中的自身运行状态，每台主机只保留最新一条
+CREATE TABLE IF NOT EXISTS agent_health (
+	host_name VARCHAR(255) PRIMARY KEY,
+	version VARCHAR(64),
+	started_at TIMESTAMP,
+	uptime BIGINT,
+	config_hash VARCHAR(64),
+	config_etag VARCHAR(64),
+	collectors JSONB,
+	send_failures BIGINT DEFAULT 0,
+	last_send_error TEXT,
+	spool_depth INT DEFAULT 0,
+	spool_bytes BIGINT DEFAULT 0,
+	sent_at TIMESTAMP,
+	received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+ALTER TABLE agent_health ADD COLUMN IF NOT EXISTS config_etag VARCHAR(64);
+
+-- agent_releases表，agent 升级文件，每个版本的每个平台一行
+CREATE TABLE IF NOT EXISTS agent_releases (
+	id SERIAL PRIMARY KEY,
+	version VARCHAR(64) NOT NULL,
+	os VARCHAR(32) NOT NULL,
+	arch VARCHAR(32) NOT NULL,
+	sha256 VARCHAR(64) NOT NULL,
+	signature TEXT NOT NULL,
+	size BIGINT,
+	path TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (version, os, arch)
+);
+
+-- agent_target_versions表，期望 agent 运行的版本，host_name 为 * 时对所有主机生效
+CREATE TABLE IF NOT EXISTS agent_target_versions (
+	host_name VARCHAR(255) PRIMARY KEY,
+	version VARCHAR(64) NOT NULL,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- agent_nonces表，agent 签名请求中使用过的 nonce，用于拒绝重放的请求；服务器重启后仍然有效，超过有效期的定期清理
+CREATE TABLE IF NOT EXISTS agent_nonces (
+	host_name VARCHAR(255),
+	nonce VARCHAR(64),
+	used_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (host_name, nonce)
+);
+
+CREATE INDEX IF NOT EXISTS idx_agent_nonces_used_at ON agent_nonces(used_at);
+
+-- host_group_members表，主机分组，用于按分组下发 agent 配置
+CREATE TABLE IF NOT EXISTS host_group_members (
+	group_name VARCHAR(255) NOT NULL,
+	host_name VARCHAR(255) NOT NULL,
+	PRIMARY KEY (group_name, host_name)
+);
+
+-- 设置分组成员的用户，分组只能由该用户修改
+ALTER TABLE host_group_members ADD COLUMN IF NOT EXISTS user_name VARCHAR(255);
+
+-- agent_configs表，下发给 agent 的配置（YAML），scope 为 host 或 group，name 为主机名或分组名
+CREATE TABLE IF NOT EXISTS agent_configs (
+	scope VARCHAR(16) NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	content TEXT NOT NULL,
+	priority INT DEFAULT 0,
+	version INT NOT NULL DEFAULT 1,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (scope, name)
+);
+
+-- 保存配置的用户，分组配置只能由该用户修改
+ALTER TABLE agent_configs ADD COLUMN IF NOT EXISTS user_name VARCHAR(255);
+
+-- agent_commands表，提交给 agent 执行的远程命令，command 为 agent 允许列表中的命令名称
+CREATE TABLE IF NOT EXISTS agent_commands (
+	id SERIAL PRIMARY KEY,
+	host_name VARCHAR(255) NOT NULL,
+	command VARCHAR(255) NOT NULL,
+	args JSONB,
+	status VARCHAR(16) NOT NULL,
+	exit_code INT,
+	error TEXT,
+	truncated BOOLEAN DEFAULT FALSE,
+	created_by VARCHAR(255),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	started_at TIMESTAMP,
+	deadline_at TIMESTAMP,
+	finished_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_agent_commands_host_status ON agent_commands (host_name, status);
+
+-- 已存在的 agent_commands 表补充执行期限，超过后仍在执行中的命令视为 agent 异常退出
+ALTER TABLE agent_commands ADD COLUMN IF NOT EXISTS deadline_at TIMESTAMP;
+
+-- agent_command_output表，命令的输出，agent 分段回传，seq 从 1 开始递增
+CREATE TABLE IF NOT EXISTS agent_command_output (
+	command_id INT NOT NULL,
+	seq INT NOT NULL,
+	stream VARCHAR(16) NOT NULL,
+	data TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (command_id, seq)
+);
+
+-- probe_results表，agent 拨测结果，每个拨测的每次执行一行
+CREATE TABLE IF NOT EXISTS probe_results (
+	id SERIAL PRIMARY KEY,
+	host_name VARCHAR(255),
+	probe_name VARCHAR(255),
+	probe_type VARCHAR(10),
+	target TEXT,
+	success BOOLEAN,
+	error TEXT,
+	duration_ms DOUBLE PRECISION,
+	status_code INT,
+	dns_ms DOUBLE PRECISION,
+	connect_ms DOUBLE PRECISION,
+	tls_ms DOUBLE PRECISION,
+	ttfb_ms DOUBLE PRECISION,
+	answers JSONB,
+	checked_at TIMESTAMP,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- agent 每次上报都携带各拨测的最新结果，同一次执行只保存一行
+CREATE UNIQUE INDEX IF NOT EXISTS idx_probe_results_host_probe_time ON probe_results(host_name, probe_name, checked_at);
+
+-- log_events表，agent 日志监控匹配到的事件
+CREATE TABLE IF NOT EXISTS log_events (
+	id SERIAL PRIMARY KEY,
+	host_name VARCHAR(255),
+	event_time TIMESTAMP,
+	file TEXT,
+	rule VARCHAR(255),
+	severity VARCHAR(10),
+	message TEXT,
+	fields JSONB,
+	suppressed INT DEFAULT 0,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_log_events_host_time ON log_events(host_name, event_time);
+
+-- agent 补发的上报可能包含已保存的事件，同一事件只保存一行；建索引前先清理已有的重复行
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = 'idx_log_events_dedup') THEN
+		DELETE FROM log_events a USING log_events b
+		WHERE a.id > b.id AND a.host_name = b.host_name AND a.event_time = b.event_time
+			AND a.file = b.file AND a.rule = b.rule AND md5(a.message) = md5(b.message);
+		CREATE UNIQUE INDEX idx_log_events_dedup ON log_events(host_name, event_time, file, rule, md5(message));
+	END IF;
+END $$;
+
+-- process_states表，被监视进程的状态变化历史：up、down 与 restart（PID 被替换）
+CREATE TABLE IF NOT EXISTS process_states (
+	id SERIAL PRIMARY KEY,
+	host_name VARCHAR(255),
+	watch_name VARCHAR(255),
+	event VARCHAR(10),
+	state VARCHAR(10),
+	instances INT,
+	pids JSONB,
+	restarts INT DEFAULT 0,
+	changed_at TIMESTAMP,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_process_states_host_watch ON process_states(host_name, watch_name, changed_at);
+
+-- 同一次采样的状态变化只保存一行，补发的上报不重复记录重启；建索引前先清理已有的重复行
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = 'idx_process_states_dedup') THEN
+		DELETE FROM process_states a USING process_states b
+		WHERE a.id > b.id AND a.host_name = b.host_name AND a.watch_name = b.watch_name
+			AND a.event = b.event AND a.changed_at = b.changed_at;
+		CREATE UNIQUE INDEX idx_process_states_dedup ON process_states(host_name, watch_name, event, changed_at);
+	END IF;
+END $$;
+
+-- fim_events表，agent 文件完整性监控发现的文件变化，作为审计事件保存，确认后记录确认人与备注
+CREATE TABLE IF NOT EXISTS fim_events (
+	id SERIAL PRIMARY KEY,
+	host_name VARCHAR(255),
+	path TEXT,
+	change VARCHAR(10),
+	fields JSONB,
+	before_state JSONB,
+	after_state JSONB,
+	detected_at TIMESTAMP,
+	acked_at TIMESTAMP,
+	acked_by VARCHAR(255),
+	ack_note TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- agent 补发缓存数据时同一变化只保存一行
+CREATE UNIQUE INDEX IF NOT EXISTS idx_fim_events_host_path_time ON fim_events(host_name, path, change, detected_at);
+CREATE INDEX IF NOT EXISTS idx_fim_events_unacked ON fim_events(host_name, detected_at) WHERE acked_at IS NULL;
+
+-- login_events表，agent 从 sshd 认证日志解析的登录事件，同一来源、用户与认证方式的失败在一次上报内合并，count 为次数
+CREATE TABLE IF NOT EXISTS login_events (
+	id SERIAL PRIMARY KEY,
+	host_name VARCHAR(255),
+	event_time TIMESTAMP,
+	result VARCHAR(10),
+	login_user VARCHAR(255),
+	source_ip VARCHAR(64),
+	port INT,
+	method VARCHAR(64),
+	invalid_user BOOLEAN DEFAULT FALSE,
+	count INT DEFAULT 1,
+	message TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- agent 补发缓存数据时同一事件只保存一行
+CREATE UNIQUE INDEX IF NOT EXISTS idx_login_events_dedup ON login_events(host_name, event_time, result, login_user, source_ip, port, method);
+CREATE INDEX IF NOT EXISTS idx_login_events_failure_time ON login_events(event_time, source_ip) WHERE result = 'failure';
+
+-- login_sessions表，每台主机最近一次上报的登录会话
+CREATE TABLE IF NOT EXISTS login_sessions (
+	host_name VARCHAR(255) PRIMARY KEY,
+	sessions JSONB,
+	reported_at TIMESTAMP
+);
+
 -- 在system_info表的host_info_id字段上创建索引，加速通过主机ID查找系统信息
 -- CREATE INDEX IF NOT EXISTS idx_system_info_host_info_id ON system_info(host_info_id);
 -- CREATE INDEX IF NOT EXISTS idx_system_info_host_info_id ON system_info(host_info_id);
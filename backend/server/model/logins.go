@@ -0,0 +1,185 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// 定义登录会话结构体
+type LoginSession struct {
+	User     string    `json:"user"`
+	Terminal string    `json:"terminal"`
+	Host     string    `json:"host"` // 登录来源
+	Started  time.Time `json:"started"`
+}
+
+// HostSessions 主机最近一次上报的登录会话
+type HostSessions struct {
+	HostName   string         `json:"host_name"`
+	ReportedAt time.Time      `json:"reported_at"`
+	Sessions   []LoginSession `json:"sessions"`
+}
+
+// 定义登录事件结构体，同一来源、用户与认证方式的失败在一次上报内合并为一条，Count 为次数
+type LoginEvent struct {
+	ID          int       `json:"id"`
+	HostName    string    `json:"host_name,omitempty"`
+	Time        time.Time `json:"time"`
+	Result      string    `json:"result"` // success 或 failure
+	User        string    `json:"user"`
+	SourceIP    string    `json:"source_ip"`
+	Port        int       `json:"port"`
+	Method      string    `json:"method"`
+	InvalidUser bool      `json:"invalid_user,omitempty"`
+	Count       int       `json:"count"`
+	Message     string    `json:"message"`
+}
+
+// LoginFilter 登录事件查询条件
+type LoginFilter struct {
+	From     time.Time
+	To       time.Time
+	Result   string // 为空时不过滤
+	User     string // 为空时不过滤
+	SourceIP string // 为空时不过滤
+	Limit    int
+}
+
+// FailedLoginSource 一个来源 IP 在用户所有主机上的登录失败汇总
+type FailedLoginSource struct {
+	SourceIP  string    `json:"source_ip"`
+	Failures  int       `json:"failures"`
+	Successes int       `json:"successes"` // 同一时间范围内该来源登录成功的次数
+	Hosts     []string  `json:"hosts"`     // 登录失败的主机
+	Users     int       `json:"users"`     // 尝试的不同用户名数
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// SaveLoginSessions 保存主机当前的登录会话，只保留最新一次上报；补发的较早数据不覆盖较新的数据
+func SaveLoginSessions(db *sql.DB, hostname string, sessions []LoginSession, collectedAt time.Time) error {
+	sessionsJSON, err := json.Marshal(sessions)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sessions: %v", err)
+	}
+	_, err = db.Exec(`
+	INSERT INTO login_sessions (host_name, sessions, reported_at)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (host_name) DO UPDATE SET sessions = EXCLUDED.sessions, reported_at = EXCLUDED.reported_at
+	WHERE login_sessions.reported_at <= EXCLUDED.reported_at`,
+		hostname, sessionsJSON, SampleTime(collectedAt))
+	if err != nil {
+		return fmt.Errorf("failed to save sessions: %v", err)
+	}
+	return nil
+}
+
+// ReadLoginSessions 查询主机最近一次上报的登录会话，没有记录时返回 sql.ErrNoRows
+func ReadLoginSessions(db *sql.DB, hostname string) (HostSessions, error) {
+	hs := HostSessions{HostName: hostname}
+	var sessionsJSON []byte
+	err := db.QueryRow(`
+	SELECT sessions, reported_at FROM login_sessions WHERE host_name = $1`, hostname).Scan(&sessionsJSON, &hs.ReportedAt)
+	if err == sql.ErrNoRows {
+		return hs, err
+	}
+	if err != nil {
+		return hs, fmt.Errorf("查询登录会话时发生错误: %v", err)
+	}
+	if err := json.Unmarshal(sessionsJSON, &hs.Sessions); err != nil {
+		return hs, fmt.Errorf("解析 JSON 数据时发生错误: %v", err)
+	}
+	hs.ReportedAt = hs.ReportedAt.UTC()
+	return hs, nil
+}
+
+// InsertLoginEvents 保存登录事件，agent 补发的重复数据只保存一次
+func InsertLoginEvents(db *sql.DB, hostname string, events []LoginEvent) error {
+	for _, e := range events {
+		count := e.Count
+		if count <= 0 {
+			count = 1
+		}
+		_, err := db.Exec(`
+		INSERT INTO login_events (host_name, event_time, result, login_user, source_ip, port, method, invalid_user, count, message)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (host_name, event_time, result, login_user, source_ip, port, method) DO NOTHING`,
+			hostname, e.Time.UTC(), e.Result, e.User, e.SourceIP, e.Port, e.Method, e.InvalidUser, count, e.Message)
+		if err != nil {
+			return fmt.Errorf("failed to insert login event: %v", err)
+		}
+	}
+	return nil
+}
+
+// ReadLoginEvents 按条件查询主机的登录事件，按时间倒序返回最近的 Limit 条
+func ReadLoginEvents(db *sql.DB, hostname string, filter LoginFilter) ([]LoginEvent, error) {
+	rows, err := db.Query(`
+	SELECT id, event_time, result, login_user, source_ip, port, method, invalid_user, count, COALESCE(message, '')
+	FROM login_events
+	WHERE host_name = $1 AND event_time BETWEEN $2 AND $3
+		AND ($4 = '' OR result = $4)
+		AND ($5 = '' OR login_user = $5)
+		AND ($6 = '' OR source_ip = $6)
+	ORDER BY event_time DESC, id DESC
+	LIMIT $7`, hostname, filter.From.UTC(), filter.To.UTC(), filter.Result, filter.User, filter.SourceIP, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询登录事件时发生错误: %v", err)
+	}
+	defer rows.Close()
+
+	events := []LoginEvent{}
+	for rows.Next() {
+		var e LoginEvent
+		if err := rows.Scan(&e.ID, &e.Time, &e.Result, &e.User, &e.SourceIP, &e.Port, &e.Method, &e.InvalidUser, &e.Count, &e.Message); err != nil {
+			return nil, fmt.Errorf("扫描登录事件时发生错误: %v", err)
+		}
+		e.Time = e.Time.UTC()
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("处理登录事件时发生错误: %v", err)
+	}
+	return events, nil
+}
+
+// CountFailedLogins 统计用户所有主机自 since 以来按来源 IP 汇总的登录失败，失败次数不少于 minFailures 的来源按失败次数降序返回
+func CountFailedLogins(db *sql.DB, username string, since time.Time, minFailures, limit int) ([]FailedLoginSource, error) {
+	rows, err := db.Query(`
+	SELECT source_ip,
+		SUM(count) FILTER (WHERE result = 'failure'),
+		COALESCE(SUM(count) FILTER (WHERE result = 'success'), 0),
+		array_agg(DISTINCT host_name) FILTER (WHERE result = 'failure'),
+		COUNT(DISTINCT login_user) FILTER (WHERE result = 'failure'),
+		MIN(event_time) FILTER (WHERE result = 'failure'),
+		MAX(event_time) FILTER (WHERE result = 'failure')
+	FROM login_events
+	WHERE host_name IN (SELECT host_name FROM host_info WHERE user_name = $1) AND event_time >= $2
+	GROUP BY source_ip
+	HAVING SUM(count) FILTER (WHERE result = 'failure') >= $3
+	ORDER BY 2 DESC, source_ip
+	LIMIT $4`, username, since.UTC(), minFailures, limit)
+	if err != nil {
+		return nil, fmt.Errorf("统计登录失败时发生错误: %v", err)
+	}
+	defer rows.Close()
+
+	sources := []FailedLoginSource{}
+	for rows.Next() {
+		var s FailedLoginSource
+		if err := rows.Scan(&s.SourceIP, &s.Failures, &s.Successes, pq.Array(&s.Hosts), &s.Users, &s.FirstSeen, &s.LastSeen); err != nil {
+			return nil, fmt.Errorf("扫描登录失败统计时发生错误: %v", err)
+		}
+		s.FirstSeen = s.FirstSeen.UTC()
+		s.LastSeen = s.LastSeen.UTC()
+		sources = append(sources, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("处理登录失败统计时发生错误: %v", err)
+	}
+	return sources, nil
+}
@@ -34,11 +34,14 @@ func InitDB() (db *sql.DB, err error) { //
 }
 
 type RequestData struct {
-	CPUInfo  []CPUInfo     `json:"cpu_info"`
-	HostInfo HostInfo      `json:"host_info"`
-	MemInfo  MemoryInfo    `json:"mem_info"`
-	ProInfo  []ProcessInfo `json:"pro_info"`
-	NetInfo  NetworkInfo   `json:"net_info"`
+	CPUInfo    []CPUInfo      `json:"cpu_info"`
+	HostInfo   HostInfo       `json:"host_info"`
+	MemInfo    MemoryInfo     `json:"mem_info"`
+	ProInfo    ProcessSummary `json:"pro_info"`
+	NetInfo    []NetworkInfo  `json:"net_info"`
+	DiskInfo   []DiskInfo     `json:"disk_info"`
+	DiskIOInfo []DiskIOInfo   `json:"diskio_info"`
+	ConnInfo   ConnInfo       `json:"conn_info"`
 }
 
 type Claims struct {
@@ -47,32 +50,72 @@ type Claims struct {
 }
 
 type HostInfo struct {
-	ID         int       `json:"id"` // 添加 ID 字段
-	Hostname   string    `json:"host_name"`
-	OS         string    `json:"os"`
-	Platform   string    `json:"platform"`
-	KernelArch string    `json:"kernel_arch"`
-	CreatedAt  time.Time `json:"host_info_created_at"` // 添加 CreatedAt 字段
-	Token      string    `json:"token"`
+	ID                   int       `json:"id"` // 添加 ID 字段
+	Hostname             string    `json:"host_name"`
+	OS                   string    `json:"os"`
+	Platform             string    `json:"platform"`
+	KernelArch           string    `json:"kernel_arch"`
+	Uptime               uint64    `json:"uptime"`    // 运行时长(秒)
+	BootTime             uint64    `json:"boot_time"` // 启动时间(Unix 秒)
+	Procs                uint64    `json:"procs"`
+	VirtualizationSystem string    `json:"virtualization_system"`
+	VirtualizationRole   string    `json:"virtualization_role"`
+	Load1                float64   `json:"load1"`
+	Load5                float64   `json:"load5"`
+	Load15               float64   `json:"load15"`
+	CreatedAt            time.Time `json:"host_info_created_at"` // 添加 CreatedAt 字段
+	Token                string    `json:"token"`
 }
 
+// CPUInfo 每个逻辑 CPU 一条记录，Percent 为整机使用率
 type CPUInfo struct {
-	ID        int     `json:"id"` // 添加 ID 字段
-	ModelName string  `json:"model_name"`
-	CoresNum  int     `json:"cores_num"`
-	Percent   float64 `json:"percent"`
+	ID          int     `json:"id"` // 添加 ID 字段
+	CPU         int     `json:"cpu"`
+	ModelName   string  `json:"model_name"`
+	CoresNum    int     `json:"cores_num"`
+	Percent     float64 `json:"percent"`
+	CorePercent float64 `json:"core_percent"`
+	User        float64 `json:"user"`
+	System      float64 `json:"system"`
+	Idle        float64 `json:"idle"`
+	Nice        float64 `json:"nice"`
+	Iowait      float64 `json:"iowait"`
+	Irq         float64 `json:"irq"`
+	Softirq     float64 `json:"softirq"`
+	Steal       float64 `json:"steal"`
 	// CreatedAt time.Time `json:"cpu_info_created_at"` // 添加 CreatedAt 字段
 }
 
 type ProcessInfo struct {
 	ID         int     `json:"id"` // 添加 ID 字段
 	PID        int     `json:"pid"`
+	Name       string  `json:"name"`
+	Username   string  `json:"username"`
 	CPUPercent float64 `json:"cpu_percent"`
 	MemPercent float64 `json:"mem_percent"`
+	RSS        uint64  `json:"rss"`
 	Cmdline    string  `json:"cmdline"`
 	// CreatedAt  time.Time `json:"pro_info_created_at"` // 添加 CreatedAt 字段
 }
 
+// 按可执行文件名或用户汇总的进程信息
+type ProcessGroup struct {
+	Name       string  `json:"name"`
+	Count      int     `json:"count"`
+	CPUPercent float64 `json:"cpu_percent"`
+	MemPercent float64 `json:"mem_percent"`
+	RSS        uint64  `json:"rss"`
+}
+
+// 进程概况，TopCPU、TopMem 为占用最高的进程，ByName、ByUser 为所有进程的汇总
+type ProcessSummary struct {
+	Total  int            `json:"total"`
+	TopCPU []ProcessInfo  `json:"top_cpu"`
+	TopMem []ProcessInfo  `json:"top_mem"`
+	ByName []ProcessGroup `json:"by_name"`
+	ByUser []ProcessGroup `json:"by_user"`
+}
+
 type MemoryInfo struct {
 	ID          int     `json:"id"` // 添加 ID 字段
 	Total       string  `json:"total"`
@@ -80,18 +123,121 @@ type MemoryInfo struct {
 	Used        string  `json:"used"`
 	Free        string  `json:"free"`
 	UserPercent float64 `json:"user_percent"`
+	SwapTotal   string  `json:"swap_total"`
+	SwapUsed    string  `json:"swap_used"`
+	SwapPercent float64 `json:"swap_percent"`
 	// CreatedAt   time.Time `json:"mem_info_created_at"` // 添加 CreatedAt 字段
 }
 
 // 定义网络信息结构体
 type NetworkInfo struct {
-	ID        int    `json:"id"`
-	Name      string `json:"name"`
-	BytesRecv uint64 `json:"bytes_recv"` // 接收字节数
-	BytesSent uint64 `json:"bytes_sent"` // 发送字节数
+	ID                int     `json:"id"`
+	Name              string  `json:"name"`
+	BytesRecv         uint64  `json:"bytes_recv"` // 接收字节数
+	BytesSent         uint64  `json:"bytes_sent"` // 发送字节数
+	PacketsRecv       uint64  `json:"packets_recv"`
+	PacketsSent       uint64  `json:"packets_sent"`
+	Errin             uint64  `json:"errin"`
+	Errout            uint64  `json:"errout"`
+	Dropin            uint64  `json:"dropin"`
+	Dropout           uint64  `json:"dropout"`
+	BytesRecvPerSec   float64 `json:"bytes_recv_per_sec"`
+	BytesSentPerSec   float64 `json:"bytes_sent_per_sec"`
+	PacketsRecvPerSec float64 `json:"packets_recv_per_sec"`
+	PacketsSentPerSec float64 `json:"packets_sent_per_sec"`
+	ErrinDelta        uint64  `json:"errin_delta"`
+	ErroutDelta       uint64  `json:"errout_delta"`
+	DropinDelta       uint64  `json:"dropin_delta"`
+	DropoutDelta      uint64  `json:"dropout_delta"`
 	// CreatedAt time.Time `json:"net_info_created_at"`
 }
 
+// 定义磁盘分区信息结构体
+type DiskInfo struct {
+	ID          int     `json:"id"`
+	Device      string  `json:"device"`
+	Mountpoint  string  `json:"mountpoint"`
+	Fstype      string  `json:"fstype"`
+	Total       uint64  `json:"total"` // 总字节数
+	Used        uint64  `json:"used"`  // 已用字节数
+	Free        uint64  `json:"free"`  // 空闲字节数
+	UsedPercent float64 `json:"used_percent"`
+	InodesTotal uint64  `json:"inodes_total"`
+	InodesUsed  uint64  `json:"inodes_used"`
+	// CreatedAt time.Time `json:"disk_info_created_at"`
+}
+
+// 定义块设备 I/O 信息结构体
+type DiskIOInfo struct {
+	ID               int     `json:"id"`
+	Name             string  `json:"name"`
+	ReadBytes        uint64  `json:"read_bytes"`
+	WriteBytes       uint64  `json:"write_bytes"`
+	ReadCount        uint64  `json:"read_count"`
+	WriteCount       uint64  `json:"write_count"`
+	IoTime           uint64  `json:"io_time"`
+	WeightedIO       uint64  `json:"weighted_io"`
+	ReadBytesPerSec  float64 `json:"read_bytes_per_sec"`
+	WriteBytesPerSec float64 `json:"write_bytes_per_sec"`
+	ReadOpsPerSec    float64 `json:"read_ops_per_sec"`
+	WriteOpsPerSec   float64 `json:"write_ops_per_sec"`
+	AwaitMs          float64 `json:"await_ms"`
+	QueueDepth       float64 `json:"queue_depth"`
+	Util             float64 `json:"util"`
+	// CreatedAt time.Time `json:"diskio_info_created_at"`
+}
+
+// 定义监听端口结构体
+type ListenPort struct {
+	Proto   string `json:"proto"`
+	IP      string `json:"ip"`
+	Port    uint32 `json:"port"`
+	PID     int32  `json:"pid"`
+	Cmdline string `json:"cmdline"`
+}
+
+// 定义连接状态信息结构体
+type ConnInfo struct {
+	ID     int            `json:"id"`
+	States map[string]int `json:"states"`
+	Listen []ListenPort   `json:"listen"`
+	// CreatedAt time.Time `json:"conn_info_created_at"`
+}
+
+// 定义检查脚本的性能数据结构体
+type CheckPerf struct {
+	Label string  `json:"label"`
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit,omitempty"`
+	Warn  string  `json:"warn,omitempty"`
+	Crit  string  `json:"crit,omitempty"`
+	Min   string  `json:"min,omitempty"`
+	Max   string  `json:"max,omitempty"`
+}
+
+// 定义检查脚本结果结构体，Status 为 Nagios 退出码
+type CheckResult struct {
+	Name       string      `json:"name"`
+	Status     int         `json:"status"`
+	State      string      `json:"state"`
+	Output     string      `json:"output"`
+	LongOutput string      `json:"long_output,omitempty"`
+	Perfdata   []CheckPerf `json:"perfdata,omitempty"`
+	Truncated  bool        `json:"truncated,omitempty"`
+	DurationMs float64     `json:"duration_ms"`
+	CheckedAt  int64       `json:"checked_at"`
+}
+
+// 定义系统负载信息结构体，从上报的主机信息中提取，按时间点保存
+type LoadInfo struct {
+	Load1    float64 `json:"load1"`
+	Load5    float64 `json:"load5"`
+	Load15   float64 `json:"load15"`
+	Uptime   uint64  `json:"uptime"`
+	BootTime uint64  `json:"boot_time"`
+	Procs    uint64  `json:"procs"`
+}
+
 type CPUData struct {
 	Time string    `json:"time"`
 	Data []CPUInfo `json:"data"`
@@ -103,13 +249,44 @@ type MemoryData struct {
 }
 
 type ProcessData struct {
-	Time string      `json:"time"`
-	Data ProcessInfo `json:"data"`
+	Time string         `json:"time"`
+	Data ProcessSummary `json:"data"`
 }
 
 type NetworkData struct {
-	Time string      `json:"time"`
-	Data NetworkInfo `json:"data"`
+	Time string        `json:"time"`
+	Data []NetworkInfo `json:"data"`
+}
+
+type DiskData struct {
+	Time string     `json:"time"`
+	Data []DiskInfo `json:"data"`
+}
+
+type LoadData struct {
+	Time string   `json:"time"`
+	Data LoadInfo `json:"data"`
+}
+
+type ConnData struct {
+	Time string   `json:"time"`
+	Data ConnInfo `json:"data"`
+}
+
+type CheckData struct {
+	Time string        `json:"time"`
+	Data []CheckResult `json:"data"`
+}
+
+// 采集器错误，key 为采集器名称
+type CollectorErrorData struct {
+	Time string            `json:"time"`
+	Data map[string]string `json:"data"`
+}
+
+type DiskIOData struct {
+	Time string       `json:"time"`
+	Data []DiskIOInfo `json:"data"`
 }
 
 func InsertHostInfo(hostInfo HostInfo, username string) error {
@@ -135,9 +312,9 @@ func InsertHostInfo(hostInfo HostInfo, username string) error {
 		// 更新已存在的主机记录
 		updateSQL := `
         UPDATE host_info
-        SET created_at = CURRENT_TIMESTAMP
+        SET created_at = CURRENT_TIMESTAMP, boot_time = $2, virtualization_system = $3, virtualization_role = $4
         WHERE id = $1`
-		_, err = DB.Exec(updateSQL, hostInfoID)
+		_, err = DB.Exec(updateSQL, hostInfoID, hostInfo.BootTime, hostInfo.VirtualizationSystem, hostInfo.VirtualizationRole)
 		if err != nil {
 			fmt.Printf("Failed to update host_info_created_at: %v\n", err)
 			return err
@@ -146,10 +323,11 @@ func InsertHostInfo(hostInfo HostInfo, username string) error {
 	} else {
 		// 插入新的主机记录
 		insertSQL := `
-        INSERT INTO host_info (host_name, os, platform, kernel_arch, created_at, user_name)
-        VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP, $5)
+        INSERT INTO host_info (host_name, os, platform, kernel_arch, created_at, user_name, boot_time, virtualization_system, virtualization_role)
+        VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP, $5, $6, $7, $8)
         RETURNING id, host_name`
-		err = DB.QueryRow(insertSQL, hostInfo.Hostname, hostInfo.OS, hostInfo.Platform, hostInfo.KernelArch, username).Scan(&hostInfoID, &hostname)
+		err = DB.QueryRow(insertSQL, hostInfo.Hostname, hostInfo.OS, hostInfo.Platform, hostInfo.KernelArch, username,
+			hostInfo.BootTime, hostInfo.VirtualizationSystem, hostInfo.VirtualizationRole).Scan(&hostInfoID, &hostname)
 		if err != nil {
 			fmt.Printf("Failed to insert host_info: %v\n", err)
 			return err
@@ -160,7 +338,7 @@ func InsertHostInfo(hostInfo HostInfo, username string) error {
 	return nil
 }
 
-func InsertSystemInfo(db *sql.DB, hostname string, cpuInfo []CPUInfo, memoryInfo MemoryInfo, processInfo ProcessInfo, networkInfo NetworkInfo) error {
+func InsertSystemInfo(db *sql.DB, hostname string, cpuInfo []CPUInfo, memoryInfo MemoryInfo, networkInfo []NetworkInfo, collectedAt time.Time) error {
 	// 检查是否已经存在对应的 system_info 记录
 	var existingID int
 	var hostInfoID int
@@ -191,13 +369,8 @@ func InsertSystemInfo(db *sql.DB, hostname string, cpuInfo []CPUInfo, memoryInfo
 	}
 	fmt.Println("InsertSystemInfo : existingID 为", existingID)
 
-	if existingID > 0 {
-		fmt.Println("InsertSystemInfo : The hostId already exists!")
-		//UpdateSystemInfo(db, hostInfoID, cpuInfo, memoryInfo, processInfo, networkInfo)
-		return nil
-	}
-	// 获取当前时间并格式化
-	currentTime := time.Now().UTC().Format(time.RFC3339)
+	// 获取采集时间并格式化
+	currentTime := SampleTime(collectedAt)
 
 	// 创建新的数据实例
 	cpuData := CPUData{
@@ -208,15 +381,31 @@ func InsertSystemInfo(db *sql.DB, hostname string, cpuInfo []CPUInfo, memoryInfo
 		Time: currentTime,
 		Data: memoryInfo,
 	}
-	processData := ProcessData{
-		Time: currentTime,
-		Data: processInfo,
-	}
 	networkData := NetworkData{
 		Time: currentTime,
 		Data: networkInfo,
 	}
 
+	if existingID > 0 {
+		// 主机已有 system_info 记录时，将本次的数据追加到对应的列，未采集的数据不追加
+		if len(cpuInfo) > 0 {
+			if err := appendSystemInfo(db, hostname, "cpu_info", cpuData); err != nil {
+				return err
+			}
+		}
+		if memoryInfo.Total != "" {
+			if err := appendSystemInfo(db, hostname, "memory_info", memoryData); err != nil {
+				return err
+			}
+		}
+		if len(networkInfo) > 0 {
+			if err := appendSystemInfo(db, hostname, "network_info", networkData); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
 	// 处理 CPU 信息
 	var cpuInfoArray []CPUData
 	if existingID > 0 {
@@ -245,18 +434,8 @@ func InsertSystemInfo(db *sql.DB, hostname string, cpuInfo []CPUInfo, memoryInfo
 		return fmt.Errorf("failed to marshal updated memory_info: %v", err)
 	}
 
-	// 处理 Process 信息
-	var processInfoArray []ProcessData
-	if existingID > 0 {
-		if err := json.Unmarshal(processInfoJSON, &processInfoArray); err != nil {
-			return fmt.Errorf("failed to unmarshal existing process_info: %v", err)
-		}
-	}
-	processInfoArray = append(processInfoArray, processData)
-	processInfoData, err := json.Marshal(processInfoArray)
-	if err != nil {
-		return fmt.Errorf("failed to marshal updated process_info: %v", err)
-	}
+	// 进程信息由 InsertProcessInfo 逐次追加，新记录中为空数组
+	processInfoData := []byte("[]")
 
 	// 处理 Network 信息
 	var networkInfoArray []NetworkData
@@ -302,7 +481,143 @@ func InsertSystemInfo(db *sql.DB, hostname string, cpuInfo []CPUInfo, memoryInfo
 	return nil
 }
 
-func InsertHostandToken(db *sql.DB, hostname string, Token string) error {
+// SampleTime 返回数据的时间，agent 补发的缓存数据使用采集时间
+// 未携带采集时间或采集时间晚于当前时间（agent 时钟不准）时使用服务器当前时间
+func SampleTime(collectedAt time.Time) string {
+	now := time.Now().UTC()
+	if collectedAt.IsZero() || collectedAt.After(now.Add(time.Minute)) {
+		return now.Format(time.RFC3339)
+	}
+	return collectedAt.UTC().Format(time.RFC3339)
+}
+
+// appendSystemInfo 将一个时间点的数据追加到主机最新 system_info 记录的指定 JSONB 列中
+// 列中已有同一时间点的数据时不再追加，agent 补发的上报不会产生重复数据
+func appendSystemInfo(db *sql.DB, hostname string, column string, entry interface{}) error {
+	entryJSON, err := json.Marshal([]interface{}{entry})
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %v", column, err)
+	}
+
+	// column 只由本包内部传入，不来自请求参数
+	updateSQL := fmt.Sprintf(`
+	UPDATE system_info
+	SET %[1]s = COALESCE(%[1]s, '[]'::jsonb) || $1::jsonb
+	WHERE id = (SELECT id FROM system_info WHERE host_name = $2 ORDER BY created_at DESC LIMIT 1)
+		AND NOT COALESCE(%[1]s, '[]'::jsonb) @> jsonb_build_array(jsonb_build_object('time', $1::jsonb->0->'time'))`, column)
+
+	res, err := db.Exec(updateSQL, entryJSON, hostname)
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %v", column, err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+
+	// 没有更新时区分记录不存在与数据已保存
+	var exists bool
+	err = db.QueryRow(`SELECT EXISTS (SELECT 1 FROM system_info WHERE host_name = $1)`, hostname).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to query system_info: %v", err)
+	}
+	if !exists {
+		return fmt.Errorf("no system_info record found for host %s", hostname)
+	}
+	return nil
+}
+
+// InsertProcessInfo 追加进程概况
+func InsertProcessInfo(db *sql.DB, hostname string, processInfo ProcessSummary, collectedAt time.Time) error {
+	if processInfo.Total == 0 {
+		return nil
+	}
+	processData := ProcessData{
+		Time: SampleTime(collectedAt),
+		Data: processInfo,
+	}
+	return appendSystemInfo(db, hostname, "process_info", processData)
+}
+
+// InsertDiskInfo 追加磁盘分区信息
+func InsertDiskInfo(db *sql.DB, hostname string, diskInfo []DiskInfo, collectedAt time.Time) error {
+	if len(diskInfo) == 0 {
+		return nil
+	}
+	diskData := DiskData{
+		Time: SampleTime(collectedAt),
+		Data: diskInfo,
+	}
+	return appendSystemInfo(db, hostname, "disk_info", diskData)
+}
+
+// InsertLoadInfo 追加系统负载、运行时长与启动时间
+func InsertLoadInfo(db *sql.DB, hostname string, hostInfo HostInfo, collectedAt time.Time) error {
+	if hostInfo.BootTime == 0 {
+		return nil
+	}
+	loadData := LoadData{
+		Time: SampleTime(collectedAt),
+		Data: LoadInfo{
+			Load1:    hostInfo.Load1,
+			Load5:    hostInfo.Load5,
+			Load15:   hostInfo.Load15,
+			Uptime:   hostInfo.Uptime,
+			BootTime: hostInfo.BootTime,
+			Procs:    hostInfo.Procs,
+		},
+	}
+	return appendSystemInfo(db, hostname, "load_info", loadData)
+}
+
+// InsertConnInfo 追加连接状态与监听端口信息
+func InsertConnInfo(db *sql.DB, hostname string, connInfo ConnInfo, collectedAt time.Time) error {
+	if connInfo.States == nil && connInfo.Listen == nil {
+		return nil
+	}
+	connData := ConnData{
+		Time: SampleTime(collectedAt),
+		Data: connInfo,
+	}
+	return appendSystemInfo(db, hostname, "conn_info", connData)
+}
+
+// InsertCheckResults 追加检查脚本结果
+func InsertCheckResults(db *sql.DB, hostname string, checkResults []CheckResult, collectedAt time.Time) error {
+	if len(checkResults) == 0 {
+		return nil
+	}
+	checkData := CheckData{
+		Time: SampleTime(collectedAt),
+		Data: checkResults,
+	}
+	return appendSystemInfo(db, hostname, "checks", checkData)
+}
+
+// InsertCollectorErrors 追加 agent 上报的采集器错误，出错的采集器本次没有数据
+func InsertCollectorErrors(db *sql.DB, hostname string, collectorErrors map[string]string, collectedAt time.Time) error {
+	if len(collectorErrors) == 0 {
+		return nil
+	}
+	errorData := CollectorErrorData{
+		Time: SampleTime(collectedAt),
+		Data: collectorErrors,
+	}
+	return appendSystemInfo(db, hostname, "collector_errors", errorData)
+}
+
+// InsertDiskIOInfo 追加磁盘IO信息
+func InsertDiskIOInfo(db *sql.DB, hostname string, diskIOInfo []DiskIOInfo, collectedAt time.Time) error {
+	if len(diskIOInfo) == 0 {
+		return nil
+	}
+	diskIOData := DiskIOData{
+		Time: SampleTime(collectedAt),
+		Data: diskIOInfo,
+	}
+	return appendSystemInfo(db, hostname, "diskio_info", diskIOData)
+}
+
+func InsertHostandToken(db *sql.DB, hostname string, Token string, username string) error {
 	var existingID int
 	// 查询是否存在
 	querySQL := `
@@ -333,10 +648,10 @@ func InsertHostandToken(db *sql.DB, hostname string, Token string) error {
 	// 插入新的记录
 	fmt.Println("Inserting new host")
 	insertSQL := `
-	INSERT INTO hostandtoken (host_name, token)
-	VALUES ($1, $2) RETURNING token`
+	INSERT INTO hostandtoken (host_name, token, user_name)
+	VALUES ($1, $2, $3) RETURNING token`
 	var token string
-	err = db.QueryRow(insertSQL, hostname, Token).Scan(&token)
+	err = db.QueryRow(insertSQL, hostname, Token, username).Scan(&token)
 	if err != nil {
 		log.Fatalf("Failed to query host info: %v\n", err)
 		return err
@@ -346,6 +661,21 @@ func InsertHostandToken(db *sql.DB, hostname string, Token string) error {
 	return nil
 }
 
+// HostOwner 查询主机所属的用户：优先使用 host_info 中记录的用户，主机还没有上报过数据时使用安装 agent 的用户
+// 两者都没有时返回空字符串
+func HostOwner(db *sql.DB, hostname string) (string, error) {
+	var owner string
+	err := db.QueryRow(`
+	SELECT COALESCE(
+		(SELECT user_name FROM host_info WHERE host_name = $1 AND user_name <> '' ORDER BY id LIMIT 1),
+		(SELECT user_name FROM hostandtoken WHERE host_name = $1 AND user_name <> '' ORDER BY id LIMIT 1),
+		'')`, hostname).Scan(&owner)
+	if err != nil {
+		return "", fmt.Errorf("查询主机所属用户失败: %v", err)
+	}
+	return owner, nil
+}
+
 func ReadMemoryInfo(hostname string, from, to string, result map[string]interface{}) error {
 	// 查询 JSON 数据
 	rows, err := DB.Query(`SELECT id, memory_info FROM system_info WHERE host_name = $1`, hostname)
@@ -544,6 +874,72 @@ func ReadNetInfo(hostname string, from, to string, result map[string]interface{}
 
 	return nil
 }
+
+// FilterNetInterface 只保留 result["net"] 中指定网卡的数据
+// 兼容旧数据中 data 为单个网卡对象的格式
+func FilterNetInterface(result map[string]interface{}, iface string) {
+	netData, ok := result["net"].([]map[string]interface{})
+	if !ok {
+		return
+	}
+
+	var filtered []map[string]interface{}
+	for _, netInfo := range netData {
+		var matched []interface{}
+		switch data := netInfo["data"].(type) {
+		case []interface{}:
+			for _, item := range data {
+				if m, ok := item.(map[string]interface{}); ok && m["name"] == iface {
+					matched = append(matched, m)
+				}
+			}
+		case map[string]interface{}:
+			if data["name"] == iface {
+				matched = append(matched, data)
+			}
+		}
+		if len(matched) > 0 {
+			filtered = append(filtered, map[string]interface{}{
+				"time": netInfo["time"],
+				"data": matched,
+			})
+		}
+	}
+	result["net"] = filtered
+}
+
+// ProcessViews 进程概况中可单独查询的部分
+var ProcessViews = []string{"top_cpu", "top_mem", "by_name", "by_user"}
+
+// FilterProcessView 只保留 result["process"] 中进程概况的指定部分
+// 旧数据中 data 为单个进程对象，不包含这些部分，会被跳过
+func FilterProcessView(result map[string]interface{}, view string) {
+	processData, ok := result["process"].([]map[string]interface{})
+	if !ok {
+		return
+	}
+
+	var filtered []map[string]interface{}
+	for _, processInfo := range processData {
+		data, ok := processInfo["data"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		part, ok := data[view]
+		if !ok {
+			continue
+		}
+		filtered = append(filtered, map[string]interface{}{
+			"time": processInfo["time"],
+			"data": map[string]interface{}{
+				"total": data["total"],
+				view:    part,
+			},
+		})
+	}
+	result["process"] = filtered
+}
+
 func ReadProcessInfo(hostname string, from, to string, result map[string]interface{}) error {
 	// 查询 JSON 数据
 	rows, err := DB.Query(`SELECT id, process_info FROM system_info WHERE host_name = $1`, hostname)
@@ -610,17 +1006,130 @@ func ReadProcessInfo(hostname string, from, to string, result map[string]interfa
 	return nil
 }
 
+// readTimeSeries 读取 system_info 中某个 JSONB 列，并按 time 字段过滤出 [from, to) 区间内的数据
+func readTimeSeries(hostname, column, from, to string) ([]map[string]interface{}, error) {
+	fromtime, err := time.Parse(time.RFC3339, from)
+	if err != nil {
+		return nil, fmt.Errorf("解析 from 字段时发生错误: %v", err)
+	}
+	totime, err := time.Parse(time.RFC3339, to)
+	if err != nil {
+		return nil, fmt.Errorf("解析 to 字段时发生错误: %v", err)
+	}
+
+	rows, err := DB.Query(fmt.Sprintf(`SELECT id, %s FROM system_info WHERE host_name = $1`, column), hostname)
+	if err != nil {
+		return nil, fmt.Errorf("查询%s时发生错误: %v", column, err)
+	}
+	defer rows.Close()
+
+	var data []map[string]interface{}
+	for rows.Next() {
+		var id int
+		var infoJSON []byte
+		if err := rows.Scan(&id, &infoJSON); err != nil {
+			return nil, fmt.Errorf("扫描%s记录时发生错误: %v", column, err)
+		}
+		// 旧记录中新增的列为 NULL
+		if len(infoJSON) == 0 {
+			continue
+		}
+
+		var infos []map[string]interface{}
+		if err := json.Unmarshal(infoJSON, &infos); err != nil {
+			return nil, fmt.Errorf("解析 JSON 数据时发生错误: %v", err)
+		}
+
+		for _, info := range infos {
+			updatedAtStr, ok := info["time"].(string)
+			if !ok {
+				continue
+			}
+			updatedAt, err := time.Parse(time.RFC3339, updatedAtStr)
+			if err != nil {
+				return nil, fmt.Errorf("解析 updated_at 字段时发生错误: %v", err)
+			}
+			// 判断记录是否在指定时间段内
+			if !updatedAt.Before(fromtime) && updatedAt.Before(totime) {
+				data = append(data, info)
+			}
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("处理%s记录时发生错误: %v", column, err)
+	}
+	return data, nil
+}
+
+func ReadDiskInfo(hostname string, from, to string, result map[string]interface{}) error {
+	diskData, err := readTimeSeries(hostname, "disk_info", from, to)
+	if err != nil {
+		return err
+	}
+	result["disk"] = diskData
+	return nil
+}
+
+func ReadLoadInfo(hostname string, from, to string, result map[string]interface{}) error {
+	loadData, err := readTimeSeries(hostname, "load_info", from, to)
+	if err != nil {
+		return err
+	}
+	result["load"] = loadData
+	return nil
+}
+
+func ReadConnInfo(hostname string, from, to string, result map[string]interface{}) error {
+	connData, err := readTimeSeries(hostname, "conn_info", from, to)
+	if err != nil {
+		return err
+	}
+	result["conn"] = connData
+	return nil
+}
+
+func ReadCheckResults(hostname string, from, to string, result map[string]interface{}) error {
+	checkData, err := readTimeSeries(hostname, "checks", from, to)
+	if err != nil {
+		return err
+	}
+	result["checks"] = checkData
+	return nil
+}
+
+func ReadCollectorErrors(hostname string, from, to string, result map[string]interface{}) error {
+	errorData, err := readTimeSeries(hostname, "collector_errors", from, to)
+	if err != nil {
+		return err
+	}
+	result["errors"] = errorData
+	return nil
+}
+
+func ReadDiskIOInfo(hostname string, from, to string, result map[string]interface{}) error {
+	diskIOData, err := readTimeSeries(hostname, "diskio_info", from, to)
+	if err != nil {
+		return err
+	}
+	result["diskio"] = diskIOData
+	return nil
+}
 
 func ReadDB(db *sql.DB, queryType, from, to string, hostname string) (map[string]interface{}, error) {
 	result := make(map[string]interface{})
 
 	// 查询主机信息
 	if queryType == "host" || queryType == "all" {
-		row := db.QueryRow("SELECT id, host_name, os, platform, kernel_arch, created_at FROM host_info WHERE host_name = $1", hostname)
+		row := db.QueryRow(`SELECT id, host_name, os, platform, kernel_arch, created_at,
+			COALESCE(boot_time, 0), COALESCE(virtualization_system, ''), COALESCE(virtualization_role, '')
+			FROM host_info WHERE host_name = $1`, hostname)
 		var id int
 		var os, platform, kernelArch string
 		var createdAt time.Time
-		err := row.Scan(&id, &hostname, &os, &platform, &kernelArch, &createdAt)
+		var bootTime int64
+		var virtSystem, virtRole string
+		err := row.Scan(&id, &hostname, &os, &platform, &kernelArch, &createdAt, &bootTime, &virtSystem, &virtRole)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				return nil, fmt.Errorf("未找到指定的主机记录")
@@ -628,12 +1137,23 @@ func ReadDB(db *sql.DB, queryType, from, to string, hostname string) (map[string
 			return nil, fmt.Errorf("查询主机信息时发生错误: %v", err)
 		}
 		result["host"] = map[string]interface{}{
-			"id":                   id,
-			"host_name":            hostname,
-			"os":                   os,
-			"platform":             platform,
-			"kernel_arch":          kernelArch,
-			"host_info_created_at": createdAt,
+			"id":                    id,
+			"host_name":             hostname,
+			"os":                    os,
+			"platform":              platform,
+			"kernel_arch":           kernelArch,
+			"host_info_created_at":  createdAt,
+			"boot_time":             bootTime,
+			"virtualization_system": virtSystem,
+			"virtualization_role":   virtRole,
+		}
+	}
+
+	// 查询负载信息
+	if queryType == "load" || queryType == "all" {
+		err := ReadLoadInfo(hostname, from, to, result)
+		if err != nil {
+			return nil, err
 		}
 	}
 
@@ -667,6 +1187,54 @@ func ReadDB(db *sql.DB, queryType, from, to string, hostname string) (map[string
 		}
 	}
 
+	// 查询磁盘信息
+	if queryType == "disk" || queryType == "all" {
+		err := ReadDiskInfo(hostname, from, to, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 查询磁盘IO信息
+	if queryType == "diskio" || queryType == "all" {
+		err := ReadDiskIOInfo(hostname, from, to, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 查询连接状态与监听端口
+	if queryType == "conn" || queryType == "all" {
+		err := ReadConnInfo(hostname, from, to, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 查询检查脚本结果
+	if queryType == "checks" || queryType == "all" {
+		err := ReadCheckResults(hostname, from, to, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 查询被监视进程状态
+	if queryType == "watchlist" || queryType == "all" {
+		err := ReadWatchStatuses(hostname, from, to, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 查询采集器错误
+	if queryType == "errors" || queryType == "all" {
+		err := ReadCollectorErrors(hostname, from, to, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return result, nil
 }
 
@@ -719,7 +1287,7 @@ func UpdateHostInfo(db *sql.DB, host_id int, host_info map[string]string) error
 	//查看该主机的host_id是否存在
 	err := db.QueryRow("SELECT id FROM host_info WHERE host_id = ", host_id).Scan(&host_id)
 	if err != nil {
-		return fmt.Errorf("failed to query host_info table: %v")
+		return fmt.Errorf("failed to query host_info table: %v", err)
 	}
 	if err == sql.ErrNoRows {
 		return fmt.Errorf("no matching host_id found in host_info table")
@@ -736,7 +1304,7 @@ func UpdateHostInfo(db *sql.DB, host_id int, host_info map[string]string) error
 }
 
 // 更新系统信息
-func UpdateSystemInfo(hostInfoID int, cpuInfo []CPUInfo, memoryInfo MemoryInfo, processInfo ProcessInfo, networkInfo NetworkInfo) error {
+func UpdateSystemInfo(hostInfoID int, cpuInfo []CPUInfo, memoryInfo MemoryInfo, processInfo ProcessSummary, networkInfo []NetworkInfo) error {
 	// 查询system_info表中的host_id是否存在
 	var existingID int
 	err := DB.QueryRow("SELECT id FROM system_info WHERE host_info_id = $1", hostInfoID).Scan(&existingID)
@@ -838,7 +1406,7 @@ func UpdateSystemInfo(hostInfoID int, cpuInfo []CPUInfo, memoryInfo MemoryInfo,
 	}
 
 	// 处理 Process 信息
-	if processInfo != (ProcessInfo{}) {
+	if processInfo.Total > 0 {
 		var processInfoArray []ProcessData
 		if existingData["process_info"] != nil {
 			if err := json.Unmarshal(existingData["process_info"], &processInfoArray); err != nil {
@@ -859,7 +1427,7 @@ func UpdateSystemInfo(hostInfoID int, cpuInfo []CPUInfo, memoryInfo MemoryInfo,
 	}
 
 	// 处理 Network 信息
-	if networkInfo != (NetworkInfo{}) {
+	if len(networkInfo) > 0 {
 		var networkInfoArray []NetworkData
 		if existingData["network_info"] != nil {
 			if err := json.Unmarshal(existingData["network_info"], &networkInfoArray); err != nil {
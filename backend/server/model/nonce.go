@@ -0,0 +1,31 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// UseAgentNonce 记录主机签名请求中的 nonce，已经使用过时返回 false
+func UseAgentNonce(db *sql.DB, hostname, nonce string, now time.Time) (bool, error) {
+	res, err := db.Exec(`
+	INSERT INTO agent_nonces (host_name, nonce, used_at)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (host_name, nonce) DO NOTHING`, hostname, nonce, now.UTC())
+	if err != nil {
+		return false, fmt.Errorf("failed to insert agent nonce: %v", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to insert agent nonce: %v", err)
+	}
+	return n == 1, nil
+}
+
+// PurgeAgentNonces 删除 before 之前使用的 nonce，这些请求的时间戳已经过期，不需要再记录
+func PurgeAgentNonces(db *sql.DB, before time.Time) error {
+	if _, err := db.Exec(`DELETE FROM agent_nonces WHERE used_at < $1`, before.UTC()); err != nil {
+		return fmt.Errorf("failed to purge agent nonces: %v", err)
+	}
+	return nil
+}
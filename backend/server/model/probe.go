@@ -0,0 +1,101 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// 定义拨测结果结构体，各阶段耗时均为毫秒
+type ProbeResult struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Target     string   `json:"target"`
+	Success    bool     `json:"success"`
+	Error      string   `json:"error,omitempty"`
+	DurationMs float64  `json:"duration_ms"`
+	StatusCode int      `json:"status_code,omitempty"`
+	DNSMs      float64  `json:"dns_ms,omitempty"`
+	ConnectMs  float64  `json:"connect_ms,omitempty"`
+	TLSMs      float64  `json:"tls_ms,omitempty"`
+	TTFBMs     float64  `json:"ttfb_ms,omitempty"`
+	Answers    []string `json:"answers,omitempty"`
+	CheckedAt  int64    `json:"checked_at"`
+}
+
+// ProbeRecord 一次拨测的历史记录
+type ProbeRecord struct {
+	Time       string   `json:"time"`
+	Type       string   `json:"type"`
+	Target     string   `json:"target"`
+	Success    bool     `json:"success"`
+	Error      string   `json:"error,omitempty"`
+	DurationMs float64  `json:"duration_ms"`
+	StatusCode int      `json:"status_code,omitempty"`
+	DNSMs      float64  `json:"dns_ms,omitempty"`
+	ConnectMs  float64  `json:"connect_ms,omitempty"`
+	TLSMs      float64  `json:"tls_ms,omitempty"`
+	TTFBMs     float64  `json:"ttfb_ms,omitempty"`
+	Answers    []string `json:"answers,omitempty"`
+}
+
+// InsertProbeResults 保存拨测结果
+// agent 每次上报都带有各拨测的最新结果，未重新执行的拨测按 checked_at 去重
+func InsertProbeResults(db *sql.DB, hostname string, probeResults []ProbeResult) error {
+	for _, r := range probeResults {
+		answersJSON, err := json.Marshal(r.Answers)
+		if err != nil {
+			return fmt.Errorf("failed to marshal probe answers: %v", err)
+		}
+		_, err = db.Exec(`
+		INSERT INTO probe_results (host_name, probe_name, probe_type, target, success, error, duration_ms,
+			status_code, dns_ms, connect_ms, tls_ms, ttfb_ms, answers, checked_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		ON CONFLICT (host_name, probe_name, checked_at) DO NOTHING`,
+			hostname, r.Name, r.Type, r.Target, r.Success, r.Error, r.DurationMs,
+			r.StatusCode, r.DNSMs, r.ConnectMs, r.TLSMs, r.TTFBMs, answersJSON, time.Unix(r.CheckedAt, 0).UTC())
+		if err != nil {
+			return fmt.Errorf("failed to insert probe result %s: %v", r.Name, err)
+		}
+	}
+	return nil
+}
+
+// ReadProbeResults 查询主机在时间范围内的拨测历史，按拨测名称分组并按时间升序排列，name 为空时返回所有拨测
+func ReadProbeResults(db *sql.DB, hostname, name string, from, to time.Time) (map[string][]ProbeRecord, error) {
+	rows, err := db.Query(`
+	SELECT probe_name, probe_type, target, success, COALESCE(error, ''), duration_ms,
+		COALESCE(status_code, 0), COALESCE(dns_ms, 0), COALESCE(connect_ms, 0), COALESCE(tls_ms, 0), COALESCE(ttfb_ms, 0),
+		answers, checked_at
+	FROM probe_results
+	WHERE host_name = $1 AND ($2 = '' OR probe_name = $2) AND checked_at BETWEEN $3 AND $4
+	ORDER BY probe_name, checked_at`, hostname, name, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("查询拨测结果时发生错误: %v", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string][]ProbeRecord)
+	for rows.Next() {
+		var probeName string
+		var answersJSON []byte
+		var checkedAt time.Time
+		var r ProbeRecord
+		if err := rows.Scan(&probeName, &r.Type, &r.Target, &r.Success, &r.Error, &r.DurationMs,
+			&r.StatusCode, &r.DNSMs, &r.ConnectMs, &r.TLSMs, &r.TTFBMs, &answersJSON, &checkedAt); err != nil {
+			return nil, fmt.Errorf("扫描拨测结果时发生错误: %v", err)
+		}
+		if len(answersJSON) > 0 {
+			if err := json.Unmarshal(answersJSON, &r.Answers); err != nil {
+				return nil, fmt.Errorf("解析 JSON 数据时发生错误: %v", err)
+			}
+		}
+		r.Time = checkedAt.UTC().Format(time.RFC3339)
+		result[probeName] = append(result[probeName], r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("处理拨测结果时发生错误: %v", err)
+	}
+	return result, nil
+}
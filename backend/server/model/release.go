@@ -0,0 +1,157 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// TargetAllHosts 目标版本对所有主机生效时使用的主机名
+const TargetAllHosts = "*"
+
+// AgentRelease agent 升级文件，Signature 为对 SHA-256 摘要的 ed25519 签名（base64）
+type AgentRelease struct {
+	Version   string    `json:"version"`
+	OS        string    `json:"os"`
+	Arch      string    `json:"arch"`
+	SHA256    string    `json:"sha256"`
+	Signature string    `json:"signature"`
+	Size      int64     `json:"size"`
+	Path      string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// InsertAgentRelease 保存升级文件信息，同一版本同一平台重复上传时覆盖
+func InsertAgentRelease(db *sql.DB, r AgentRelease) error {
+	_, err := db.Exec(`
+	INSERT INTO agent_releases (version, os, arch, sha256, signature, size, path, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	ON CONFLICT (version, os, arch) DO UPDATE SET
+		sha256 = EXCLUDED.sha256, signature = EXCLUDED.signature, size = EXCLUDED.size,
+		path = EXCLUDED.path, created_at = EXCLUDED.created_at`,
+		r.Version, r.OS, r.Arch, r.SHA256, r.Signature, r.Size, r.Path, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to save agent release: %v", err)
+	}
+	return nil
+}
+
+// ListAgentReleases 查询所有升级文件，新上传的在前
+func ListAgentReleases(db *sql.DB) ([]AgentRelease, error) {
+	rows, err := db.Query(`
+	SELECT version, os, arch, sha256, signature, COALESCE(size, 0), path, created_at
+	FROM agent_releases
+	ORDER BY created_at DESC, version, os, arch`)
+	if err != nil {
+		return nil, fmt.Errorf("查询升级文件失败: %v", err)
+	}
+	defer rows.Close()
+
+	releases := []AgentRelease{}
+	for rows.Next() {
+		var r AgentRelease
+		if err := rows.Scan(&r.Version, &r.OS, &r.Arch, &r.SHA256, &r.Signature, &r.Size, &r.Path, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("读取升级文件失败: %v", err)
+		}
+		r.CreatedAt = r.CreatedAt.UTC()
+		releases = append(releases, r)
+	}
+	return releases, rows.Err()
+}
+
+// ReadAgentRelease 查询指定版本与平台的升级文件，不存在时返回 sql.ErrNoRows
+func ReadAgentRelease(db *sql.DB, version, goos, arch string) (AgentRelease, error) {
+	r := AgentRelease{Version: version, OS: goos, Arch: arch}
+	err := db.QueryRow(`
+	SELECT sha256, signature, COALESCE(size, 0), path, created_at
+	FROM agent_releases
+	WHERE version = $1 AND os = $2 AND arch = $3`, version, goos, arch).Scan(&r.SHA256, &r.Signature, &r.Size, &r.Path, &r.CreatedAt)
+	if err != nil {
+		return AgentRelease{}, err
+	}
+	r.CreatedAt = r.CreatedAt.UTC()
+	return r, nil
+}
+
+// AgentReleaseExists 指定版本是否有任意平台的升级文件
+func AgentReleaseExists(db *sql.DB, version string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM agent_releases WHERE version = $1)`, version).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("查询升级文件失败: %v", err)
+	}
+	return exists, nil
+}
+
+// IsAdmin 判断用户是否为管理员（role_id 为 1）
+func IsAdmin(db *sql.DB, username string) (bool, error) {
+	var admin bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE name = $1 AND role_id = 1)`, username).Scan(&admin)
+	if err != nil {
+		return false, fmt.Errorf("查询用户角色失败: %v", err)
+	}
+	return admin, nil
+}
+
+// SetTargetVersion 设置主机期望运行的 agent 版本，hostname 为 TargetAllHosts 时对所有主机生效，version 为空时取消
+func SetTargetVersion(db *sql.DB, hostname, version string) error {
+	var err error
+	if version == "" {
+		_, err = db.Exec(`DELETE FROM agent_target_versions WHERE host_name = $1`, hostname)
+	} else {
+		_, err = db.Exec(`
+		INSERT INTO agent_target_versions (host_name, version, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (host_name) DO UPDATE SET version = EXCLUDED.version, updated_at = EXCLUDED.updated_at`,
+			hostname, version, time.Now().UTC())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set target version: %v", err)
+	}
+	return nil
+}
+
+// ListTargetVersions 查询所有目标版本，key 为主机名，TargetAllHosts 表示所有主机
+func ListTargetVersions(db *sql.DB) (map[string]string, error) {
+	rows, err := db.Query(`SELECT host_name, version FROM agent_target_versions`)
+	if err != nil {
+		return nil, fmt.Errorf("查询目标版本失败: %v", err)
+	}
+	defer rows.Close()
+
+	targets := map[string]string{}
+	for rows.Next() {
+		var hostname, version string
+		if err := rows.Scan(&hostname, &version); err != nil {
+			return nil, fmt.Errorf("读取目标版本失败: %v", err)
+		}
+		targets[hostname] = version
+	}
+	return targets, rows.Err()
+}
+
+// DesiredRelease 查询主机期望运行的版本在其平台上的升级文件，单独为主机设置的版本优先
+// 没有设置目标版本或该版本没有对应平台的升级文件时返回 nil
+func DesiredRelease(db *sql.DB, hostname, goos, arch string) (*AgentRelease, error) {
+	var version string
+	err := db.QueryRow(`
+	SELECT version FROM agent_target_versions
+	WHERE host_name = $1 OR host_name = $2
+	ORDER BY host_name = $2
+	LIMIT 1`, hostname, TargetAllHosts).Scan(&version)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询目标版本失败: %v", err)
+	}
+
+	r, err := ReadAgentRelease(db, version, goos, arch)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询升级文件失败: %v", err)
+	}
+	return &r, nil
+}
@@ -0,0 +1,142 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// 被监视进程的状态变化事件
+const (
+	WatchEventUp      = "up"
+	WatchEventDown    = "down"
+	WatchEventRestart = "restart"
+)
+
+// 定义被监视进程状态结构体
+type WatchStatus struct {
+	Name          string  `json:"name"`
+	State         string  `json:"state"`
+	Instances     int     `json:"instances"`
+	PIDs          []int32 `json:"pids"`
+	Restarts      int     `json:"restarts"`
+	RestartsTotal int     `json:"restarts_total"`
+	Uptime        uint64  `json:"uptime"`
+	Error         string  `json:"error,omitempty"`
+}
+
+type WatchData struct {
+	Time string        `json:"time"`
+	Data []WatchStatus `json:"data"`
+}
+
+// WatchTransition 被监视进程的一次状态变化
+type WatchTransition struct {
+	Time      string  `json:"time"`
+	Event     string  `json:"event"`
+	State     string  `json:"state"`
+	Instances int     `json:"instances"`
+	PIDs      []int32 `json:"pids"`
+	Restarts  int     `json:"restarts,omitempty"`
+}
+
+// InsertWatchStatuses 追加被监视进程的状态，并记录相对上一次状态的变化
+// 首次上报的进程记录一次当前状态，之后只在 up/down 切换或发生重启时记录
+func InsertWatchStatuses(db *sql.DB, hostname string, statuses []WatchStatus, collectedAt time.Time) error {
+	if len(statuses) == 0 {
+		return nil
+	}
+	watchData := WatchData{
+		Time: SampleTime(collectedAt),
+		Data: statuses,
+	}
+	if err := appendSystemInfo(db, hostname, "watchlist", watchData); err != nil {
+		return err
+	}
+
+	changedAt, err := time.Parse(time.RFC3339, watchData.Time)
+	if err != nil {
+		return fmt.Errorf("failed to parse sample time: %v", err)
+	}
+	for _, st := range statuses {
+		var lastState string
+		err := db.QueryRow(`
+		SELECT state FROM process_states
+		WHERE host_name = $1 AND watch_name = $2
+		ORDER BY changed_at DESC, id DESC
+		LIMIT 1`, hostname, st.Name).Scan(&lastState)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to query last process state %s: %v", st.Name, err)
+		}
+
+		event := ""
+		switch {
+		case err == sql.ErrNoRows || lastState != st.State:
+			event = st.State
+		case st.Restarts > 0:
+			event = WatchEventRestart
+		}
+		if event == "" {
+			continue
+		}
+
+		pidsJSON, err := json.Marshal(st.PIDs)
+		if err != nil {
+			return fmt.Errorf("failed to marshal process pids: %v", err)
+		}
+		_, err = db.Exec(`
+		INSERT INTO process_states (host_name, watch_name, event, state, instances, pids, restarts, changed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (host_name, watch_name, event, changed_at) DO NOTHING`,
+			hostname, st.Name, event, st.State, st.Instances, pidsJSON, st.Restarts, changedAt.UTC())
+		if err != nil {
+			return fmt.Errorf("failed to insert process state %s: %v", st.Name, err)
+		}
+	}
+	return nil
+}
+
+// ReadWatchTransitions 查询主机在时间范围内被监视进程的状态变化，按名称分组并按时间升序排列，name 为空时返回所有进程
+func ReadWatchTransitions(db *sql.DB, hostname, name string, from, to time.Time) (map[string][]WatchTransition, error) {
+	rows, err := db.Query(`
+	SELECT watch_name, event, state, instances, pids, COALESCE(restarts, 0), changed_at
+	FROM process_states
+	WHERE host_name = $1 AND ($2 = '' OR watch_name = $2) AND changed_at BETWEEN $3 AND $4
+	ORDER BY watch_name, changed_at, id`, hostname, name, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("查询进程状态变化时发生错误: %v", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string][]WatchTransition)
+	for rows.Next() {
+		var watchName string
+		var pidsJSON []byte
+		var changedAt time.Time
+		var t WatchTransition
+		if err := rows.Scan(&watchName, &t.Event, &t.State, &t.Instances, &pidsJSON, &t.Restarts, &changedAt); err != nil {
+			return nil, fmt.Errorf("扫描进程状态变化时发生错误: %v", err)
+		}
+		if len(pidsJSON) > 0 {
+			if err := json.Unmarshal(pidsJSON, &t.PIDs); err != nil {
+				return nil, fmt.Errorf("解析 JSON 数据时发生错误: %v", err)
+			}
+		}
+		t.Time = changedAt.UTC().Format(time.RFC3339)
+		result[watchName] = append(result[watchName], t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("处理进程状态变化时发生错误: %v", err)
+	}
+	return result, nil
+}
+
+func ReadWatchStatuses(hostname string, from, to string, result map[string]interface{}) error {
+	watchData, err := readTimeSeries(hostname, "watchlist", from, to)
+	if err != nil {
+		return err
+	}
+	result["watchlist"] = watchData
+	return nil
+}